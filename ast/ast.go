@@ -74,9 +74,12 @@ func (l *LetStatement) String() string {
 	return strings.Join(elements, " ")
 }
 
+// Target is either an identifier, index or field expression.
+// Operator is one of =, +=, -= or ..=
 type AssignmentStatement struct {
-	Name  *token.Token
-	Value Expression
+	Target   Expression
+	Operator *token.Token
+	Value    Expression
 }
 
 func (a *AssignmentStatement) TypeInfo() string {
@@ -84,13 +87,22 @@ func (a *AssignmentStatement) TypeInfo() string {
 }
 func (a *AssignmentStatement) expressionNode() {}
 func (a *AssignmentStatement) String() string {
-	elements := []string{a.Name.Value, "=", a.Value.String()}
+	elements := []string{a.Target.String(), a.Operator.Value, a.Value.String()}
 
 	return strings.Join(elements, " ")
 }
 
+// Compound assignments (+=, -=, ..=) read the target before writing to it.
+func (a *AssignmentStatement) IsCompound() bool {
+	return a.Operator.Type != token.ASSIGN
+}
+
 type IntegerExpression struct {
+	// The literal as written.
 	Value string
+	// The value the parser decoded it to.
+	Integer int
+	Token   *token.Token
 }
 
 func (n *IntegerExpression) TypeInfo() string {
@@ -102,7 +114,11 @@ func (n *IntegerExpression) String() string {
 }
 
 type FloatExpression struct {
+	// The literal as written.
 	Value string
+	// The value the parser decoded it to.
+	Float float32
+	Token *token.Token
 }
 
 func (f *FloatExpression) TypeInfo() string {
@@ -132,8 +148,12 @@ func (b *BinaryExpression) String() string {
 }
 
 type StringExpression struct {
+	// The value with escapes decoded, Raw is the text between the quotes as written.
 	Value string
+	Raw   string
 	Type  StringType
+	// The token the string was read from, nil for strings the parser made up.
+	Token *token.Token
 }
 
 func (s *StringExpression) TypeInfo() string {
@@ -153,7 +173,37 @@ func (s *StringExpression) String() string {
 		endquote = "]]"
 	}
 
-	return quote + s.Value + endquote
+	return quote + s.Raw + endquote
+}
+
+// InterpolationExpression is a string with embedded expressions, "a ${x} b" has the Strings "a " and " b" around the
+// Expressions x. The parser desugars it into Value, a concatenation which converts each expression with str().
+type InterpolationExpression struct {
+	// The opening quote.
+	Token       *token.Token
+	Strings     []*StringExpression
+	Expressions []Expression
+	Value       Expression
+}
+
+func (i *InterpolationExpression) TypeInfo() string {
+	return "interpolation-expression"
+}
+func (i *InterpolationExpression) expressionNode() {}
+func (i *InterpolationExpression) String() string {
+	return i.Value.String()
+}
+
+type NilExpression struct {
+	Token *token.Token
+}
+
+func (n *NilExpression) TypeInfo() string {
+	return "nil-expression"
+}
+func (n *NilExpression) expressionNode() {}
+func (n *NilExpression) String() string {
+	return "nil"
 }
 
 type PrefixExpression struct {
@@ -266,6 +316,9 @@ func (f *FieldExpression) String() string {
 
 type BlockStatement struct {
 	Statements []Statement
+	// Tokens around the statements, usually then or else and end. Tools use them to tell which block a position is in.
+	Start *token.Token
+	End   *token.Token
 }
 
 func (b *BlockStatement) TypeInfo() string {
@@ -305,6 +358,83 @@ func (i *IfStatement) String() string {
 	return strings.Join(elements, " ")
 }
 
+type WhileStatement struct {
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (w *WhileStatement) TypeInfo() string {
+	return "while-statement"
+}
+func (w *WhileStatement) statementNode() {}
+func (w *WhileStatement) String() string {
+	elements := []string{"while", w.Condition.String(), "then", w.Body.String(), "end"}
+
+	return strings.Join(elements, " ")
+}
+
+// Iterates over arrays, hashes or integer ranges.
+// Arrays bind (element) or (index, element), hashes bind (key) or (key, value).
+type ForStatement struct {
+	Variables []*token.Token
+	Iterable  Expression
+	Body      *BlockStatement
+}
+
+func (f *ForStatement) TypeInfo() string {
+	return "for-statement"
+}
+func (f *ForStatement) statementNode() {}
+func (f *ForStatement) String() string {
+	variables := []string{}
+
+	for _, variable := range f.Variables {
+		variables = append(variables, variable.Value)
+	}
+
+	elements := []string{"for", strings.Join(variables, ", "), "in", f.Iterable.String(), "then", f.Body.String(), "end"}
+
+	return strings.Join(elements, " ")
+}
+
+// Only valid as the iterable of a for statement, the end is exclusive.
+type RangeExpression struct {
+	Start Expression
+	End   Expression
+}
+
+func (r *RangeExpression) TypeInfo() string {
+	return "range-expression"
+}
+func (r *RangeExpression) expressionNode() {}
+func (r *RangeExpression) String() string {
+	return r.Start.String() + ".." + r.End.String()
+}
+
+type BreakStatement struct {
+	Token *token.Token
+}
+
+func (b *BreakStatement) TypeInfo() string {
+	return "break-statement"
+}
+func (b *BreakStatement) statementNode() {}
+func (b *BreakStatement) String() string {
+	return "break"
+}
+
+type ContinueStatement struct {
+	Token *token.Token
+}
+
+func (c *ContinueStatement) TypeInfo() string {
+	return "continue-statement"
+}
+func (c *ContinueStatement) statementNode() {}
+func (c *ContinueStatement) String() string {
+	return "continue"
+}
+
 type ExpressionStatement struct {
 	Inside Expression
 }
@@ -365,6 +495,8 @@ func (f *FunctionStatement) String() string {
 }
 
 type LambdaExpression struct {
+	// The fn keyword.
+	Token      *token.Token
 	Args       []*token.Token
 	Type       []*types.Type
 	Body       *BlockStatement
@@ -445,8 +577,12 @@ func (h *HashExpression) String() string {
 }
 
 type ClassStatement struct {
-	Name    *token.Token
-	Methods []*FunctionStatement
+	Name       *token.Token
+	Fields     []*token.Token
+	FieldTypes []*types.Type
+	Methods    []*FunctionStatement
+	// The closing end, nil when the class is not closed.
+	End *token.Token
 }
 
 func (c *ClassStatement) TypeInfo() string {
@@ -455,19 +591,23 @@ func (c *ClassStatement) TypeInfo() string {
 func (c *ClassStatement) statementNode() {}
 func (c *ClassStatement) String() string {
 
-	methodStrings := []string{}
+	memberStrings := []string{}
+
+	for i, field := range c.Fields {
+		memberStrings = append(memberStrings, field.Value+" "+c.FieldTypes[i].String())
+	}
 
 	for _, method := range c.Methods {
-		methodStrings = append(methodStrings, method.String())
+		memberStrings = append(memberStrings, method.String())
 	}
 
-	methodCombined := strings.Join(methodStrings, " ")
+	memberCombined := strings.Join(memberStrings, " ")
 
 	var elements []string
-	if len(methodStrings) == 0 {
+	if len(memberStrings) == 0 {
 		elements = []string{"class", c.Name.Value, "end"}
 	} else {
-		elements = []string{"class", c.Name.Value, methodCombined, "end"}
+		elements = []string{"class", c.Name.Value, memberCombined, "end"}
 	}
 
 	return strings.Join(elements, " ")
@@ -7,13 +7,25 @@ func NodeToken(node Node) *token.Token {
 	case *LetStatement:
 		return n.Name
 	case *AssignmentStatement:
-		return n.Name
+		if n.Target != nil {
+			return NodeToken(n.Target)
+		}
 	case *BinaryExpression:
 		return n.Operator
 	case *PrefixExpression:
 		return n.Operator
 	case *BooleanExpression:
 		return n.Value
+	case *NilExpression:
+		return n.Token
+	case *IntegerExpression:
+		return n.Token
+	case *FloatExpression:
+		return n.Token
+	case *StringExpression:
+		return n.Token
+	case *LambdaExpression:
+		return n.Token
 	case *IdentifierExpression:
 		return n.Value
 	case *FunctionStatement:
@@ -32,6 +44,22 @@ func NodeToken(node Node) *token.Token {
 		if n.Condition != nil {
 			return NodeToken(n.Condition)
 		}
+	case *WhileStatement:
+		if n.Condition != nil {
+			return NodeToken(n.Condition)
+		}
+	case *ForStatement:
+		if len(n.Variables) > 0 {
+			return n.Variables[0]
+		}
+	case *RangeExpression:
+		if n.Start != nil {
+			return NodeToken(n.Start)
+		}
+	case *BreakStatement:
+		return n.Token
+	case *ContinueStatement:
+		return n.Token
 	case *ParenthesisExpression:
 		if n.Inside != nil {
 			return NodeToken(n.Inside)
@@ -56,6 +84,8 @@ func NodeToken(node Node) *token.Token {
 		if len(n.Keys) > 0 {
 			return NodeToken(n.Keys[0])
 		}
+	case *InterpolationExpression:
+		return n.Token
 	case *BlockStatement:
 		if len(n.Statements) > 0 {
 			return NodeToken(n.Statements[0])
@@ -0,0 +1,100 @@
+package ast
+
+// Inspect traverses the tree depth-first, calling fn for every node.
+// Children of a node are skipped when fn returns false.
+func Inspect(node Node, fn func(Node) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *AST:
+		for _, statement := range n.Statements {
+			Inspect(statement, fn)
+		}
+	case *BlockStatement:
+		if n == nil {
+			return
+		}
+		for _, statement := range n.Statements {
+			Inspect(statement, fn)
+		}
+	case *LetStatement:
+		inspectExpression(n.Value, fn)
+	case *AssignmentStatement:
+		inspectExpression(n.Target, fn)
+		inspectExpression(n.Value, fn)
+	case *ExpressionStatement:
+		inspectExpression(n.Inside, fn)
+	case *ReturnStatement:
+		inspectExpression(n.Value, fn)
+	case *IfStatement:
+		inspectExpression(n.Condition, fn)
+		inspectBlock(n.Consequence, fn)
+		inspectBlock(n.Alternative, fn)
+	case *WhileStatement:
+		inspectExpression(n.Condition, fn)
+		inspectBlock(n.Body, fn)
+	case *ForStatement:
+		inspectExpression(n.Iterable, fn)
+		inspectBlock(n.Body, fn)
+	case *RangeExpression:
+		inspectExpression(n.Start, fn)
+		inspectExpression(n.End, fn)
+	case *FunctionStatement:
+		inspectBlock(n.Body, fn)
+	case *LambdaExpression:
+		inspectBlock(n.Body, fn)
+	case *ClassStatement:
+		for _, method := range n.Methods {
+			if method != nil {
+				Inspect(method, fn)
+			}
+		}
+	case *BinaryExpression:
+		inspectExpression(n.Left, fn)
+		inspectExpression(n.Right, fn)
+	case *PrefixExpression:
+		inspectExpression(n.Right, fn)
+	case *ParenthesisExpression:
+		inspectExpression(n.Inside, fn)
+	case *FunctionCallExpression:
+		inspectExpression(n.Caller, fn)
+		for _, argument := range n.Arguments {
+			inspectExpression(argument, fn)
+		}
+	case *IndexExpression:
+		inspectExpression(n.Caller, fn)
+		inspectExpression(n.Index, fn)
+	case *FieldExpression:
+		inspectExpression(n.Caller, fn)
+		inspectExpression(n.Field, fn)
+	case *InterpolationExpression:
+		// The expressions are shared with the desugared value.
+		inspectExpression(n.Value, fn)
+	case *ArrayExpression:
+		for _, element := range n.Elements {
+			inspectExpression(element, fn)
+		}
+	case *HashExpression:
+		for i, key := range n.Keys {
+			inspectExpression(key, fn)
+			inspectExpression(n.Values[i], fn)
+		}
+	}
+}
+
+// The parser leaves nil expressions and blocks behind on errors.
+func inspectExpression(expression Expression, fn func(Node) bool) {
+	if expression == nil {
+		return
+	}
+	Inspect(expression, fn)
+}
+
+func inspectBlock(block *BlockStatement, fn func(Node) bool) {
+	if block == nil {
+		return
+	}
+	Inspect(block, fn)
+}
@@ -1,10 +1,15 @@
 package batch
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/pspiagicw/fenc/dump"
+	"github.com/pspiagicw/fenc/object"
 	"github.com/pspiagicw/fenc/vm"
 	"github.com/pspiagicw/tremor/ast"
 	"github.com/pspiagicw/tremor/builtins"
@@ -12,65 +17,258 @@ import (
 	"github.com/pspiagicw/tremor/diagnostic"
 	"github.com/pspiagicw/tremor/lexer"
 	"github.com/pspiagicw/tremor/parser"
+	"github.com/pspiagicw/tremor/tmc"
 	"github.com/pspiagicw/tremor/typechecker"
 )
 
-func ExecFile(filename string) {
-	code := readFile(filename)
-	AST, typeMap := parseFile(code, filename)
+const tmcExtension = ".tmc"
 
-	c := compiler.NewCompiler(typeMap)
+// Exit codes returned by the commands.
+const (
+	ExitOK = 0
+	// The program has syntax, type or compile errors.
+	ExitDiagnostics = 1
+	// The command line was wrong or the file could not be read.
+	ExitUsage = 2
+	// The program failed while running.
+	ExitRuntime = 3
+)
+
+// Run compiles and runs a file, or loads it when it is a compiled .tmc file. args are returned to the script by args().
+// A program which calls exit returns the status it gave.
+func Run(filename string, args []string) int {
+	prog, code := loadProgram(filename)
+	if code != ExitOK {
+		return code
+	}
+
+	return run(prog, args, builtins.GetBuiltins())
+}
+
+// RunSandboxed compiles and runs a file within the limits of sandbox, it stops once ctx is done. A .tmc file was not
+// compiled for a sandbox and is refused.
+func RunSandboxed(ctx context.Context, filename string, args []string, sandbox builtins.Sandbox) int {
+	if filepath.Ext(filename) == tmcExtension {
+		return usageError(fmt.Errorf("%s: a compiled file cannot run in a sandbox, run its source instead.", filename))
+	}
+
+	prog, code := compileFile(filename, &sandbox)
+	if code != ExitOK {
+		return code
+	}
+
+	return run(prog, args, sandbox.Map(ctx, sandbox.Granted(builtins.Builtins)))
+}
+func run(prog *program, args []string, runtime map[string]object.Builtin) int {
+	builtins.SetArgs(args)
+
+	err := builtins.RunVM(vm.NewVM(prog.bytecode, runtime))
+
+	var exited *builtins.Exited
+	if errors.As(err, &exited) {
+		return exited.Status
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", diagnostic.Render(prog.runtimeError(err)))
+		return ExitRuntime
+	}
+
+	return ExitOK
+}
+
+// Check parses and typechecks a file without compiling it.
+func Check(filename string) int {
+	code, err := readFile(filename)
+	if err != nil {
+		return usageError(err)
+	}
+
+	_, _, errs := parseFile(code, filename, builtins.Builtins)
+	if len(errs) != 0 {
+		return reportErrors(errs)
+	}
+
+	return ExitOK
+}
+
+// Build compiles a file into a .tmc file, output defaults to the file name with a .tmc extension.
+func Build(filename string, output string) int {
+	prog, code := compileFile(filename, nil)
+	if code != ExitOK {
+		return code
+	}
+
+	if output == "" {
+		output = strings.TrimSuffix(filename, filepath.Ext(filename)) + tmcExtension
+	}
+
+	f := tmc.NewFile(filename, prog.source, prog.bytecode, builtins.GetBuiltins())
+	f.Lines = prog.lines
+
+	err := writeCompiled(output, f)
+	if err != nil {
+		return usageError(err)
+	}
+
+	return ExitOK
+}
+
+// Disasm prints the constants and instructions a file compiles to.
+func Disasm(filename string) int {
+	prog, code := loadProgram(filename)
+	if code != ExitOK {
+		return code
+	}
+
+	dump.Constants(prog.bytecode.Constants)
+	dump.Dump(prog.bytecode.Tape)
+
+	return ExitOK
+}
+
+// loadProgram reads the bytecode of a .tmc file and compiles anything else.
+func loadProgram(filename string) (*program, int) {
+	if filepath.Ext(filename) != tmcExtension {
+		return compileFile(filename, nil)
+	}
+
+	f, err := readCompiled(filename)
+	if err != nil {
+		return nil, usageError(err)
+	}
+
+	err = f.CheckBuiltins(builtins.GetBuiltins())
+	if err != nil {
+		return nil, usageError(fmt.Errorf("%s: %v", filename, err))
+	}
+
+	prog := &program{bytecode: f.Bytecode, lines: f.Lines, file: f.Source}
+
+	// The source might not be around anymore, a .tmc is meant to be shipped on its own. Runtime errors still have a
+	// location without it, only the source line is missing.
+	if source, err := os.ReadFile(f.Source); err == nil {
+		if f.IsStale(string(source)) {
+			fmt.Fprintf(os.Stderr, "warning: %s was compiled from an older version of %s.\n", filename, f.Source)
+		} else {
+			prog.source = string(source)
+		}
+	}
+
+	return prog, ExitOK
+}
+
+// compileFile runs the whole frontend, any diagnostics are reported and turned into an exit code. The code is compiled
+// for sandbox unless it is nil.
+func compileFile(filename string, sandbox *builtins.Sandbox) (*program, int) {
+	code, err := readFile(filename)
+	if err != nil {
+		return nil, usageError(err)
+	}
+
+	definitions := builtins.Builtins
+	runtime := builtins.GetBuiltins()
+	if sandbox != nil {
+		definitions = sandbox.Granted(definitions)
+		runtime = sandbox.Map(context.Background(), definitions)
+	}
+
+	AST, typeMap, errs := parseFile(code, filename, definitions)
+	if len(errs) != 0 {
+		return nil, reportErrors(errs)
+	}
+
+	c := compiler.NewCompilerWithBuiltins(typeMap, runtime)
 	c.SetSourceContext(filename, code)
-	err := c.Compile(AST)
+	c.SetSandboxed(sandbox != nil)
+	err = c.CompileProgram(AST)
 	if err != nil {
-		log.Fatalf("%s", diagnostic.Render(err))
+		return nil, reportErrors([]error{err})
+	}
+
+	return &program{bytecode: c.Bytecode(), lines: c.LineTable(), file: filename, source: code}, ExitOK
+}
+func readCompiled(filename string) (*tmc.File, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file: %v", err)
+	}
+	defer file.Close()
 
+	f, err := tmc.Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
 	}
 
-	bytecode := c.Bytecode()
+	return f, nil
+}
+func writeCompiled(filename string, f *tmc.File) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Error writing file: %v", err)
+	}
 
-	dump.Constants(bytecode.Constants)
-	dump.Dump(bytecode.Tape)
+	err = tmc.Write(file, f)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing file: %v", err)
+	}
 
-	vm := vm.NewVM(bytecode, builtins.GetBuiltins())
-	vm.Run()
+	return nil
 }
-func readFile(program string) string {
+func readFile(program string) (string, error) {
 	content, err := os.ReadFile(program)
 
 	if err != nil {
-		log.Fatalf("Error reading file: %v", err)
+		return "", fmt.Errorf("Error reading file: %v", err)
 	}
 
-	return string(content)
+	return string(content), nil
 }
 
-func parseFile(code string, filename string) (ast.Node, typechecker.TypeMap) {
+// parseFile returns the diagnostics of the first stage that fails. The checker would only report the statements the
+// parser dropped, so it runs on a clean parse.
+func parseFile(code string, filename string, definitions []builtins.BuiltinDefinition) (ast.Node, typechecker.TypeMap, []error) {
 	l := lexer.NewLexerWithFile(code, filename)
 	p := parser.NewParser(l)
 
 	ast := p.ParseAST()
 
 	if len(p.Errors()) != 0 {
-		log.Println("Parser has errors:")
-		for _, err := range p.Errors() {
-			log.Println(diagnostic.Render(err))
-		}
+		return nil, nil, collect(p.Errors())
 	}
 
 	tp := typechecker.NewTypeChecker()
 	tp.SetSourceContext(filename, code)
 	scope := typechecker.NewScope()
-	scope.SetupBuiltinFunctions()
+	scope.DeclareBuiltins(definitions)
 	_ = tp.TypeCheck(ast, scope)
 
 	if len(tp.Errors()) != 0 {
-		log.Println("Type checker has errors")
-		for _, err := range tp.Errors() {
-			log.Println(diagnostic.Render(err))
-		}
-		log.Fatal()
+		return nil, nil, collect(tp.Errors())
+	}
+
+	return ast, tp.Map(), nil
+}
+func collect[E error](errs []E) []error {
+	result := []error{}
+	for _, err := range errs {
+		result = append(result, err)
 	}
+	return result
+}
 
-	return ast, tp.Map()
+// reportErrors renders every diagnostic in source order.
+func reportErrors(errs []error) int {
+	diagnostic.Sort(errs)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s\n", diagnostic.Render(err))
+	}
+	fmt.Fprintf(os.Stderr, "Found %d error(s).\n", len(errs))
+	return ExitDiagnostics
+}
+func usageError(err error) int {
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+	return ExitUsage
 }
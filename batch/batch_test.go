@@ -0,0 +1,224 @@
+package batch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pspiagicw/fenc/vm"
+	"github.com/pspiagicw/tremor/builtins"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckExitCodes(t *testing.T) {
+	assert.Equal(t, ExitOK, Check(writeProgram(t, `let a int = 1`)))
+	assert.Equal(t, ExitDiagnostics, Check(writeProgram(t, `let a int = "one"`)))
+	assert.Equal(t, ExitDiagnostics, Check(writeProgram(t, `let a int = `)))
+	assert.Equal(t, ExitUsage, Check(filepath.Join(t.TempDir(), "missing.tm")))
+}
+
+func TestBuildDoesNotRun(t *testing.T) {
+	program := writeProgram(t, `
+    let zero = 0
+    print(1 / zero)
+    `)
+
+	assert.Equal(t, ExitOK, Build(program, filepath.Join(t.TempDir(), "program.tmc")))
+	assert.Equal(t, ExitRuntime, Run(program, nil))
+}
+
+func TestBuildAndRunCompiledFile(t *testing.T) {
+	program := writeProgram(t, `
+    fn check(n int) int then
+        let zero = 0
+        if n != 49 then
+            return 1 / zero
+        end
+        return n
+    end
+    check(7 * 7)
+    `)
+	output := filepath.Join(t.TempDir(), "program.tmc")
+
+	assert.Equal(t, ExitOK, Build(program, output))
+	assert.FileExists(t, output)
+	assert.Equal(t, ExitOK, Run(output, nil))
+	assert.Equal(t, ExitOK, Disasm(output))
+}
+
+func TestBuildDefaultOutput(t *testing.T) {
+	program := writeProgram(t, `let a = 1`)
+
+	assert.Equal(t, ExitOK, Build(program, ""))
+	assert.FileExists(t, strings.TrimSuffix(program, ".tm")+".tmc")
+}
+
+func TestRunRejectsCorruptCompiledFile(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "program.tmc")
+	assert.NoError(t, os.WriteFile(output, []byte("let a = 1"), 0o644))
+
+	assert.Equal(t, ExitUsage, Run(output, nil))
+}
+
+func TestRunPassesArguments(t *testing.T) {
+	// Dividing by zero fails the run when the arguments are not passed on.
+	program := writeProgram(t, `
+    let zero = 0
+    let given = args()
+    if len(given) != 2 then
+        print(1 / zero)
+    end
+    if given[1] != "b" then
+        print(1 / zero)
+    end
+    `)
+
+	assert.Equal(t, ExitOK, Run(program, []string{"a", "b"}))
+	assert.Equal(t, ExitRuntime, Run(program, []string{"a"}))
+
+	ctx := context.Background()
+	env := builtins.Sandbox{Capabilities: []builtins.Capability{builtins.IO, builtins.Env}}
+	assert.Equal(t, ExitOK, RunSandboxed(ctx, program, []string{"a", "b"}, env))
+	assert.Equal(t, ExitDiagnostics, RunSandboxed(ctx, program, []string{"a", "b"}, builtins.Sandbox{Capabilities: []builtins.Capability{builtins.IO}}))
+}
+
+func TestRuntimeErrorLocation(t *testing.T) {
+	filename := writeProgram(t, `fn divide(a int, b int) int then
+    return a / b
+end
+let zero = 0
+divide(1, zero)`)
+
+	prog, code := compileFile(filename, nil)
+	assert.Equal(t, ExitOK, code)
+
+	err := vm.NewVM(prog.bytecode, builtins.GetBuiltins()).Run()
+	d := prog.runtimeError(err)
+
+	assert.Equal(t, "Division by zero.", d.Message)
+	assert.Equal(t, 2, d.Span.StartLine)
+	assert.Equal(t, 14, d.Span.StartColumn)
+	assert.Equal(t, []string{
+		"in divide at " + filename + ":2:14",
+		"in <main> at " + filename + ":5:1",
+	}, d.Notes)
+}
+
+func TestRuntimeErrorCollapsesRecursion(t *testing.T) {
+	filename := writeProgram(t, `fn f() then
+    f()
+end
+f()`)
+
+	prog, code := compileFile(filename, nil)
+	assert.Equal(t, ExitOK, code)
+
+	d := prog.runtimeError(vm.NewVM(prog.bytecode, builtins.GetBuiltins()).Run())
+
+	require.Len(t, d.Notes, 3)
+	assert.Equal(t, "in f at "+filename+":2:5", d.Notes[0])
+	assert.Regexp(t, `^\.\.\. \d+ more frames of f$`, d.Notes[1])
+	assert.Equal(t, "in <main> at "+filename+":4:1", d.Notes[2])
+
+	filename = writeProgram(t, `fn a() then
+    b()
+end
+fn b() then
+    a()
+end
+a()`)
+
+	prog, code = compileFile(filename, nil)
+	assert.Equal(t, ExitOK, code)
+
+	d = prog.runtimeError(vm.NewVM(prog.bytecode, builtins.GetBuiltins()).Run())
+
+	require.Len(t, d.Notes, 21)
+	assert.Regexp(t, `^\.\.\. \d+ more frames$`, d.Notes[20])
+}
+
+func TestRuntimeErrorFromCompiledFile(t *testing.T) {
+	filename := writeProgram(t, `let values = [1, 2]
+let i = 5
+print(values[i])`)
+	output := filepath.Join(t.TempDir(), "program.tmc")
+	assert.Equal(t, ExitOK, Build(filename, output))
+
+	prog, code := loadProgram(output)
+	assert.Equal(t, ExitOK, code)
+
+	err := vm.NewVM(prog.bytecode, builtins.GetBuiltins()).Run()
+	d := prog.runtimeError(err)
+
+	assert.NotEmpty(t, d.Source)
+	assert.Equal(t, 3, d.Span.StartLine)
+	assert.Equal(t, []string{"in <main> at " + filename + ":3:7"}, d.Notes)
+}
+
+func TestExitStatus(t *testing.T) {
+	assert.Equal(t, 4, Run(writeProgram(t, "fn fail() then\n    exit(4)\nend\nfail()\nexit(1)\n"), nil))
+	assert.Equal(t, ExitOK, Run(writeProgram(t, "exit()\nlet x = 1 / 0\n"), nil))
+	assert.Equal(t, ExitRuntime, Run(writeProgram(t, "exit(300)\n"), nil))
+	assert.Equal(t, ExitRuntime, Run(writeProgram(t, "exit(-1)\n"), nil))
+}
+
+func TestRunSandboxed(t *testing.T) {
+	ctx := context.Background()
+	loop := writeProgram(t, "while true then\nend\n")
+	hello := writeProgram(t, "print(\"hi\")\n")
+
+	assert.Equal(t, ExitRuntime, RunSandboxed(ctx, loop, nil, builtins.Sandbox{Steps: 10}))
+	assert.Equal(t, ExitDiagnostics, RunSandboxed(ctx, hello, nil, builtins.Sandbox{}))
+	assert.Equal(t, ExitOK, RunSandboxed(ctx, hello, nil, builtins.Sandbox{Capabilities: []builtins.Capability{builtins.IO}}))
+
+	output := filepath.Join(t.TempDir(), "hello.tmc")
+	assert.Equal(t, ExitOK, Build(hello, output))
+	assert.Equal(t, ExitUsage, RunSandboxed(ctx, output, nil, builtins.Sandbox{}))
+}
+
+func TestRunSandboxedDoesNotPanic(t *testing.T) {
+	ctx := context.Background()
+	// The statement after return is never typechecked, the emitter panics on it.
+	dead := writeProgram(t, "fn f() int then\n    return 1\n    print(zzz)\nend\n")
+	missing := writeProgram(t, "let h = {\"a\": 1}\nh[\"b\"] += 1\n")
+
+	assert.Equal(t, ExitDiagnostics, RunSandboxed(ctx, dead, nil, builtins.Sandbox{Capabilities: builtins.Capabilities}))
+	assert.Equal(t, ExitRuntime, RunSandboxed(ctx, missing, nil, builtins.Sandbox{}))
+}
+
+func TestFormatCheckAndWrite(t *testing.T) {
+	filename := writeProgram(t, "let x=1\n")
+
+	assert.Equal(t, ExitDiagnostics, Format([]string{filename}, FormatCheck))
+
+	assert.Equal(t, ExitOK, Format([]string{filename}, FormatWrite))
+	content, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "let x = 1\n", string(content))
+
+	assert.Equal(t, ExitOK, Format([]string{filename}, FormatCheck))
+}
+
+func TestFormatLeavesBrokenFilesAlone(t *testing.T) {
+	filename := writeProgram(t, "let x = \n")
+
+	assert.Equal(t, ExitDiagnostics, Format([]string{filename}, FormatWrite))
+	content, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "let x = \n", string(content))
+
+	assert.Equal(t, ExitUsage, Format([]string{filename, filename + ".missing"}, FormatCheck))
+}
+
+func writeProgram(t *testing.T, source string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "program.tm")
+	err := os.WriteFile(filename, []byte(source), 0o644)
+	assert.NoError(t, err)
+
+	return filename
+}
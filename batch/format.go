@@ -0,0 +1,70 @@
+package batch
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pspiagicw/tremor/formatter"
+)
+
+// FormatMode is what Format does with the formatted source.
+type FormatMode int
+
+const (
+	// Print the formatted source to stdout.
+	FormatPrint FormatMode = iota
+	// List the files which are not formatted, without changing them.
+	FormatCheck
+	// Rewrite the files which are not formatted.
+	FormatWrite
+)
+
+// Format formats every file, files with syntax errors are reported and left alone. In check mode the exit code is
+// ExitDiagnostics when any file needs formatting.
+func Format(filenames []string, mode FormatMode) int {
+	result := ExitOK
+
+	for _, filename := range filenames {
+		code := formatFile(filename, mode)
+		if code > result {
+			result = code
+		}
+	}
+
+	return result
+}
+func formatFile(filename string, mode FormatMode) int {
+	code, err := readFile(filename)
+	if err != nil {
+		return usageError(err)
+	}
+
+	formatted, errs := formatter.Format(code, filename)
+	if len(errs) != 0 {
+		return reportErrors(errs)
+	}
+
+	switch mode {
+	case FormatCheck:
+		if formatted != code {
+			fmt.Println(filename)
+			return ExitDiagnostics
+		}
+	case FormatWrite:
+		if formatted == code {
+			return ExitOK
+		}
+		info, err := os.Stat(filename)
+		if err != nil {
+			return usageError(fmt.Errorf("Error writing file: %v", err))
+		}
+		err = os.WriteFile(filename, []byte(formatted), info.Mode().Perm())
+		if err != nil {
+			return usageError(fmt.Errorf("Error writing file: %v", err))
+		}
+	default:
+		fmt.Print(formatted)
+	}
+
+	return ExitOK
+}
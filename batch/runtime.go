@@ -0,0 +1,22 @@
+package batch
+
+import (
+	"github.com/pspiagicw/fenc/emitter"
+	"github.com/pspiagicw/tremor/compiler"
+	"github.com/pspiagicw/tremor/diagnostic"
+	"github.com/pspiagicw/tremor/lines"
+)
+
+// program is compiled bytecode with what is needed to report its runtime errors.
+type program struct {
+	bytecode emitter.ByteCode
+	lines    *lines.Table
+	file     string
+	// Empty when the source is not available, runtime errors then have no source line.
+	source string
+}
+
+// runtimeError turns a failure of the VM into a diagnostic pointing at the tremor code which was running.
+func (p *program) runtimeError(err error) *diagnostic.Diagnostic {
+	return compiler.RuntimeError(err, p.bytecode, p.lines, p.file, p.source)
+}
@@ -0,0 +1,166 @@
+package builtins
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/tremor/types"
+)
+
+// Type variables of the array builtins, a call binds them to the types of its arguments.
+var (
+	elementT = types.NewGenericType("T")
+	elementU = types.NewGenericType("U")
+	// Elements sort and sort_by can compare.
+	orderedT = types.NewGenericType("T", types.IntType, types.FloatType, types.StringType)
+	orderedK = types.NewGenericType("K", types.IntType, types.FloatType, types.StringType)
+)
+
+func arrayOf(element *types.Type) *types.Type {
+	return &types.Type{Kind: types.ARRAY, KeyType: element}
+}
+
+// Arrays never change in place, every builtin returns a new array.
+var arrayBuiltins = []BuiltinDefinition{
+	{
+		Name:       "push",
+		InputType:  []*types.Type{arrayOf(elementT), elementT},
+		OutputType: arrayOf(elementT),
+		Impl: func(args ...object.Object) object.Object {
+			array := args[0].(object.Array)
+			return object.Array{Values: append(slices.Clone(array.Values), args[1])}
+		},
+	},
+	{
+		// Returns the array without its last element.
+		Name:       "pop",
+		InputType:  []*types.Type{arrayOf(elementT)},
+		OutputType: arrayOf(elementT),
+		Impl: func(args ...object.Object) object.Object {
+			array := args[0].(object.Array)
+			if len(array.Values) == 0 {
+				return object.Error{Message: "Cannot pop from an empty array."}
+			}
+			return object.Array{Values: slices.Clone(array.Values[:len(array.Values)-1])}
+		},
+	},
+	{
+		// The elements from start upto end, end defaults to the length of the array.
+		Name:       "slice",
+		InputType:  []*types.Type{arrayOf(elementT), types.IntType, types.NewOptionalType(types.IntType)},
+		OutputType: arrayOf(elementT),
+		Impl: func(args ...object.Object) object.Object {
+			array := args[0].(object.Array)
+			start := args[1].(object.Int).Value
+			end := len(array.Values)
+			if len(args) == 3 {
+				if value, ok := args[2].(object.Int); ok {
+					end = value.Value
+				}
+			}
+
+			if start < 0 || start > end || end > len(array.Values) {
+				return object.Error{Message: fmt.Sprintf("Slice [%d:%d] is out of range for an array of %d elements.", start, end, len(array.Values))}
+			}
+			return object.Array{Values: slices.Clone(array.Values[start:end])}
+		},
+	},
+	{
+		Name:       "sort",
+		InputType:  []*types.Type{arrayOf(orderedT)},
+		OutputType: arrayOf(orderedT),
+		Impl: func(args ...object.Object) object.Object {
+			values := slices.Clone(args[0].(object.Array).Values)
+			slices.SortStableFunc(values, compare)
+			return object.Array{Values: values}
+		},
+	},
+	{
+		Name:       "map",
+		InputType:  []*types.Type{arrayOf(elementT), types.NewFunctionType([]*types.Type{elementT}, elementU)},
+		OutputType: arrayOf(elementU),
+		Impl:       directOnly("map"),
+	},
+	{
+		Name:       "filter",
+		InputType:  []*types.Type{arrayOf(elementT), types.NewFunctionType([]*types.Type{elementT}, types.BoolType)},
+		OutputType: arrayOf(elementT),
+		Impl:       directOnly("filter"),
+	},
+	{
+		// Folds the array from the left, starting with initial.
+		Name:       "reduce",
+		InputType:  []*types.Type{arrayOf(elementT), types.NewFunctionType([]*types.Type{elementU, elementT}, elementU), elementU},
+		OutputType: elementU,
+		Impl:       directOnly("reduce"),
+	},
+	{
+		// Sorts by the key of every element, elements with equal keys keep their order.
+		Name:       "sort_by",
+		InputType:  []*types.Type{arrayOf(elementT), types.NewFunctionType([]*types.Type{elementT}, orderedK)},
+		OutputType: arrayOf(elementT),
+		Impl:       directOnly("sort_by"),
+	},
+}
+
+// directOnly backs the builtins taking a function, the compiler lowers every call to them into a loop since a builtin
+// cannot call back into the VM. The typechecker does not let them be used as values, so this is never reached.
+func directOnly(name string) func(...object.Object) object.Object {
+	return func(args ...object.Object) object.Object {
+		return object.Error{Message: fmt.Sprintf("Builtin '%s' can only be called directly.", name)}
+	}
+}
+
+// Used by the loops map, filter, reduce and sort_by are lowered into.
+var arrayInternals = []BuiltinDefinition{
+	{
+		// Appends to an array the compiled code owns, the backing array is reused when it has room.
+		Name:       "__append",
+		InputType:  []*types.Type{types.ArrayType, types.AnyType},
+		OutputType: types.ArrayType,
+		Impl: func(args ...object.Object) object.Object {
+			array := args[0].(object.Array)
+			return object.Array{Values: append(array.Values, args[1])}
+		},
+	},
+	{
+		// Sorts the values by the keys at the same positions.
+		Name:       "__sort_by",
+		InputType:  []*types.Type{types.ArrayType, types.ArrayType},
+		OutputType: types.ArrayType,
+		Impl: func(args ...object.Object) object.Object {
+			values := args[0].(object.Array).Values
+			keys := args[1].(object.Array).Values
+
+			order := make([]int, len(values))
+			for i := range order {
+				order[i] = i
+			}
+			slices.SortStableFunc(order, func(i, j int) int {
+				return compare(keys[i], keys[j])
+			})
+
+			sorted := make([]object.Object, len(values))
+			for i, position := range order {
+				sorted[i] = values[position]
+			}
+			return object.Array{Values: sorted}
+		},
+	},
+}
+
+// compare orders two ints, floats or strings, the typechecker only lets those reach it.
+func compare(a, b object.Object) int {
+	switch a := a.(type) {
+	case object.Int:
+		return cmp.Compare(a.Value, b.(object.Int).Value)
+	case object.Float:
+		return cmp.Compare(a.Value, b.(object.Float).Value)
+	case object.String:
+		return cmp.Compare(a.Value, b.(object.String).Value)
+	default:
+		return 0
+	}
+}
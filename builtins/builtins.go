@@ -2,7 +2,10 @@ package builtins
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"sort"
 
 	"github.com/pspiagicw/fenc/object"
 	"github.com/pspiagicw/tremor/types"
@@ -13,13 +16,32 @@ type BuiltinDefinition struct {
 	InputType  []*types.Type
 	OutputType *types.Type
 	Impl       func(...object.Object) object.Object
+	// The side effect the builtin has, empty when it has none. A sandbox leaves out the builtins it does not grant.
+	Capability Capability
+}
+
+// scriptArgs is returned by the args builtin.
+var scriptArgs = []string{}
+
+// SetArgs sets the script arguments returned by args().
+func SetArgs(args []string) {
+	scriptArgs = args
+}
+
+// output is where print writes.
+var output io.Writer = os.Stdout
+
+// SetOutput sets where print writes, the REPL collects the output of a run before showing it.
+func SetOutput(w io.Writer) {
+	output = w
 }
 
 // TODO: Implement traits and other things, or atleast think about it.
-var Builtins = []BuiltinDefinition{
+var Builtins = append([]BuiltinDefinition{
 	{
 		// TODO: Evaluate object system, do we need string() and content() methods, do we need more methods?
-		Name: "print",
+		Name:       "print",
+		Capability: IO,
 		InputType: []*types.Type{
 			types.NewAnyType(
 				[]*types.Type{
@@ -29,13 +51,14 @@ var Builtins = []BuiltinDefinition{
 					types.IntType,
 					types.FloatType,
 					types.HashType,
+					types.ClassType,
 				},
 			),
 		},
 		OutputType: types.VoidType,
 		Impl: func(args ...object.Object) object.Object {
 			for _, o := range args {
-				fmt.Println(o.String())
+				fmt.Fprintln(output, o.String())
 			}
 			return object.Null{}
 		},
@@ -91,22 +114,128 @@ var Builtins = []BuiltinDefinition{
 		},
 	},
 	{
-		Name:       "exit",
+		// The arguments given after the script, `tremor run script.tm a b` gives ["a", "b"].
+		Name:       "args",
+		Capability: Env,
 		InputType:  []*types.Type{},
+		OutputType: &types.Type{Kind: types.ARRAY, KeyType: types.StringType},
+		Impl: func(args ...object.Object) object.Object {
+			values := []object.Object{}
+			for _, arg := range scriptArgs {
+				values = append(values, object.CreateString(arg))
+			}
+			return object.Array{Values: values}
+		},
+	},
+	{
+		// Ends the program with a status from 0 to 255, 0 when it is left out. The VM is unwound, see RunVM.
+		Name:       "exit",
+		Capability: Exit,
+		InputType:  []*types.Type{types.NewOptionalType(types.IntType)},
 		OutputType: types.VoidType,
 		Impl: func(args ...object.Object) object.Object {
-			os.Exit(0)
+			status := 0
+			if len(args) != 0 {
+				if code, ok := args[0].(object.Int); ok {
+					status = code.Value
+				}
+			}
+			if status < 0 || status > 255 {
+				return object.Error{Message: fmt.Sprintf("Exit status %d is outside 0 to 255.", status)}
+			}
+			panic(&Exited{Status: status})
+		},
+	},
+}, arrayBuiltins...)
+
+// Internals are called by compiled code only, they are never added to the TypeScope.
+var Internals = append([]BuiltinDefinition{
+	{
+		// Used to lower `for k, v in hash` loops, keys are sorted so iteration order is stable.
+		Name:       "__keys",
+		InputType:  []*types.Type{types.HashType},
+		OutputType: types.ArrayType,
+		Impl: func(args ...object.Object) object.Object {
+			hash := args[0].(object.Hash)
+
+			keys := []object.Object{}
+			for key := range hash.Values {
+				keys = append(keys, key)
+			}
+
+			sort.Slice(keys, func(i, j int) bool {
+				return keys[i].String() < keys[j].String()
+			})
+
+			return object.Array{Values: keys}
+		},
+	},
+	{
+		// Backs the nil literal.
+		Name:       "__nil",
+		InputType:  []*types.Type{},
+		OutputType: types.NilType,
+		Impl: func(args ...object.Object) object.Object {
 			return object.Null{}
 		},
 	},
+	{
+		// Guards integer division and modulo, the divisor is returned unchanged unless it is zero.
+		Name:       "__divisor",
+		InputType:  []*types.Type{types.IntType},
+		OutputType: types.IntType,
+		Impl: func(args ...object.Object) object.Object {
+			divisor := args[0].(object.Int)
+			if divisor.Value == 0 {
+				return object.Error{Message: "Division by zero."}
+			}
+			return divisor
+		},
+	},
+	{
+		// Guards integer exponentiation, the exponent is returned unchanged unless it is negative.
+		Name:       "__exponent",
+		InputType:  []*types.Type{types.IntType},
+		OutputType: types.IntType,
+		Impl: func(args ...object.Object) object.Object {
+			exponent := args[0].(object.Int)
+			if exponent.Value < 0 {
+				return object.Error{Message: fmt.Sprintf("Negative exponent %d on an int, use a float base instead.", exponent.Value)}
+			}
+			return exponent
+		},
+	},
+	{
+		// Reads the value a compound assignment to a hash key starts from, the key has to be there.
+		Name:       "__lookup",
+		InputType:  []*types.Type{types.HashType, types.AnyType},
+		OutputType: types.AnyType,
+		Impl: func(args ...object.Object) object.Object {
+			hash := args[0].(object.Hash)
+			value, ok := hash.Values[args[1]]
+			if !ok {
+				return object.Error{Message: fmt.Sprintf("Key %s is not in the hash.", args[1])}
+			}
+			return value
+		},
+	},
+}, arrayInternals...)
+
+// GetBuiltins returns the implementations of the builtins, the internals and any extra definitions by name. The
+// compiler and the VM must be given the same set.
+func GetBuiltins(extra ...BuiltinDefinition) map[string]object.Builtin {
+	return Map(append(slices.Clip(Builtins), extra...))
 }
 
-func GetBuiltins() map[string]object.Builtin {
-	result := make(map[string]object.Builtin, len(Builtins))
+// Map returns the implementations of definitions and the internals by name.
+func Map(definitions []BuiltinDefinition) map[string]object.Builtin {
+	result := make(map[string]object.Builtin, len(definitions)+len(Internals))
 
-	for _, builtin := range Builtins {
-		result[builtin.Name] = object.Builtin{
-			Internal: builtin.Impl,
+	for _, list := range [][]BuiltinDefinition{definitions, Internals} {
+		for _, builtin := range list {
+			result[builtin.Name] = object.Builtin{
+				Internal: builtin.Impl,
+			}
 		}
 	}
 
@@ -115,8 +244,6 @@ func GetBuiltins() map[string]object.Builtin {
 
 // Add other builtins
 
-// TODO: push
-// TODO: pop
 // TODO: sqrt
 // TODO: exp
 // TODO: min
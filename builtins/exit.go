@@ -0,0 +1,36 @@
+package builtins
+
+import (
+	"fmt"
+
+	"github.com/pspiagicw/fenc/vm"
+)
+
+// Exited is returned by RunVM when the program called exit.
+type Exited struct {
+	Status int
+}
+
+func (e *Exited) Error() string {
+	return fmt.Sprintf("Program exited with status %d.", e.Status)
+}
+
+// RunVM runs machine, a program which calls exit stops there with an *Exited error. fenc has no way for a builtin to
+// stop the VM, so exit panics and the panic is recovered here. Any other panic of the VM or a builtin is returned as an
+// error, the program fails instead of the process running it.
+func RunVM(machine *vm.VM) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		exited, ok := r.(*Exited)
+		if !ok {
+			err = fmt.Errorf("Program crashed: %v.", r)
+			return
+		}
+		err = exited
+	}()
+
+	return machine.Run()
+}
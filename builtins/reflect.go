@@ -0,0 +1,232 @@
+package builtins
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/tremor/types"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// FromFunc turns an ordinary Go function into a builtin, its signature is derived from the function's. Integers,
+// floats, strings, bools and slices and maps of them are supported, slices become arrays and maps hashes. A function
+// can return nothing, a value, an error or a value and an error, a non-nil error fails the run with its message.
+func FromFunc(name string, fn any) (BuiltinDefinition, error) {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return BuiltinDefinition{}, fmt.Errorf("Builtin '%s' needs a function, got %T.", name, fn)
+	}
+
+	signature := value.Type()
+	if signature.IsVariadic() {
+		return BuiltinDefinition{}, fmt.Errorf("Builtin '%s' cannot be variadic.", name)
+	}
+
+	definition := BuiltinDefinition{Name: name, InputType: []*types.Type{}}
+
+	for i := 0; i < signature.NumIn(); i++ {
+		argType, err := typeOf(signature.In(i))
+		if err != nil {
+			return BuiltinDefinition{}, fmt.Errorf("Builtin '%s' argument %d: %w", name, i+1, err)
+		}
+		definition.InputType = append(definition.InputType, argType)
+	}
+
+	outputs := []reflect.Type{}
+	for i := 0; i < signature.NumOut(); i++ {
+		outputs = append(outputs, signature.Out(i))
+	}
+
+	// A trailing error is reported, not returned to tremor.
+	returnsError := len(outputs) != 0 && outputs[len(outputs)-1] == errorType
+	if returnsError {
+		outputs = outputs[:len(outputs)-1]
+	}
+
+	switch len(outputs) {
+	case 0:
+		definition.OutputType = types.VoidType
+	case 1:
+		outputType, err := typeOf(outputs[0])
+		if err != nil {
+			return BuiltinDefinition{}, fmt.Errorf("Builtin '%s' result: %w", name, err)
+		}
+		definition.OutputType = outputType
+	default:
+		return BuiltinDefinition{}, fmt.Errorf("Builtin '%s' returns more than one value, return a value and an error at most.", name)
+	}
+
+	definition.Impl = func(args ...object.Object) (result object.Object) {
+		// A panicking function fails the run like any other builtin error.
+		defer func() {
+			if r := recover(); r != nil {
+				result = object.Error{Message: fmt.Sprintf("Builtin '%s' panicked: %v.", name, r)}
+			}
+		}()
+
+		in := []reflect.Value{}
+		for i, arg := range args {
+			converted, err := fromObject(arg, signature.In(i))
+			if err != nil {
+				return object.Error{Message: fmt.Sprintf("%s: %s", name, err.Error())}
+			}
+			in = append(in, converted)
+		}
+
+		out := value.Call(in)
+
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return object.Error{Message: err.Error()}
+			}
+			out = out[:len(out)-1]
+		}
+
+		if len(out) == 0 {
+			return object.Null{}
+		}
+		converted, err := toObject(out[0])
+		if err != nil {
+			return object.Error{Message: fmt.Sprintf("%s: %s", name, err.Error())}
+		}
+		return converted
+	}
+
+	return definition, nil
+}
+
+// typeOf gives the tremor type of a Go type.
+func typeOf(t reflect.Type) (*types.Type, error) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return types.IntType, nil
+	case reflect.Float32, reflect.Float64:
+		return types.FloatType, nil
+	case reflect.String:
+		return types.StringType, nil
+	case reflect.Bool:
+		return types.BoolType, nil
+	case reflect.Slice:
+		element, err := typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &types.Type{Kind: types.ARRAY, KeyType: element}, nil
+	case reflect.Map:
+		key, err := typeOf(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		value, err := typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &types.Type{Kind: types.HASH, KeyType: key, ValueType: value}, nil
+	default:
+		return nil, fmt.Errorf("Go type %s has no tremor type.", t)
+	}
+}
+
+// fromObject converts a tremor value to a Go value of type t, the typechecker has made sure the kinds match.
+func fromObject(o object.Object, t reflect.Type) (reflect.Value, error) {
+	result := reflect.New(t).Elem()
+
+	switch o := o.(type) {
+	case object.Int:
+		switch {
+		case result.CanInt():
+			if result.OverflowInt(int64(o.Value)) {
+				return result, fmt.Errorf("%d does not fit in %s.", o.Value, t)
+			}
+			result.SetInt(int64(o.Value))
+		case result.CanUint():
+			if o.Value < 0 || result.OverflowUint(uint64(o.Value)) {
+				return result, fmt.Errorf("%d does not fit in %s.", o.Value, t)
+			}
+			result.SetUint(uint64(o.Value))
+		}
+	case object.Float:
+		result.SetFloat(float64(o.Value))
+	case object.String:
+		result.SetString(o.Value)
+	case object.Bool:
+		result.SetBool(o.Value)
+	case object.Array:
+		result.Set(reflect.MakeSlice(t, 0, len(o.Values)))
+		for _, element := range o.Values {
+			converted, err := fromObject(element, t.Elem())
+			if err != nil {
+				return result, err
+			}
+			result.Set(reflect.Append(result, converted))
+		}
+	case object.Hash:
+		result.Set(reflect.MakeMapWithSize(t, len(o.Values)))
+		for k, v := range o.Values {
+			key, err := fromObject(k, t.Key())
+			if err != nil {
+				return result, err
+			}
+			value, err := fromObject(v, t.Elem())
+			if err != nil {
+				return result, err
+			}
+			result.SetMapIndex(key, value)
+		}
+	default:
+		return result, fmt.Errorf("Cannot pass a %s as a %s.", o.Type(), t)
+	}
+
+	return result, nil
+}
+
+// toObject converts a Go value of a type typeOf accepted to a tremor value, it fails on unsigned integers too large for
+// an int.
+func toObject(v reflect.Value) (object.Object, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return object.CreateInt(int(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt {
+			return nil, fmt.Errorf("%d does not fit in int.", v.Uint())
+		}
+		return object.CreateInt(int(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return object.CreateFloat(float32(v.Float())), nil
+	case reflect.String:
+		return object.CreateString(v.String()), nil
+	case reflect.Bool:
+		return object.CreateBool(v.Bool()), nil
+	case reflect.Slice:
+		values := []object.Object{}
+		for i := 0; i < v.Len(); i++ {
+			converted, err := toObject(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, converted)
+		}
+		return object.Array{Values: values}, nil
+	case reflect.Map:
+		values := map[object.Object]object.Object{}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toObject(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			value, err := toObject(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+		}
+		return object.Hash{Values: values}, nil
+	default:
+		return object.Null{}, nil
+	}
+}
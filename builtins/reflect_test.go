@@ -0,0 +1,79 @@
+package builtins
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/tremor/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromFuncSignature(t *testing.T) {
+	tests := []struct {
+		fn        any
+		signature string
+	}{
+		{fn: func() {}, signature: "fn() void"},
+		{fn: func(int, string) (bool, error) { return false, nil }, signature: "fn(int,string) bool"},
+		{fn: func(float64, uint8) float32 { return 0 }, signature: "fn(float,int) float"},
+		{fn: func([]string) map[string][]int { return nil }, signature: "fn([]string) [string][]int"},
+		{fn: func(bool) error { return nil }, signature: "fn(bool) void"},
+	}
+
+	for _, tt := range tests {
+		definition, err := FromFunc("f", tt.fn)
+		require.NoError(t, err)
+		assert.Equal(t, tt.signature, types.NewFunctionType(definition.InputType, definition.OutputType).String())
+	}
+}
+
+func TestFromFuncErrors(t *testing.T) {
+	tests := []struct {
+		fn      any
+		message string
+	}{
+		{fn: 1, message: "Builtin 'f' needs a function, got int."},
+		{fn: func(...int) {}, message: "Builtin 'f' cannot be variadic."},
+		{fn: func(any) {}, message: "Builtin 'f' argument 1: Go type interface {} has no tremor type."},
+		{fn: func() (int, int) { return 0, 0 }, message: "Builtin 'f' returns more than one value, return a value and an error at most."},
+		{fn: func() *int { return nil }, message: "Builtin 'f' result: Go type *int has no tremor type."},
+	}
+
+	for _, tt := range tests {
+		_, err := FromFunc("f", tt.fn)
+		assert.EqualError(t, err, tt.message)
+	}
+}
+
+func TestFromFuncCalls(t *testing.T) {
+	definition, err := FromFunc("scale", func(values []int, by float64) []float32 {
+		result := []float32{}
+		for _, v := range values {
+			result = append(result, float32(float64(v)*by))
+		}
+		return result
+	})
+	require.NoError(t, err)
+
+	result := definition.Impl(object.Array{Values: []object.Object{object.CreateInt(1), object.CreateInt(2)}}, object.CreateFloat(1.5))
+	assert.Equal(t, object.Array{Values: []object.Object{object.CreateFloat(1.5), object.CreateFloat(3)}}, result)
+
+	definition, err = FromFunc("small", func(v int8) int8 { return v })
+	require.NoError(t, err)
+	assert.Equal(t, object.Error{Message: "small: 300 does not fit in int8."}, definition.Impl(object.CreateInt(300)))
+
+	definition, err = FromFunc("fail", func() error { return errors.New("Failed.") })
+	require.NoError(t, err)
+	assert.Equal(t, object.Error{Message: "Failed."}, definition.Impl())
+
+	definition, err = FromFunc("crash", func(values []int) int { return values[3] })
+	require.NoError(t, err)
+	assert.Equal(t, object.Error{Message: "Builtin 'crash' panicked: runtime error: index out of range [3] with length 0."}, definition.Impl(object.Array{Values: []object.Object{}}))
+
+	definition, err = FromFunc("huge", func() []uint64 { return []uint64{1, math.MaxUint64} })
+	require.NoError(t, err)
+	assert.Equal(t, object.Error{Message: "huge: 18446744073709551615 does not fit in int."}, definition.Impl())
+}
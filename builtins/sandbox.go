@@ -0,0 +1,166 @@
+package builtins
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/tremor/types"
+)
+
+// Capability is a side effect a builtin has on the world outside the program.
+type Capability string
+
+const (
+	// Writing output, print.
+	IO Capability = "io"
+	// Ending the process, exit.
+	Exit Capability = "exit"
+	// Reading the environment of the process, args.
+	Env Capability = "env"
+)
+
+// Capabilities lists every capability, a sandbox granting all of them only enforces its limits.
+var Capabilities = []Capability{IO, Exit, Env}
+
+// Sandbox bounds what a program from an untrusted source can do, a zero limit is no limit. Code compiled for a
+// sandbox calls its guards, see compiler.SetSandboxed.
+type Sandbox struct {
+	// Steps bounds the loop iterations and function calls of a run. fenc has no way to count instructions, but code
+	// outside loops and calls runs once.
+	Steps int
+	// CallDepth bounds how deeply function calls nest.
+	CallDepth int
+	// CollectionSize bounds the elements of an array, the entries of a hash and the bytes of a string.
+	CollectionSize int
+	// Capabilities granted to the program, builtins needing any other one are left out of both the scope and the
+	// runtime, so calling them is a type error.
+	Capabilities []Capability
+}
+
+// Granted returns the definitions whose capability the sandbox grants.
+func (s *Sandbox) Granted(definitions []BuiltinDefinition) []BuiltinDefinition {
+	result := []BuiltinDefinition{}
+	for _, definition := range definitions {
+		if definition.Capability == "" || slices.Contains(s.Capabilities, definition.Capability) {
+			result = append(result, definition)
+		}
+	}
+	return result
+}
+
+// Map returns the runtime builtins of a sandboxed run: the granted definitions, whose results are checked against
+// CollectionSize, the internals and the guards. The guards fail the run once a limit is exceeded or ctx is done,
+// every run needs a map of its own.
+func (s *Sandbox) Map(ctx context.Context, definitions []BuiltinDefinition) map[string]object.Builtin {
+	granted := []BuiltinDefinition{}
+	for _, definition := range s.Granted(definitions) {
+		impl := definition.Impl
+		definition.Impl = func(args ...object.Object) object.Object {
+			return s.checkSize(impl(args...))
+		}
+		granted = append(granted, definition)
+	}
+
+	return Map(append(granted, s.guards(ctx)...))
+}
+
+// guards are the internals sandboxed code calls.
+func (s *Sandbox) guards(ctx context.Context) []BuiltinDefinition {
+	steps, depth := 0, 0
+
+	step := func() object.Object {
+		if err := ctx.Err(); err != nil {
+			return object.Error{Message: fmt.Sprintf("Program stopped: %v.", err)}
+		}
+		steps++
+		if s.Steps > 0 && steps > s.Steps {
+			return object.Error{Message: fmt.Sprintf("Step limit of %d exceeded.", s.Steps)}
+		}
+		return object.Null{}
+	}
+
+	return []BuiltinDefinition{
+		{
+			// Called at the start of every loop iteration.
+			Name:       "__step",
+			InputType:  []*types.Type{},
+			OutputType: types.VoidType,
+			Impl: func(args ...object.Object) object.Object {
+				return step()
+			},
+		},
+		{
+			// Called before a function call, __leave after it.
+			Name:       "__enter",
+			InputType:  []*types.Type{},
+			OutputType: types.VoidType,
+			Impl: func(args ...object.Object) object.Object {
+				depth++
+				if s.CallDepth > 0 && depth > s.CallDepth {
+					return object.Error{Message: fmt.Sprintf("Call depth limit of %d exceeded.", s.CallDepth)}
+				}
+				return step()
+			},
+		},
+		{
+			// Returns the result of the call unchanged.
+			Name:       "__leave",
+			InputType:  []*types.Type{types.AnyType},
+			OutputType: types.AnyType,
+			Impl: func(args ...object.Object) object.Object {
+				depth--
+				return args[0]
+			},
+		},
+		{
+			// Returns a string built by the program unchanged, unless it is too long.
+			Name:       "__size",
+			InputType:  []*types.Type{types.AnyType},
+			OutputType: types.AnyType,
+			Impl: func(args ...object.Object) object.Object {
+				return s.checkSize(args[0])
+			},
+		},
+		{
+			// Stores a value in a hash, in place of the STORE_ACCESS instruction which cannot be checked.
+			Name:       "__store",
+			InputType:  []*types.Type{types.HashType, types.AnyType, types.AnyType},
+			OutputType: types.VoidType,
+			Impl: func(args ...object.Object) object.Object {
+				hash := args[0].(object.Hash)
+				if _, ok := hash.Values[args[1]]; !ok && s.CollectionSize > 0 && len(hash.Values) >= s.CollectionSize {
+					return s.sizeError("Hash", len(hash.Values)+1, "entries")
+				}
+				hash.Values[args[1]] = args[2]
+				return object.Null{}
+			},
+		},
+	}
+}
+func (s *Sandbox) checkSize(value object.Object) object.Object {
+	if s.CollectionSize <= 0 {
+		return value
+	}
+
+	switch value := value.(type) {
+	case object.String:
+		if len(value.Value) > s.CollectionSize {
+			return s.sizeError("String", len(value.Value), "bytes")
+		}
+	case object.Array:
+		if len(value.Values) > s.CollectionSize {
+			return s.sizeError("Array", len(value.Values), "elements")
+		}
+	case object.Hash:
+		if len(value.Values) > s.CollectionSize {
+			return s.sizeError("Hash", len(value.Values), "entries")
+		}
+	}
+
+	return value
+}
+func (s *Sandbox) sizeError(kind string, size int, unit string) object.Object {
+	return object.Error{Message: fmt.Sprintf("%s of %d %s exceeds the collection size limit of %d.", kind, size, unit, s.CollectionSize)}
+}
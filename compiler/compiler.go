@@ -1,12 +1,15 @@
 package compiler
 
 import (
-	"strconv"
+	"fmt"
+	"maps"
 
 	"github.com/pspiagicw/fenc/emitter"
+	"github.com/pspiagicw/fenc/object"
 	"github.com/pspiagicw/tremor/ast"
 	"github.com/pspiagicw/tremor/builtins"
 	"github.com/pspiagicw/tremor/diagnostic"
+	"github.com/pspiagicw/tremor/lines"
 	"github.com/pspiagicw/tremor/token"
 	"github.com/pspiagicw/tremor/typechecker"
 	"github.com/pspiagicw/tremor/types"
@@ -17,6 +20,28 @@ type Compiler struct {
 	typeMap typechecker.TypeMap
 	source  string
 	file    string
+	// Nodes which have already been evaluated into a temporary.
+	hoisted map[ast.Node]string
+	temps   int
+	// Innermost loop is last.
+	loops []*loop
+	// Line table of the tape being emitted, the top level and every finished function body.
+	lines         *lineRecorder
+	mainLines     *lineRecorder
+	functionLines []lines.Lines
+	// Whether the code calls the guards of a sandbox.
+	sandboxed bool
+	// Names the top level stores to, in the order they were first stored.
+	globals []string
+	stored  map[string]bool
+	// Names loop variables are stored under, the innermost loop binding a name is last.
+	shadowed map[string][]string
+}
+
+// Jumps emitted by break and continue, patched once the loop is compiled.
+type loop struct {
+	breaks    []int
+	continues []int
 }
 
 func (c *Compiler) Flush(e *emitter.Emitter) {
@@ -35,14 +60,45 @@ func (c *Compiler) SetSourceContext(file string, source string) {
 }
 
 func NewCompiler(typeMap typechecker.TypeMap) *Compiler {
+	return NewCompilerWithBuiltins(typeMap, builtins.GetBuiltins())
+}
+
+// NewCompilerWithBuiltins compiles against a set of builtins which has host functions in it, the VM running the
+// bytecode must be given the same set.
+func NewCompilerWithBuiltins(typeMap typechecker.TypeMap, builtins map[string]object.Builtin) *Compiler {
+	main := &lineRecorder{}
+
 	return &Compiler{
-		e:       emitter.NewEmitter(builtins.GetBuiltins()),
-		typeMap: typeMap,
-		file:    "<input>",
+		e:         emitter.NewEmitter(builtins),
+		typeMap:   typeMap,
+		file:      "<input>",
+		hoisted:   map[ast.Node]string{},
+		stored:    map[string]bool{},
+		shadowed:  map[string][]string{},
+		lines:     main,
+		mainLines: main,
 	}
 }
 
+// CompileProgram compiles a whole program. The emitter panics on code the typechecker should have rejected, such a
+// panic is returned as an error so it does not take down an embedding host.
+func (c *Compiler) CompileProgram(node ast.Node) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Internal compiler error: %v.", r)
+		}
+	}()
+
+	return c.Compile(node)
+}
 func (c *Compiler) Compile(node ast.Node) error {
+	if name, ok := c.hoisted[node]; ok {
+		c.e.Load(name)
+		return nil
+	}
+
+	defer c.trackLines(node)()
+
 	switch node := node.(type) {
 	case *ast.AST:
 		return c.compileAST(node)
@@ -58,6 +114,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		return c.compileBoolean(node)
 	case *ast.StringExpression:
 		return c.compileString(node)
+	case *ast.InterpolationExpression:
+		return c.Compile(node.Value)
 	case *ast.ParenthesisExpression:
 		return c.compileParenthesis(node)
 	case *ast.LetStatement:
@@ -86,8 +144,21 @@ func (c *Compiler) Compile(node ast.Node) error {
 		return c.compileIndexExpression(node)
 	case *ast.ClassStatement:
 		return c.compileClassStatement(node)
+	case *ast.FieldExpression:
+		return c.compileFieldExpression(node)
+	case *ast.NilExpression:
+		pushNil(c.e)
+		return nil
 	case *ast.PrefixExpression:
 		return c.compilePrefixExpression(node)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.BreakStatement:
+		return c.compileBreakStatement(node)
+	case *ast.ContinueStatement:
+		return c.compileContinueStatement(node)
 	default:
 		return c.compileError(node, "Cannot compile node type: %v.", node.TypeInfo())
 	}
@@ -120,8 +191,114 @@ func (c *Compiler) compilePrefixExpression(node *ast.PrefixExpression) error {
 	}
 }
 
+// Instances are hashes from field name to value. Every method is a function named `Class.method` which takes the
+// instance as its first argument, self.
 func (c *Compiler) compileClassStatement(node *ast.ClassStatement) error {
-	c.e.Class(node.Name.Value)
+	classType := c.typeMap[node]
+
+	for _, method := range node.Methods {
+		args := []string{"self"}
+		for _, arg := range method.Args {
+			args = append(args, arg.Value)
+		}
+
+		err := c.compileFunction(methodName(classType, method.Name.Value), args, method.Body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.compileConstructor(node, classType)
+}
+func (c *Compiler) compileConstructor(node *ast.ClassStatement, classType *types.Type) error {
+	var init *ast.FunctionStatement
+	for _, method := range node.Methods {
+		if method.Name.Value == "init" {
+			init = method
+		}
+	}
+
+	args := []string{}
+	if init == nil {
+		args = append(args, classType.Fields...)
+	} else {
+		for _, arg := range init.Args {
+			args = append(args, arg.Value)
+		}
+	}
+
+	defer c.declareGlobal(node.Name.Value)()
+	return c.e.Function(node.Name.Value, args, func(e *emitter.Emitter) error {
+		defer c.enterFunction()()
+
+		fields := 0
+		for _, field := range classType.Fields {
+			e.PushString(field)
+			if init == nil {
+				e.Load(field)
+			} else if !pushZeroValue(e, classType.Members[field]) {
+				// No zero value, the typechecker made sure init assigns the field.
+				e.Pop()
+				continue
+			}
+			fields++
+		}
+		e.Hash(fields)
+		e.Store("self")
+
+		if init != nil {
+			e.Load("self")
+			for _, arg := range args {
+				e.Load(arg)
+			}
+			e.Load(methodName(classType, "init"))
+			e.Call(len(args) + 1)
+			e.Pop()
+		}
+
+		e.Load("self")
+		e.ReturnValue()
+		return nil
+	})
+}
+func pushZeroValue(e *emitter.Emitter, fieldType *types.Type) bool {
+	switch fieldType.Kind {
+	case types.INT:
+		e.PushInt(0)
+	case types.FLOAT:
+		e.PushFloat(0)
+	case types.STRING:
+		e.PushString("")
+	case types.BOOL:
+		e.PushBool(false)
+	case types.ARRAY:
+		e.Array(0)
+	case types.HASH:
+		e.Hash(0)
+	case types.OPTIONAL:
+		pushNil(e)
+	default:
+		return false
+	}
+	return true
+}
+
+// pushNil pushes the null object, which only the VM itself can create.
+func pushNil(e *emitter.Emitter) {
+	e.Load("__nil")
+	e.Call(0)
+}
+func methodName(classType *types.Type, method string) string {
+	return classType.Name + "." + method
+}
+func (c *Compiler) compileFieldExpression(node *ast.FieldExpression) error {
+	err := c.Compile(node.Caller)
+	if err != nil {
+		return err
+	}
+
+	c.e.PushString(node.Field.String())
+	c.e.Access()
 
 	return nil
 }
@@ -176,13 +353,163 @@ func (c *Compiler) compileArrayExpression(node *ast.ArrayExpression) error {
 }
 
 func (c *Compiler) compileAssignmentStatement(node *ast.AssignmentStatement) error {
-	err := c.Compile(node.Value)
+	switch target := node.Target.(type) {
+	case *ast.IdentifierExpression:
+		err := c.compileAssignmentValue(node)
+		if err != nil {
+			return err
+		}
+		c.store(c.resolve(target.Value.Value))
+		return nil
+	case *ast.IndexExpression:
+		return c.compileIndexAssignment(node, target)
+	case *ast.FieldExpression:
+		return c.compileFieldAssignment(node, target)
+	default:
+		return c.compileError(node, "Cannot compile assignment to %s.", node.Target.TypeInfo())
+	}
+}
+func (c *Compiler) compileIndexAssignment(node *ast.AssignmentStatement, target *ast.IndexExpression) error {
+	if node.IsCompound() {
+		// The target is read again while computing the value, so the caller and index are evaluated only once.
+		release, err := c.hoist(target.Caller, target.Index)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	err := c.Compile(target.Caller)
+	if err != nil {
+		return err
+	}
+
+	err = c.Compile(target.Index)
+	if err != nil {
+		return err
+	}
+
+	err = c.compileAssignmentValue(node)
 	if err != nil {
 		return err
 	}
-	c.e.Store(node.Name.Value)
+
+	callerType := c.typeMap[target.Caller]
+
+	switch callerType.Kind {
+	case types.ARRAY:
+		c.e.StoreIndex()
+	case types.HASH:
+		c.storeAccess()
+	}
 	return nil
 }
+func (c *Compiler) compileFieldAssignment(node *ast.AssignmentStatement, target *ast.FieldExpression) error {
+	if node.IsCompound() {
+		release, err := c.hoist(target.Caller)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	err := c.Compile(target.Caller)
+	if err != nil {
+		return err
+	}
+
+	c.e.PushString(target.Field.String())
+
+	err = c.compileAssignmentValue(node)
+	if err != nil {
+		return err
+	}
+
+	c.storeAccess()
+	return nil
+}
+func (c *Compiler) compileAssignmentValue(node *ast.AssignmentStatement) error {
+	if !node.IsCompound() {
+		return c.Compile(node.Value)
+	}
+
+	targetType := c.typeMap[node.Target]
+	valueType := c.typeMap[node.Value]
+
+	err := c.compileTargetValue(node.Target)
+	if err != nil {
+		return err
+	}
+
+	err = c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+	if valueType == types.IntType && targetType == types.FloatType {
+		c.e.ToFloat()
+	}
+
+	switch node.Operator.Type {
+	case token.PLUS_ASSIGN:
+		c.emitPlus(targetType)
+	case token.MINUS_ASSIGN:
+		c.emitMinus(targetType)
+	case token.CONCAT_ASSIGN:
+		c.addString()
+	}
+	return nil
+}
+
+// compileTargetValue pushes the value a compound assignment starts from. A hash key which is missing has none, the
+// lookup fails instead of reading nil.
+func (c *Compiler) compileTargetValue(target ast.Expression) error {
+	index, ok := target.(*ast.IndexExpression)
+	if !ok || c.typeMap[index.Caller].Kind != types.HASH {
+		return c.Compile(target)
+	}
+
+	err := c.Compile(index.Caller)
+	if err != nil {
+		return err
+	}
+	err = c.Compile(index.Index)
+	if err != nil {
+		return err
+	}
+
+	c.e.Load("__lookup")
+	c.e.Call(2)
+	return nil
+}
+
+// hoist evaluates the given nodes into temporaries, later compilations of those nodes load the temporary instead.
+func (c *Compiler) hoist(nodes ...ast.Node) (func(), error) {
+	for _, node := range nodes {
+		err := c.Compile(node)
+		if err != nil {
+			return nil, err
+		}
+
+		name := c.temporary()
+		c.store(name)
+		c.hoisted[node] = name
+	}
+
+	release := func() {
+		for _, node := range nodes {
+			delete(c.hoisted, node)
+		}
+	}
+
+	return release, nil
+}
+
+// Temporaries use a '$' prefix, which the lexer never produces for identifiers.
+func (c *Compiler) temporary() string {
+	name := fmt.Sprintf("$tmp%d", c.temps)
+	c.temps += 1
+	return name
+}
 func (c *Compiler) compileLambdaExpression(node *ast.LambdaExpression) error {
 	args := []string{}
 
@@ -191,33 +518,89 @@ func (c *Compiler) compileLambdaExpression(node *ast.LambdaExpression) error {
 	}
 
 	return c.e.Lambda(args, func(e *emitter.Emitter) error {
+		defer c.enterFunction()()
+
 		oldEmitter := c.e
+		oldLoops := c.loops
+		defer c.unshadow(args)()
 
 		c.e = e
+		c.loops = nil
 		err := c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
 
 		c.e = oldEmitter
+		c.loops = oldLoops
 
 		return nil
 	})
 }
 func (c *Compiler) compileFunctionCall(node *ast.FunctionCallExpression) error {
+	if field, ok := node.Caller.(*ast.FieldExpression); ok {
+		classType := c.typeMap[field.Caller]
+		if classType.Kind == types.CLASS && !classType.IsField(field.Field.String()) {
+			return c.compileMethodCall(node, field, classType)
+		}
+	}
 
-	for _, arg := range node.Arguments {
-		err := c.Compile(arg)
-		if err != nil {
+	// A local cannot shadow a builtin, so the name is enough.
+	if caller, ok := node.Caller.(*ast.IdentifierExpression); ok {
+		if ok, err := c.compileIntrinsic(caller.Value.Value, node.Arguments); ok {
 			return err
 		}
 	}
 
-	c.Compile(node.Caller)
+	return c.guardCall(func() error {
+		for _, arg := range node.Arguments {
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+		}
+
+		omitted := c.omitted(c.typeMap[node.Caller], len(node.Arguments))
 
-	c.e.Call(len(node.Arguments))
+		c.Compile(node.Caller)
 
-	return nil
+		c.e.Call(len(node.Arguments) + omitted)
+
+		return nil
+	})
+}
+
+func (c *Compiler) compileMethodCall(node *ast.FunctionCallExpression, field *ast.FieldExpression, classType *types.Type) error {
+	return c.guardCall(func() error {
+		err := c.Compile(field.Caller)
+		if err != nil {
+			return err
+		}
+
+		for _, arg := range node.Arguments {
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.e.Load(methodName(classType, field.Field.String()))
+		c.e.Call(len(node.Arguments) + 1)
+
+		return nil
+	})
+}
+
+// omitted passes nil for the trailing optional arguments a call to a builtin leaves out, it returns how many it passed.
+func (c *Compiler) omitted(ftype *types.Type, passed int) int {
+	if ftype == nil || ftype.Kind != types.FUNCTION {
+		return 0
+	}
+
+	for i := passed; i < len(ftype.Args); i++ {
+		pushNil(c.e)
+	}
+	return max(len(ftype.Args)-passed, 0)
 }
 
 func (c *Compiler) compileFunctionStatement(node *ast.FunctionStatement) error {
@@ -225,16 +608,26 @@ func (c *Compiler) compileFunctionStatement(node *ast.FunctionStatement) error {
 	for _, arg := range node.Args {
 		args = append(args, arg.Value)
 	}
-	return c.e.Function(node.Name.Value, args, func(e *emitter.Emitter) error {
+	return c.compileFunction(node.Name.Value, args, node.Body)
+}
+func (c *Compiler) compileFunction(name string, args []string, body *ast.BlockStatement) error {
+	defer c.declareGlobal(name)()
+	return c.e.Function(name, args, func(e *emitter.Emitter) error {
+		defer c.enterFunction()()
+
 		oldEmitter := c.e
-		// New emitter for the function's sake
+		oldLoops := c.loops
+		defer c.unshadow(args)()
+		// New emitter for the function's sake, jump targets of enclosing loops are not valid here.
 		c.e = e
-		err := c.Compile(node.Body)
+		c.loops = nil
+		err := c.Compile(body)
 		if err != nil {
 			return err
 		}
 
 		c.e = oldEmitter
+		c.loops = oldLoops
 
 		return nil
 	})
@@ -251,7 +644,7 @@ func (c *Compiler) compileReturnStatement(node *ast.ReturnStatement) error {
 	return nil
 }
 func (c *Compiler) compileIdentifierExpression(node *ast.IdentifierExpression) error {
-	c.e.Load(node.Value.Value)
+	c.e.Load(c.resolve(node.Value.Value))
 
 	return nil
 }
@@ -292,13 +685,254 @@ func (c *Compiler) compileIfStatement(node *ast.IfStatement) error {
 	)
 
 }
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	start := c.e.Position()
+	c.guardStep()
+
+	err := c.Compile(node.Condition)
+	if err != nil {
+		return err
+	}
+
+	exit := c.e.JumpFalse(0)
+
+	l, err := c.compileLoopBody(node.Body)
+	if err != nil {
+		return err
+	}
+
+	c.e.Jump(start)
+
+	end := c.e.Position()
+	c.e.PatchJump(exit, end)
+	c.patchLoop(l, start, end)
+
+	return nil
+}
+
+// All for statements are lowered into a counter running upto a limit, the variables are bound at the start of every iteration.
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if iterable, ok := node.Iterable.(*ast.RangeExpression); ok {
+		return c.compileRangeLoop(node, iterable)
+	}
+
+	err := c.Compile(node.Iterable)
+	if err != nil {
+		return err
+	}
+
+	iterable := c.temporary()
+	c.store(iterable)
+
+	iterableType := c.typeMap[node.Iterable]
+
+	switch iterableType.Kind {
+	case types.ARRAY:
+		return c.compileArrayLoop(node, iterable)
+	case types.HASH:
+		return c.compileHashLoop(node, iterable)
+	default:
+		return c.compileError(node.Iterable, "Cannot iterate over %s.", iterableType)
+	}
+}
+func (c *Compiler) compileRangeLoop(node *ast.ForStatement, iterable *ast.RangeExpression) error {
+	err := c.Compile(iterable.Start)
+	if err != nil {
+		return err
+	}
+	counter := c.temporary()
+	c.store(counter)
+
+	err = c.Compile(iterable.End)
+	if err != nil {
+		return err
+	}
+	limit := c.temporary()
+	c.store(limit)
+
+	defer c.shadow(node.Variables)()
+
+	return c.compileCountedLoop(counter, limit, node.Body, func() {
+		c.e.Load(counter)
+		c.store(c.resolve(node.Variables[0].Value))
+	})
+}
+func (c *Compiler) compileArrayLoop(node *ast.ForStatement, array string) error {
+	counter, limit := c.lengthCounter(array)
+
+	defer c.shadow(node.Variables)()
+
+	return c.compileCountedLoop(counter, limit, node.Body, func() {
+		element := c.resolve(node.Variables[0].Value)
+
+		if len(node.Variables) == 2 {
+			c.e.Load(counter)
+			c.store(element)
+			element = c.resolve(node.Variables[1].Value)
+		}
+
+		c.e.Load(array)
+		c.e.Load(counter)
+		c.e.Index()
+		c.store(element)
+	})
+}
+func (c *Compiler) compileHashLoop(node *ast.ForStatement, hash string) error {
+	c.e.Load(hash)
+	c.e.Load("__keys")
+	c.e.Call(1)
+
+	keys := c.temporary()
+	c.store(keys)
+
+	counter, limit := c.lengthCounter(keys)
+
+	defer c.shadow(node.Variables)()
+
+	return c.compileCountedLoop(counter, limit, node.Body, func() {
+		key := c.resolve(node.Variables[0].Value)
+
+		c.e.Load(keys)
+		c.e.Load(counter)
+		c.e.Index()
+		c.store(key)
+
+		if len(node.Variables) == 2 {
+			c.e.Load(hash)
+			c.e.Load(key)
+			c.e.Access()
+			c.store(c.resolve(node.Variables[1].Value))
+		}
+	})
+}
+
+// shadow stores the variables of a loop under names of their own until the returned func is called, so they can shadow
+// variables declared outside the loop. The iterable is compiled before, it still sees the outer variables.
+func (c *Compiler) shadow(variables []*token.Token) func() {
+	for _, variable := range variables {
+		c.shadowed[variable.Value] = append(c.shadowed[variable.Value], c.temporary())
+	}
+
+	return func() {
+		for _, variable := range variables {
+			names := c.shadowed[variable.Value]
+			c.shadowed[variable.Value] = names[:len(names)-1]
+		}
+	}
+}
+
+// unshadow lets the parameters of a function hide loop variables of the same name until the returned func is called,
+// the body still captures the other loop variables.
+func (c *Compiler) unshadow(args []string) func() {
+	outer := c.shadowed
+	c.shadowed = maps.Clone(outer)
+	for _, arg := range args {
+		delete(c.shadowed, arg)
+	}
+
+	return func() {
+		c.shadowed = outer
+	}
+}
+
+// resolve gives the name a variable is stored under, which differs for loop variables.
+func (c *Compiler) resolve(name string) string {
+	if names := c.shadowed[name]; len(names) != 0 {
+		return names[len(names)-1]
+	}
+	return name
+}
+
+// lengthCounter emits a counter starting at 0 and a limit holding len(array).
+func (c *Compiler) lengthCounter(array string) (string, string) {
+	c.e.PushInt(0)
+	counter := c.temporary()
+	c.store(counter)
+
+	c.e.Load(array)
+	c.e.Load("len")
+	c.e.Call(1)
+	limit := c.temporary()
+	c.store(limit)
+
+	return counter, limit
+}
+func (c *Compiler) compileCountedLoop(counter string, limit string, body *ast.BlockStatement, bind func()) error {
+	start := c.e.Position()
+	c.guardStep()
+
+	c.e.Load(counter)
+	c.e.Load(limit)
+	c.e.LtInt()
+
+	exit := c.e.JumpFalse(0)
+
+	bind()
+
+	l, err := c.compileLoopBody(body)
+	if err != nil {
+		return err
+	}
+
+	// continue jumps here, so the counter is always incremented.
+	next := c.e.Position()
+	c.e.Load(counter)
+	c.e.PushInt(1)
+	c.e.AddInt()
+	c.store(counter)
+
+	c.e.Jump(start)
+
+	end := c.e.Position()
+	c.e.PatchJump(exit, end)
+	c.patchLoop(l, next, end)
+
+	return nil
+}
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement) (*loop, error) {
+	l := &loop{}
+
+	c.loops = append(c.loops, l)
+	err := c.Compile(body)
+	c.loops = c.loops[:len(c.loops)-1]
+
+	return l, err
+}
+func (c *Compiler) patchLoop(l *loop, continueTarget int, breakTarget int) {
+	for _, jump := range l.continues {
+		c.e.PatchJump(jump, continueTarget)
+	}
+	for _, jump := range l.breaks {
+		c.e.PatchJump(jump, breakTarget)
+	}
+}
+func (c *Compiler) compileBreakStatement(node *ast.BreakStatement) error {
+	if len(c.loops) == 0 {
+		return c.compileError(node, "Cannot compile break outside of a loop.")
+	}
+
+	l := c.loops[len(c.loops)-1]
+	l.breaks = append(l.breaks, c.e.Jump(0))
+
+	return nil
+}
+func (c *Compiler) compileContinueStatement(node *ast.ContinueStatement) error {
+	if len(c.loops) == 0 {
+		return c.compileError(node, "Cannot compile continue outside of a loop.")
+	}
+
+	l := c.loops[len(c.loops)-1]
+	l.continues = append(l.continues, c.e.Jump(0))
+
+	return nil
+}
 func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
 	err := c.Compile(node.Value)
 	if err != nil {
 		return err
 	}
 
-	c.e.Store(node.Name.Value)
+	c.store(node.Name.Value)
 	return nil
 
 }
@@ -321,11 +955,7 @@ func (c *Compiler) compileBoolean(node *ast.BooleanExpression) error {
 	return nil
 }
 func (c *Compiler) compileFloat(node *ast.FloatExpression) error {
-	value, err := strconv.ParseFloat(node.Value, 32)
-	if err != nil {
-		return c.compileError(node, "Could not convert %q to float.", node.Value)
-	}
-	c.e.PushFloat(float32(value))
+	c.e.PushFloat(node.Float)
 	return nil
 }
 
@@ -348,6 +978,12 @@ func (c *Compiler) compileArithmetic(node *ast.BinaryExpression) error {
 	if rightType == types.IntType && returnType == types.FloatType {
 		c.e.ToFloat()
 	}
+	if returnType == types.IntType && isDivision(node.Operator.Type) && !isNonZeroLiteral(node.Right) {
+		c.checkDivisor()
+	}
+	if returnType == types.IntType && node.Operator.Type == token.EXPONENT && !isIntegerLiteral(node.Right) {
+		c.checkExponent()
+	}
 
 	switch node.Operator.Type {
 	case token.PLUS:
@@ -358,10 +994,44 @@ func (c *Compiler) compileArithmetic(node *ast.BinaryExpression) error {
 		c.emitMultiply(returnType)
 	case token.SLASH:
 		c.emitSlash(returnType)
+	case token.MODULUS:
+		c.e.ModInt()
+	case token.EXPONENT:
+		c.emitExponent(returnType)
 	}
 
 	return nil
 }
+
+func isDivision(operator token.TokenType) bool {
+	return operator == token.SLASH || operator == token.MODULUS
+}
+
+func isNonZeroLiteral(node ast.Expression) bool {
+	integer, ok := node.(*ast.IntegerExpression)
+	if !ok {
+		return false
+	}
+	return integer.Integer != 0
+}
+func isIntegerLiteral(node ast.Expression) bool {
+	_, ok := node.(*ast.IntegerExpression)
+	return ok
+}
+
+// checkDivisor passes the divisor on top of the stack through __divisor, which fails the program with a runtime error
+// when it is zero. Integer division by zero would otherwise crash the VM itself.
+func (c *Compiler) checkDivisor() {
+	c.e.Load("__divisor")
+	c.e.Call(1)
+}
+
+// checkExponent passes the exponent on top of the stack through __exponent, a negative one fails the program instead
+// of truncating to 0.
+func (c *Compiler) checkExponent() {
+	c.e.Load("__exponent")
+	c.e.Call(1)
+}
 func resolveType(left, right *types.Type) *types.Type {
 
 	if left == right {
@@ -425,26 +1095,29 @@ func (c *Compiler) compileComparison(node *ast.BinaryExpression) error {
 	return nil
 }
 
+// compileLogical short-circuits, the right operand is only evaluated when the left one does not decide the result.
 func (c *Compiler) compileLogical(node *ast.BinaryExpression) error {
-	operator := node.Operator.Type
-
-	err := c.Compile(node.Left)
-	if err != nil {
-		return err
+	left := func(e *emitter.Emitter) error {
+		return c.Compile(node.Left)
 	}
-	err = c.Compile(node.Right)
-	if err != nil {
-		return err
+	right := func(e *emitter.Emitter) error {
+		return c.Compile(node.Right)
 	}
 
-	switch operator {
+	switch node.Operator.Type {
 	case token.AND:
-		c.e.AndBool()
+		return c.e.If(left, right, func(e *emitter.Emitter) error {
+			c.e.PushBool(false)
+			return nil
+		})
 	case token.OR:
-		c.e.OrBool()
+		return c.e.If(left, func(e *emitter.Emitter) error {
+			c.e.PushBool(true)
+			return nil
+		}, right)
+	default:
+		return c.compileError(node, "Cannot compile logical operator %s.", node.Operator.Type)
 	}
-
-	return nil
 }
 func (c *Compiler) compileEq(node *ast.BinaryExpression) error {
 	err := c.Compile(node.Left)
@@ -482,7 +1155,7 @@ func (c *Compiler) compileConcat(node *ast.BinaryExpression) error {
 	if err != nil {
 		return err
 	}
-	c.e.AddString()
+	c.addString()
 
 	return nil
 }
@@ -491,7 +1164,7 @@ func (c *Compiler) compileBinary(node *ast.BinaryExpression) error {
 	operator := node.Operator.Type
 
 	switch operator {
-	case token.PLUS, token.MINUS, token.MULTIPLY, token.SLASH:
+	case token.PLUS, token.MINUS, token.MULTIPLY, token.SLASH, token.MODULUS, token.EXPONENT:
 		return c.compileArithmetic(node)
 	case token.GT, token.GTE, token.LT, token.LTE:
 		return c.compileComparison(node)
@@ -506,8 +1179,6 @@ func (c *Compiler) compileBinary(node *ast.BinaryExpression) error {
 	default:
 		return c.compileError(node, "Cannot compile binary operator %s.", operator)
 	}
-
-	return nil
 }
 func (c *Compiler) emitSlash(nodeType *types.Type) {
 	switch nodeType {
@@ -517,6 +1188,14 @@ func (c *Compiler) emitSlash(nodeType *types.Type) {
 		c.e.DivFloat()
 	}
 }
+func (c *Compiler) emitExponent(nodeType *types.Type) {
+	switch nodeType {
+	case types.IntType:
+		c.e.PowInt()
+	case types.FloatType:
+		c.e.PowFloat()
+	}
+}
 func (c *Compiler) emitMultiply(nodeType *types.Type) {
 	switch nodeType {
 	case types.IntType:
@@ -542,14 +1221,13 @@ func (c *Compiler) emitPlus(nodeType *types.Type) {
 	}
 }
 func (c *Compiler) compileInteger(node *ast.IntegerExpression) error {
-	value, err := strconv.Atoi(node.Value)
-	if err != nil {
-		return c.compileError(node, "Could not convert %q to integer.", node.Value)
-	}
-	c.e.PushInt(value)
+	c.e.PushInt(node.Integer)
 	return nil
 }
 func (c *Compiler) compileAST(node *ast.AST) error {
+	c.declareClasses(node.Statements)
+	c.declareFunctions(node.Statements)
+
 	for _, statement := range node.Statements {
 		err := c.Compile(statement)
 		if err != nil {
@@ -558,6 +1236,65 @@ func (c *Compiler) compileAST(node *ast.AST) error {
 	}
 	return nil
 }
+
+// declareFunctions reserves a global for every top-level function which is referenced before its definition (recursion or
+// calls to functions defined later). The slot holds a placeholder until the function statement stores the closure.
+func (c *Compiler) declareFunctions(statements []ast.Statement) {
+	functions := map[string]bool{}
+	for _, statement := range statements {
+		if function, ok := statement.(*ast.FunctionStatement); ok {
+			functions[function.Name.Value] = true
+		}
+	}
+
+	defined := map[string]bool{}
+	declared := map[string]bool{}
+
+	for _, statement := range statements {
+		function, ok := statement.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+
+		ast.Inspect(function.Body, func(node ast.Node) bool {
+			identifier, ok := node.(*ast.IdentifierExpression)
+			if !ok {
+				return true
+			}
+
+			name := identifier.Value.Value
+			if functions[name] && !defined[name] && !declared[name] {
+				declared[name] = true
+				c.e.PushBool(false)
+				c.store(name)
+			}
+			return true
+		})
+
+		defined[function.Name.Value] = true
+	}
+}
+
+// declareClasses reserves the constructor and method globals of every top-level class, methods and functions can
+// reference any of them before the class statement is compiled.
+func (c *Compiler) declareClasses(statements []ast.Statement) {
+	for _, statement := range statements {
+		class, ok := statement.(*ast.ClassStatement)
+		if !ok {
+			continue
+		}
+
+		classType := c.typeMap[class]
+
+		c.e.PushBool(false)
+		c.store(class.Name.Value)
+
+		for _, method := range class.Methods {
+			c.e.PushBool(false)
+			c.store(methodName(classType, method.Name.Value))
+		}
+	}
+}
 func (c *Compiler) Bytecode() emitter.ByteCode {
 	return c.e.Bytecode()
 }
@@ -85,6 +85,30 @@ func TestDivInt(t *testing.T) {
 	testCompiler(t, input, expected)
 }
 
+func TestModInt(t *testing.T) {
+	input := `7 % 3`
+
+	expected := []code.Instruction{
+		{OpCode: code.PUSH, Args: []int{0}},
+		{OpCode: code.PUSH, Args: []int{1}},
+		{OpCode: code.MOD_INT},
+	}
+
+	testCompiler(t, input, expected)
+}
+
+func TestPowInt(t *testing.T) {
+	input := `2 ^ 3`
+
+	expected := []code.Instruction{
+		{OpCode: code.PUSH, Args: []int{0}},
+		{OpCode: code.PUSH, Args: []int{1}},
+		{OpCode: code.POW_INT},
+	}
+
+	testCompiler(t, input, expected)
+}
+
 // --------------------------------------------
 // Float Arithmetic
 // --------------------------------------------
@@ -146,8 +170,10 @@ func TestBoolAnd(t *testing.T) {
 
 	expected := []code.Instruction{
 		{OpCode: code.PUSH, Args: []int{0}},
+		{OpCode: code.JUMP_FALSE, Args: []int{4}},
 		{OpCode: code.PUSH, Args: []int{1}},
-		{OpCode: code.AND_BOOL},
+		{OpCode: code.JUMP, Args: []int{5}},
+		{OpCode: code.PUSH, Args: []int{2}},
 	}
 
 	testCompiler(t, input, expected)
@@ -158,8 +184,10 @@ func TestBoolOr(t *testing.T) {
 
 	expected := []code.Instruction{
 		{OpCode: code.PUSH, Args: []int{0}},
+		{OpCode: code.JUMP_FALSE, Args: []int{4}},
 		{OpCode: code.PUSH, Args: []int{1}},
-		{OpCode: code.OR_BOOL},
+		{OpCode: code.JUMP, Args: []int{5}},
+		{OpCode: code.PUSH, Args: []int{2}},
 	}
 
 	testCompiler(t, input, expected)
@@ -421,6 +449,19 @@ func TestIfElseStatement(t *testing.T) {
 
 	testCompiler(t, input, expected)
 }
+func TestWhileStatement(t *testing.T) {
+	input := `while true then break continue end`
+
+	expected := []code.Instruction{
+		{OpCode: code.PUSH, Args: []int{0}},       // 00
+		{OpCode: code.JUMP_FALSE, Args: []int{5}}, // 01
+		{OpCode: code.JUMP, Args: []int{5}},       // 02 break
+		{OpCode: code.JUMP, Args: []int{0}},       // 03 continue
+		{OpCode: code.JUMP, Args: []int{0}},       // 04
+	}
+
+	testCompiler(t, input, expected)
+}
 func TestReturnStatementWithValue(t *testing.T) {
 
 	input := `return 1`
@@ -516,6 +557,72 @@ func TestAssignmentStatement(t *testing.T) {
 	testCompiler(t, input, expected)
 }
 
+func TestIndexAssignmentStatement(t *testing.T) {
+	input := `let a = [1] a[0] = 2`
+	expected := []code.Instruction{
+		{OpCode: code.PUSH, Args: []int{0}},
+		{OpCode: code.ARRAY, Args: []int{1}},
+		{OpCode: code.STORE_GLOBAL, Args: []int{0}},
+		{OpCode: code.LOAD_GLOBAL, Args: []int{0}},
+		{OpCode: code.PUSH, Args: []int{1}},
+		{OpCode: code.PUSH, Args: []int{2}},
+		{OpCode: code.STORE_INDEX},
+	}
+	testCompiler(t, input, expected)
+}
+
+func TestHashAssignmentStatement(t *testing.T) {
+	input := `let a = {"one": 1} a["two"] = 2`
+	expected := []code.Instruction{
+		{OpCode: code.PUSH, Args: []int{0}},
+		{OpCode: code.PUSH, Args: []int{1}},
+		{OpCode: code.HASH, Args: []int{1}},
+		{OpCode: code.STORE_GLOBAL, Args: []int{0}},
+		{OpCode: code.LOAD_GLOBAL, Args: []int{0}},
+		{OpCode: code.PUSH, Args: []int{2}},
+		{OpCode: code.PUSH, Args: []int{3}},
+		{OpCode: code.STORE_ACCESS},
+	}
+	testCompiler(t, input, expected)
+}
+
+func TestCompoundAssignmentStatement(t *testing.T) {
+	input := `let a = 1.5 a += 2`
+	expected := []code.Instruction{
+		{OpCode: code.PUSH, Args: []int{0}},
+		{OpCode: code.STORE_GLOBAL, Args: []int{0}},
+		{OpCode: code.LOAD_GLOBAL, Args: []int{0}},
+		{OpCode: code.PUSH, Args: []int{1}},
+		{OpCode: code.TO_FLOAT},
+		{OpCode: code.ADD_FLOAT},
+		{OpCode: code.STORE_GLOBAL, Args: []int{0}},
+	}
+	testCompiler(t, input, expected)
+}
+
+func TestCompoundIndexAssignmentStatement(t *testing.T) {
+	input := `let a = [1] a[0] += 1`
+	expected := []code.Instruction{
+		{OpCode: code.PUSH, Args: []int{0}},
+		{OpCode: code.ARRAY, Args: []int{1}},
+		{OpCode: code.STORE_GLOBAL, Args: []int{0}},
+		// Caller and index are evaluated once into temporaries.
+		{OpCode: code.LOAD_GLOBAL, Args: []int{0}},
+		{OpCode: code.STORE_GLOBAL, Args: []int{1}},
+		{OpCode: code.PUSH, Args: []int{1}},
+		{OpCode: code.STORE_GLOBAL, Args: []int{2}},
+		{OpCode: code.LOAD_GLOBAL, Args: []int{1}},
+		{OpCode: code.LOAD_GLOBAL, Args: []int{2}},
+		{OpCode: code.LOAD_GLOBAL, Args: []int{1}},
+		{OpCode: code.LOAD_GLOBAL, Args: []int{2}},
+		{OpCode: code.INDEX},
+		{OpCode: code.PUSH, Args: []int{2}},
+		{OpCode: code.ADD_INT},
+		{OpCode: code.STORE_INDEX},
+	}
+	testCompiler(t, input, expected)
+}
+
 // Test prefix expressions
 
 func TestPrefixExpressions(t *testing.T) {
@@ -593,7 +700,9 @@ func TestClassEmpty(t *testing.T) {
 
 	expected := []code.Instruction{
 		{OpCode: code.PUSH, Args: []int{0}},
-		{OpCode: code.CLASS},
+		{OpCode: code.STORE_GLOBAL, Args: []int{0}},
+		{OpCode: code.CLOSURE, Args: []int{1, 0}},
+		{OpCode: code.STORE_GLOBAL, Args: []int{0}},
 	}
 
 	testCompiler(t, input, expected)
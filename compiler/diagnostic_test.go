@@ -15,13 +15,13 @@ func TestCompilerDiagnosticForUnsupportedOperator(t *testing.T) {
 	_ = os.Setenv("NO_COLOR", "1")
 	defer os.Unsetenv("NO_COLOR")
 
-	source := "1 % 2"
+	source := "1 ... 2"
 	node := &ast.BinaryExpression{
 		Left:  &ast.IntegerExpression{Value: "1"},
 		Right: &ast.IntegerExpression{Value: "2"},
 		Operator: &token.Token{
-			Type:   token.MODULUS,
-			Value:  "%",
+			Type:   token.ELLIPSIS,
+			Value:  "...",
 			Offset: 2,
 			Line:   1,
 			Column: 3,
@@ -35,7 +35,7 @@ func TestCompilerDiagnosticForUnsupportedOperator(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected compiler error, got nil")
 	}
-	if err.Error() != "Cannot compile binary operator MODULUS." {
+	if err.Error() != "Cannot compile binary operator ELLIPSIS." {
 		t.Fatalf("unexpected compiler message: %q", err.Error())
 	}
 
@@ -43,7 +43,7 @@ func TestCompilerDiagnosticForUnsupportedOperator(t *testing.T) {
 	if !strings.Contains(rendered, "--> compile.tm:1:3") {
 		t.Fatalf("expected compiler location in diagnostic, got: %s", rendered)
 	}
-	if !strings.Contains(rendered, "1 | 1 % 2") {
+	if !strings.Contains(rendered, "1 | 1 ... 2") {
 		t.Fatalf("expected compiler source line in diagnostic, got: %s", rendered)
 	}
 }
@@ -0,0 +1,51 @@
+package compiler
+
+import (
+	"slices"
+	"strings"
+)
+
+func (c *Compiler) store(name string) {
+	c.e.Store(name)
+	c.declareGlobal(name)()
+}
+
+// declareGlobal records a name stored at the top level, the returned func adds it. Function statements store their
+// closure once the body is compiled, so the level is checked before.
+func (c *Compiler) declareGlobal(name string) func() {
+	if c.lines != c.mainLines || strings.HasPrefix(name, "$") || c.stored[name] {
+		return func() {}
+	}
+	return func() {
+		c.stored[name] = true
+		c.globals = append(c.globals, name)
+	}
+}
+
+// Globals returns the names the top level has stored to so far, temporaries left out.
+func (c *Compiler) Globals() []string {
+	return slices.Clone(c.globals)
+}
+
+// RestoreGlobals emits code storing into every name the value the builtin restore returns for it, restore is called
+// with the name. The REPL uses it to carry values over from an earlier run.
+func (c *Compiler) RestoreGlobals(names []string, restore string) {
+	for _, name := range names {
+		c.e.PushString(name)
+		c.e.Load(restore)
+		c.e.Call(1)
+		c.store(name)
+	}
+}
+
+// SaveGlobals emits code passing the name and the value of every global to the builtin save, the stack is left as it
+// was.
+func (c *Compiler) SaveGlobals(save string) {
+	for _, name := range c.globals {
+		c.e.PushString(name)
+		c.e.Load(name)
+		c.e.Load(save)
+		c.e.Call(2)
+		c.e.Pop()
+	}
+}
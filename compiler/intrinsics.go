@@ -0,0 +1,175 @@
+package compiler
+
+import (
+	"github.com/pspiagicw/tremor/ast"
+)
+
+// compileIntrinsic lowers a call to a builtin taking a function into a loop over the array, a builtin cannot call back
+// into the VM. It reports false for any other builtin.
+func (c *Compiler) compileIntrinsic(name string, args []ast.Expression) (bool, error) {
+	switch name {
+	case "map":
+		return true, c.compileMap(args)
+	case "filter":
+		return true, c.compileFilter(args)
+	case "reduce":
+		return true, c.compileReduce(args)
+	case "sort_by":
+		return true, c.compileSortBy(args)
+	default:
+		return false, nil
+	}
+}
+
+// map(array, f) appends f(element) to a new array.
+func (c *Compiler) compileMap(args []ast.Expression) error {
+	array, f, err := c.storeArguments(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	c.mapElements(array, f)
+	return nil
+}
+
+// mapElements leaves the results of f on the stack as an array.
+func (c *Compiler) mapElements(array string, f string) {
+	result := c.temporary()
+	c.e.Array(0)
+	c.store(result)
+
+	c.eachElement(array, func(element func()) {
+		c.e.Load(result)
+		c.callElement(f, 1, element)
+		c.e.Load("__append")
+		c.e.Call(2)
+		c.store(result)
+	})
+
+	c.e.Load(result)
+}
+
+// filter(array, f) appends the elements f returns true for to a new array.
+func (c *Compiler) compileFilter(args []ast.Expression) error {
+	array, f, err := c.storeArguments(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	result := c.temporary()
+	c.e.Array(0)
+	c.store(result)
+
+	c.eachElement(array, func(element func()) {
+		current := c.temporary()
+		element()
+		c.store(current)
+
+		c.callElement(f, 1, func() { c.e.Load(current) })
+		skip := c.e.JumpFalse(0)
+
+		c.e.Load(result)
+		c.e.Load(current)
+		c.e.Load("__append")
+		c.e.Call(2)
+		c.store(result)
+
+		c.e.PatchJump(skip, c.e.Position())
+	})
+
+	c.e.Load(result)
+	return nil
+}
+
+// reduce(array, f, initial) keeps f(accumulator, element) in the accumulator.
+func (c *Compiler) compileReduce(args []ast.Expression) error {
+	array, f, err := c.storeArguments(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	err = c.Compile(args[2])
+	if err != nil {
+		return err
+	}
+	accumulator := c.temporary()
+	c.store(accumulator)
+
+	c.eachElement(array, func(element func()) {
+		c.callElement(f, 2, func() {
+			c.e.Load(accumulator)
+			element()
+		})
+		c.store(accumulator)
+	})
+
+	c.e.Load(accumulator)
+	return nil
+}
+
+// sort_by(array, key) maps the array to its keys and sorts both together.
+func (c *Compiler) compileSortBy(args []ast.Expression) error {
+	array, key, err := c.storeArguments(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	c.e.Load(array)
+	c.mapElements(array, key)
+	c.e.Load("__sort_by")
+	c.e.Call(2)
+	return nil
+}
+
+// storeArguments evaluates the array and the function of an intrinsic into temporaries, in the order they were given.
+func (c *Compiler) storeArguments(array ast.Expression, f ast.Expression) (string, string, error) {
+	names := []string{}
+	for _, arg := range []ast.Expression{array, f} {
+		err := c.Compile(arg)
+		if err != nil {
+			return "", "", err
+		}
+
+		name := c.temporary()
+		c.store(name)
+		names = append(names, name)
+	}
+	return names[0], names[1], nil
+}
+
+// callElement calls f with the count arguments pushed by args, the result is left on the stack.
+func (c *Compiler) callElement(f string, count int, args func()) {
+	c.guardCall(func() error {
+		args()
+		c.e.Load(f)
+		c.e.Call(count)
+		return nil
+	})
+}
+
+// eachElement emits a loop running body for every element of array, element pushes the current one.
+func (c *Compiler) eachElement(array string, body func(element func())) {
+	counter, limit := c.lengthCounter(array)
+
+	start := c.e.Position()
+	c.guardStep()
+
+	c.e.Load(counter)
+	c.e.Load(limit)
+	c.e.LtInt()
+	exit := c.e.JumpFalse(0)
+
+	body(func() {
+		c.e.Load(array)
+		c.e.Load(counter)
+		c.e.Index()
+	})
+
+	c.e.Load(counter)
+	c.e.PushInt(1)
+	c.e.AddInt()
+	c.store(counter)
+
+	c.e.Jump(start)
+	c.e.PatchJump(exit, c.e.Position())
+}
@@ -0,0 +1,76 @@
+package compiler
+
+import (
+	"github.com/pspiagicw/tremor/ast"
+	"github.com/pspiagicw/tremor/lines"
+	"github.com/pspiagicw/tremor/token"
+)
+
+// lineRecorder builds the line table of the tape being emitted.
+type lineRecorder struct {
+	lines lines.Lines
+	// Tokens of the nodes enclosing the one being compiled, innermost last.
+	tokens []*token.Token
+}
+
+// enter marks the instructions emitted from offset onwards as coming from tok.
+func (r *lineRecorder) enter(offset int, tok *token.Token) {
+	r.tokens = append(r.tokens, tok)
+	r.mark(offset, tok)
+}
+
+// exit goes back to the enclosing node, the instructions emitted after a child belong to its parent.
+func (r *lineRecorder) exit(offset int) {
+	r.tokens = r.tokens[:len(r.tokens)-1]
+	if len(r.tokens) != 0 {
+		r.mark(offset, r.tokens[len(r.tokens)-1])
+	}
+}
+func (r *lineRecorder) mark(offset int, tok *token.Token) {
+	width := len(tok.Value)
+	if width < 1 {
+		width = 1
+	}
+	line := lines.Line{Offset: offset, Line: tok.Line, Column: tok.Column, Width: width}
+
+	// Nothing was emitted for the previous entry, the innermost node at an offset wins.
+	if n := len(r.lines); n != 0 && r.lines[n-1].Offset == offset {
+		r.lines[n-1] = line
+		return
+	}
+
+	r.lines = append(r.lines, line)
+}
+
+// trackLines records the position of node for the instructions it compiles to, the returned func ends it.
+func (c *Compiler) trackLines(node ast.Node) func() {
+	tok := ast.NodeToken(node)
+	if tok == nil || tok.Line < 1 {
+		return func() {}
+	}
+
+	c.lines.enter(c.e.Position(), tok)
+	return func() {
+		c.lines.exit(c.e.Position())
+	}
+}
+
+// enterFunction starts the line table of a function body, the returned func finishes it. fenc adds a compiled function
+// to the constants once its body is emitted, so the finished tables are in the same order as the functions.
+func (c *Compiler) enterFunction() func() {
+	outer := c.lines
+	c.lines = &lineRecorder{}
+
+	return func() {
+		c.functionLines = append(c.functionLines, c.lines.lines)
+		c.lines = outer
+	}
+}
+
+// LineTable returns the line table of everything compiled so far.
+func (c *Compiler) LineTable() *lines.Table {
+	return &lines.Table{
+		Main:      c.mainLines.lines,
+		Functions: c.functionLines,
+	}
+}
@@ -0,0 +1,94 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/pspiagicw/fenc/code"
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/pspiagicw/tremor/lines"
+	"github.com/pspiagicw/tremor/parser"
+	"github.com/pspiagicw/tremor/typechecker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineTableTopLevel(t *testing.T) {
+	input := "let a = 1\nlet b = a + 2\nlet c = [a, b]"
+
+	cmp := compileProgram(t, input)
+	bytecode := cmp.Bytecode()
+	table := cmp.LineTable()
+
+	// The ADD_INT comes from the + on the second line.
+	offset := findOp(bytecode.Tape, code.ADD_INT)
+	line, ok := table.Main.Find(offset)
+	assert.True(t, ok)
+	assert.Equal(t, lines.Line{Offset: line.Offset, Line: 2, Column: 11, Width: 1}, line)
+
+	// Building the array belongs to the let on the third line.
+	offset = findOp(bytecode.Tape, code.ARRAY)
+	line, _ = table.Main.Find(offset)
+	assert.Equal(t, 3, line.Line)
+}
+
+func TestLineTableFunctions(t *testing.T) {
+	input := `fn first() int then
+    return 1
+end
+fn second() int then
+    let a = 2
+    return a * 3
+end`
+
+	cmp := compileProgram(t, input)
+	bytecode := cmp.Bytecode()
+	table := cmp.LineTable()
+
+	functions := []*object.CompiledFunction{}
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			functions = append(functions, fn)
+		}
+	}
+
+	assert.Len(t, table.Functions, len(functions))
+	assert.Equal(t, "second", functions[1].Name)
+
+	offset := findOp(functions[1].Instructions, code.MUL_INT)
+	line, ok := table.Functions[1].Find(offset)
+	assert.True(t, ok)
+	assert.Equal(t, 6, line.Line)
+	assert.Equal(t, 14, line.Column)
+}
+
+func findOp(tape []code.Instruction, op code.Op) int {
+	for i, ins := range tape {
+		if ins.OpCode == op {
+			return i
+		}
+	}
+	return -1
+}
+
+func compileProgram(t *testing.T, input string) *Compiler {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	tc := typechecker.NewTypeChecker()
+
+	ast := p.ParseAST()
+	assert.Empty(t, p.Errors(), "Parser has errors!")
+
+	scope := typechecker.NewScope()
+	scope.SetupBuiltinFunctions()
+
+	_ = tc.TypeCheck(ast, scope)
+	if !assert.Empty(t, tc.Errors(), "Type Checker has errors!") {
+		t.FailNow()
+	}
+
+	cmp := NewCompiler(tc.Map())
+	err := cmp.Compile(ast)
+	assert.Nil(t, err, "Compiler has a error!")
+
+	return cmp
+}
@@ -0,0 +1,562 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/fenc/vm"
+	"github.com/pspiagicw/tremor/builtins"
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/pspiagicw/tremor/parser"
+	"github.com/pspiagicw/tremor/typechecker"
+	"github.com/pspiagicw/tremor/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhileLoopRun(t *testing.T) {
+	input := `
+        let i = 0
+        let sum = 0
+        while i < 10 then
+            i = i + 1
+            if i == 3 then
+                continue
+            end
+            if i == 6 then
+                break
+            end
+            sum = sum + i
+        end
+        sum
+    `
+
+	testRun(t, input, "12")
+}
+
+func TestNestedWhileLoopRun(t *testing.T) {
+	input := `
+        let count = 0
+        let i = 0
+        while i < 3 then
+            let j = 0
+            while true then
+                if j == 2 then
+                    break
+                end
+                j = j + 1
+                count = count + 1
+            end
+            i = i + 1
+        end
+        count
+    `
+
+	testRun(t, input, "6")
+}
+
+func TestForArrayRun(t *testing.T) {
+	input := `
+        let total = 0
+        for i, x in [10, 20, 30] then
+            total = total + i * x
+        end
+        total
+    `
+
+	testRun(t, input, "80")
+}
+
+func TestForHashRun(t *testing.T) {
+	input := `
+        let joined = ""
+        for k, v in {"b": "2", "a": "1"} then
+            joined = joined .. k .. v
+        end
+        joined
+    `
+
+	testRun(t, input, `"a1b2"`)
+}
+
+func TestForRangeRun(t *testing.T) {
+	input := `
+        let total = 0
+        for i in 0..10 then
+            if i == 3 then
+                continue
+            end
+            total = total + i
+        end
+        total
+    `
+
+	testRun(t, input, "42")
+}
+
+func TestForVariableShadowsRun(t *testing.T) {
+	input := `
+        let x = 5
+        let seen = ""
+        for x in ["a", "b"] then
+            for x in 0..2 then
+                seen = seen .. str(x)
+            end
+            seen = seen .. x
+        end
+        seen .. str(x)
+    `
+
+	testRun(t, input, `"01a01b5"`)
+}
+
+func TestParameterShadowsLoopVariableRun(t *testing.T) {
+	input := `
+        let seen = ""
+        for x in [100] then
+            let f = fn(x int) int then return x * 7 end
+            let g = fn() int then return x + 1 end
+            fn h(x int) int then
+                return x
+            end
+            seen = str(f(1)) .. " " .. str(g()) .. " " .. str(h(2))
+        end
+        seen
+    `
+
+	testRun(t, input, `"7 101 2"`)
+}
+
+func TestRecursionRun(t *testing.T) {
+	input := `
+        fn pow(x int, n int) int then
+            if n == 0 then
+                return 1
+            end
+            return x * pow(x, n - 1)
+        end
+        pow(2, 8)
+    `
+
+	testRun(t, input, "256")
+}
+
+func TestFibonacciRun(t *testing.T) {
+	input := `
+        fn fib(n int) int then
+            if n < 2 then
+                return n
+            end
+            return fib(n - 1) + fib(n - 2)
+        end
+        fib(15)
+    `
+
+	testRun(t, input, "610")
+}
+
+func TestMutualRecursionRun(t *testing.T) {
+	input := `
+        fn even(n int) bool then
+            if n == 0 then
+                return true
+            end
+            return odd(n - 1)
+        end
+        fn odd(n int) bool then
+            if n == 0 then
+                return false
+            end
+            return even(n - 1)
+        end
+        even(7)
+    `
+
+	testRun(t, input, "false")
+}
+
+func TestModulusRun(t *testing.T) {
+	input := `17 % 5`
+
+	testRun(t, input, "2")
+}
+
+func TestExponentRun(t *testing.T) {
+	input := `2 ^ 3 ^ 2`
+
+	testRun(t, input, "512")
+}
+
+func TestDivisionByZeroRun(t *testing.T) {
+	input := `
+        let zero = 0
+        10 / zero
+    `
+
+	testRunError(t, input, "Division by zero.")
+}
+
+func TestModulusByZeroRun(t *testing.T) {
+	input := `
+        let zero = 0
+        10 % zero
+    `
+
+	testRunError(t, input, "Division by zero.")
+}
+
+func TestExponentVariableRun(t *testing.T) {
+	input := `
+        let n = 3
+        2 ^ n + 2 ^ 0
+    `
+
+	testRun(t, input, "9")
+}
+
+func TestNegativeExponentRun(t *testing.T) {
+	input := `2 ^ -1`
+
+	testRunError(t, input, "Negative exponent -1 on an int, use a float base instead.")
+}
+
+func TestShortCircuitAndRun(t *testing.T) {
+	calls := withCounter(t)
+
+	input := `false and touch()`
+
+	testRun(t, input, "false")
+	assert.Equal(t, 0, *calls, "Right operand of and was evaluated!")
+}
+
+func TestShortCircuitOrRun(t *testing.T) {
+	calls := withCounter(t)
+
+	input := `true or touch()`
+
+	testRun(t, input, "true")
+	assert.Equal(t, 0, *calls, "Right operand of or was evaluated!")
+}
+
+func TestLogicalEvaluatesRightRun(t *testing.T) {
+	calls := withCounter(t)
+
+	input := `
+        let a = true and touch()
+        let b = false or touch()
+        a and b
+    `
+
+	testRun(t, input, "true")
+	assert.Equal(t, 2, *calls, "Right operands were not evaluated!")
+}
+
+func TestShortCircuitGuardRun(t *testing.T) {
+	input := `
+        let x = 0
+        x != 0 and 10 / x > 1
+    `
+
+	testRun(t, input, "false")
+}
+
+const pointClass = `
+    class Point
+        x int
+        y int
+
+        fn norm() int then
+            return self.x * self.x + self.y * self.y
+        end
+
+        fn shift(dx int) then
+            self.x += dx
+        end
+
+        fn mirror() Point then
+            return Point(self.y, self.x)
+        end
+    end
+`
+
+func TestClassFieldRun(t *testing.T) {
+	input := pointClass + `
+        let p = Point(3, 4)
+        p.y = p.y * 10
+        p.y
+    `
+
+	testRun(t, input, "40")
+}
+
+func TestClassMethodRun(t *testing.T) {
+	input := pointClass + `
+        let p = Point(3, 4)
+        p.norm()
+    `
+
+	testRun(t, input, "25")
+}
+
+func TestClassMethodMutatesSelfRun(t *testing.T) {
+	input := pointClass + `
+        let p = Point(1, 2)
+        p.shift(5)
+        p.shift(1)
+        p.x
+    `
+
+	testRun(t, input, "7")
+}
+
+func TestClassMethodChainRun(t *testing.T) {
+	input := pointClass + `
+        let p = Point(1, 2)
+        p.mirror().x
+    `
+
+	testRun(t, input, "2")
+}
+
+func TestClassInstanceStrRun(t *testing.T) {
+	input := pointClass + `
+        let p = Point(3, 4)
+        print(p)
+        str(p)
+    `
+
+	testRun(t, input, `"{\"x\": 3, \"y\": 4}"`)
+}
+
+func TestClassInitRun(t *testing.T) {
+	input := `
+        class Counter
+            count int
+            step int
+
+            fn init(step int) then
+                self.step = step
+            end
+
+            fn tick() int then
+                self.count += self.step
+                return self.count
+            end
+        end
+
+        let c = Counter(3)
+        c.tick()
+        c.tick()
+    `
+
+	testRun(t, input, "6")
+}
+
+func TestClassFromFunctionRun(t *testing.T) {
+	input := `
+        fn origin() Point then
+            return Point(0, 0)
+        end
+    ` + pointClass + `
+        let p = origin()
+        p.shift(2)
+        p.norm()
+    `
+
+	testRun(t, input, "4")
+}
+
+func TestMissingHashKeyRun(t *testing.T) {
+	input := `
+        let ages = {"alice": 30}
+        let age = ages["bob"]
+        age == nil
+    `
+
+	testRun(t, input, "true")
+}
+
+func TestCompoundHashAssignmentRun(t *testing.T) {
+	testRun(t, `let h = {"a": 1} h["a"] += 2 h`, `{"a": 3}`)
+}
+
+func TestCompoundAssignmentToMissingHashKeyRun(t *testing.T) {
+	testRunError(t, `let h = {"a": 1} h["b"] += 1`, `Key "b" is not in the hash.`)
+}
+
+func TestOptionalNarrowingRun(t *testing.T) {
+	input := `
+        fn orZero(a ?int) int then
+            if a == nil then
+                return 0
+            end
+            return a
+        end
+        let ages = {"alice": 30}
+        orZero(ages["alice"]) + orZero(ages["bob"])
+    `
+
+	testRun(t, input, "30")
+}
+
+func TestOptionalNarrowingAndRun(t *testing.T) {
+	input := pointClass + `
+        fn xOf(p ?Point) int then
+            if p != nil and p.x > 0 then
+                return p.x
+            end
+            return -1
+        end
+        xOf(Point(3, 4)) * 10 + xOf(nil)
+    `
+
+	testRun(t, input, "29")
+}
+
+func TestLeftOutArgumentsRun(t *testing.T) {
+	testRun(t, `slice([1, 2, 3], 1)`, "[2, 3]")
+	testRun(t, `slice([1, 2, 3], 1, nil)`, "[2, 3]")
+}
+
+func TestOptionalFieldRun(t *testing.T) {
+	input := `
+        class Node
+            value int
+            next ?Node
+
+            fn init(value int) then
+                self.value = value
+            end
+        end
+
+        let head = Node(1)
+        head.next = Node(2)
+
+        let sum = 0
+        let current ?Node = head
+        while current != nil then
+            sum += current.value
+            current = current.next
+        end
+        sum
+    `
+
+	testRun(t, input, "3")
+}
+
+// withCounter registers a `touch()` builtin for the duration of the test, it returns true and counts its calls.
+func withCounter(t *testing.T) *int {
+	calls := 0
+	original := builtins.Builtins
+
+	builtins.Builtins = append(builtins.Builtins[:len(original):len(original)], builtins.BuiltinDefinition{
+		Name:       "touch",
+		InputType:  []*types.Type{},
+		OutputType: types.BoolType,
+		Impl: func(args ...object.Object) object.Object {
+			calls++
+			return object.CreateBool(true)
+		},
+	})
+	t.Cleanup(func() {
+		builtins.Builtins = original
+	})
+
+	return &calls
+}
+
+func TestNumberLiteralsRun(t *testing.T) {
+	testRun(t, "0xFF + 0o10 + 0b11 + 1_000", "1266")
+	testRun(t, "2.5e2 + 1e-1", "250.1")
+}
+
+func TestStringEscapesRun(t *testing.T) {
+	input := `len("a\tb\n\u{e9}")`
+
+	// é takes two bytes.
+	testRun(t, input, "6")
+}
+
+func TestInterpolationRun(t *testing.T) {
+	input := `
+        let n = 2
+        let name = "tremor"
+        let message = "${name} has ${n + 1} parts: ${[1, 2]}, \${kept}"
+        message == "tremor has 3 parts: [1, 2], \${kept}"
+    `
+
+	testRun(t, input, "true")
+}
+
+func TestArrayBuiltinsRun(t *testing.T) {
+	// The array given to push is left as it was.
+	testRun(t, `let xs = [1, 2] let ys = push(xs, 3) len(xs) * 10 + len(ys)`, "23")
+	testRun(t, `pop([1, 2, 3])`, "[1, 2]")
+	testRun(t, `slice([1, 2, 3, 4], 1, 3)`, "[2, 3]")
+	testRun(t, `slice([1, 2, 3, 4], 2)`, "[3, 4]")
+	testRun(t, `sort(["b", "c", "a"])`, `["a", "b", "c"]`)
+}
+
+func TestArrayBuiltinsRunError(t *testing.T) {
+	testRunError(t, `let xs = pop([1]) pop(xs)`, "Cannot pop from an empty array.")
+	testRunError(t, `slice([1, 2], 1, 3)`, "Slice [1:3] is out of range for an array of 2 elements.")
+}
+
+func TestHigherOrderArrayBuiltinsRun(t *testing.T) {
+	testRun(t, `map([1, 2, 3], fn(x int) int then return x * x end)`, "[1, 4, 9]")
+	testRun(t, `filter([1, 2, 3, 4], fn(x int) bool then return x % 2 == 0 end)`, "[2, 4]")
+	testRun(t, `reduce([1, 2, 3], fn(total int, x int) int then return total + x end, 10)`, "16")
+	testRun(t, `sort_by(["ccc", "a", "bb", "d"], fn(s string) int then return len(s) end)`, `["a", "d", "bb", "ccc"]`)
+	testRun(t, `map(pop([1]), fn(x int) int then return x end)`, "[]")
+}
+
+func TestHigherOrderBuiltinsInsideFunctionsRun(t *testing.T) {
+	input := `
+        fn scale(xs []int, by int) []int then
+            return map(xs, fn(x int) int then return x * by end)
+        end
+        let nested = map([1, 2], fn(x int) []int then return scale([x, x], 10) end)
+        reduce(nested, fn(total int, xs []int) int then return total + xs[0] + xs[1] end, 0)
+    `
+
+	testRun(t, input, "60")
+}
+
+func testRun(t *testing.T, input string, expected string) {
+	machine, err := runProgram(t, input)
+	assert.NoError(t, err, "VM has a error!")
+
+	assert.Equal(t, expected, machine.Peek().String(), "Result differs!")
+}
+
+func testRunError(t *testing.T, input string, expected string) {
+	_, err := runProgram(t, input)
+	if assert.Error(t, err, "VM should fail!") {
+		assert.Equal(t, expected, err.Error(), "Error differs!")
+	}
+}
+
+func runProgram(t *testing.T, input string) (*vm.VM, error) {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	tc := typechecker.NewTypeChecker()
+
+	ast := p.ParseAST()
+
+	assert.Empty(t, p.Errors(), "Parser has errors!")
+
+	scope := typechecker.NewScope()
+	scope.SetupBuiltinFunctions()
+
+	_ = tc.TypeCheck(ast, scope)
+	result := assert.Empty(t, tc.Errors(), "Type Checker has errors!")
+	if result == false {
+		t.FailNow()
+	}
+
+	cmp := NewCompiler(tc.Map())
+	err := cmp.Compile(ast)
+	assert.Nil(t, err, "Compiler has a error!")
+
+	machine := vm.NewVM(cmp.Bytecode(), builtins.GetBuiltins())
+	return machine, machine.Run()
+}
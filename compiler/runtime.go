@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pspiagicw/fenc/emitter"
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/fenc/vm"
+	"github.com/pspiagicw/tremor/diagnostic"
+	"github.com/pspiagicw/tremor/lines"
+	"github.com/pspiagicw/tremor/token"
+)
+
+// RuntimeError turns a failure of the VM running bytecode into a diagnostic pointing at the tremor code which was
+// running, the call stack is listed below it with the innermost call first. table can be nil, source can be empty.
+func RuntimeError(err error, bytecode emitter.ByteCode, table *lines.Table, file string, source string) *diagnostic.Diagnostic {
+	d := diagnostic.New("runtime", file, source, "%s", err.Error())
+
+	var failure *vm.RuntimeError
+	if !errors.As(err, &failure) || table == nil {
+		return d
+	}
+
+	functions := functionIndices(bytecode)
+	stack := stackNotes{}
+
+	for i, frame := range failure.Frames {
+		name := "<main>"
+		entries := table.Main
+
+		if frame.Function != nil {
+			name = frame.Function.Name
+			entries = nil
+			if index, ok := functions[frame.Function]; ok && index < len(table.Functions) {
+				entries = table.Functions[index]
+			}
+		}
+
+		line, ok := entries.Find(frame.Offset)
+		if !ok {
+			stack.add(name, fmt.Sprintf("in %s", name))
+			continue
+		}
+
+		if i == 0 {
+			d.Span = diagnostic.SpanFromToken(&token.Token{Line: line.Line, Column: line.Column}, line.Width)
+		}
+
+		stack.add(name, fmt.Sprintf("in %s at %s:%d:%d", name, file, line.Line, line.Column))
+	}
+
+	d.Notes = stack.finish()
+	return d
+}
+
+// functionIndices numbers the compiled functions among the constants, the line table of a function has the same index.
+func functionIndices(bytecode emitter.ByteCode) map[*object.CompiledFunction]int {
+	indices := map[*object.CompiledFunction]int{}
+
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			indices[fn] = len(indices)
+		}
+	}
+
+	return indices
+}
+
+// Frames listed below a runtime error at most, deep recursion would otherwise print thousands of lines.
+const maxStackNotes = 20
+
+// stackNotes lists the frames of a call stack, a frame repeating the one before it is counted instead of listed.
+type stackNotes struct {
+	notes []string
+	// Frames left out once the list is full.
+	skipped int
+	// The frame repeated, and how many times.
+	last     string
+	lastName string
+	repeats  int
+}
+
+func (s *stackNotes) add(name string, note string) {
+	if note == s.last {
+		s.repeats++
+		return
+	}
+	s.flush()
+	s.last, s.lastName = note, name
+	s.push(note, 1)
+}
+func (s *stackNotes) flush() {
+	if s.repeats != 0 {
+		s.push(fmt.Sprintf("... %d more frames of %s", s.repeats, s.lastName), s.repeats)
+	}
+	s.repeats = 0
+}
+
+// push lists a note standing for frames frames, or counts them once the list is full.
+func (s *stackNotes) push(note string, frames int) {
+	if len(s.notes) == maxStackNotes {
+		s.skipped += frames
+		return
+	}
+	s.notes = append(s.notes, note)
+}
+func (s *stackNotes) finish() []string {
+	s.flush()
+	if s.skipped != 0 {
+		s.notes = append(s.notes, fmt.Sprintf("... %d more frames", s.skipped))
+	}
+	return s.notes
+}
@@ -0,0 +1,55 @@
+package compiler
+
+// SetSandboxed makes the compiled code call the guards of a builtins.Sandbox, which count loop iterations and calls and
+// check the size of the strings and hashes it builds. The builtins given to the compiler must have the guards in them.
+func (c *Compiler) SetSandboxed(sandboxed bool) {
+	c.sandboxed = sandboxed
+}
+
+// guardStep counts an iteration at the start of a loop, continue jumps there as well.
+func (c *Compiler) guardStep() {
+	if !c.sandboxed {
+		return
+	}
+	c.e.Load("__step")
+	c.e.Call(0)
+	c.e.Pop()
+}
+
+// guardCall wraps the call emitted by call, which leaves the result on the stack.
+func (c *Compiler) guardCall(call func() error) error {
+	if !c.sandboxed {
+		return call()
+	}
+
+	c.e.Load("__enter")
+	c.e.Call(0)
+	c.e.Pop()
+
+	err := call()
+	if err != nil {
+		return err
+	}
+
+	c.e.Load("__leave")
+	c.e.Call(1)
+	return nil
+}
+func (c *Compiler) addString() {
+	c.e.AddString()
+	if c.sandboxed {
+		c.e.Load("__size")
+		c.e.Call(1)
+	}
+}
+
+// storeAccess stores into a hash, a sandbox has to see every new key.
+func (c *Compiler) storeAccess() {
+	if !c.sandboxed {
+		c.e.StoreAccess()
+		return
+	}
+	c.e.Load("__store")
+	c.e.Call(3)
+	c.e.Pop()
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -25,6 +26,8 @@ type Diagnostic struct {
 	File    string
 	Source  string
 	Span    *Span
+	// Extra lines shown below the source, like the call stack of a runtime error.
+	Notes []string
 }
 
 func New(stage string, file string, source string, format string, args ...any) *Diagnostic {
@@ -92,15 +95,20 @@ func (d *Diagnostic) Pretty() string {
 		return headerLabel
 	}
 
-	if d.Span == nil || d.Source == "" {
-		return fmt.Sprintf("%s: %s", headerLabel, d.Message)
-	}
-
 	file := d.File
 	if file == "" {
 		file = "<input>"
 	}
 
+	if d.Span == nil {
+		return fmt.Sprintf("%s: %s", headerLabel, d.Message) + d.notes()
+	}
+
+	// Without the source there is nothing to underline, the location is still useful.
+	if d.Source == "" {
+		return fmt.Sprintf("%s: %s\n --> %s:%d:%d", headerLabel, d.Message, file, d.Span.StartLine, d.Span.StartColumn) + d.notes()
+	}
+
 	lineNo := d.Span.StartLine
 	col := d.Span.StartColumn
 	if lineNo < 1 {
@@ -135,6 +143,14 @@ func (d *Diagnostic) Pretty() string {
 	fmt.Fprintf(&b, "%*s %s\n", gutterWidth, "", separator)
 	fmt.Fprintf(&b, "%*d %s %s\n", gutterWidth, lineNo, separator, sourceLine)
 	fmt.Fprintf(&b, "%*s %s %s%s", gutterWidth, "", separator, strings.Repeat(" ", col-1), underline)
+	return b.String() + d.notes()
+}
+
+func (d *Diagnostic) notes() string {
+	var b strings.Builder
+	for _, note := range d.Notes {
+		fmt.Fprintf(&b, "\n  = %s", note)
+	}
 	return b.String()
 }
 
@@ -148,6 +164,28 @@ func Render(err error) string {
 	return err.Error()
 }
 
+// Sort orders diagnostics by where they start in the source. Errors without a location keep their order after the
+// located ones.
+func Sort[E error](errs []E) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := spanOf(errs[i]), spanOf(errs[j])
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		if a.StartLine != b.StartLine {
+			return a.StartLine < b.StartLine
+		}
+		return a.StartColumn < b.StartColumn
+	})
+}
+
+func spanOf(err error) *Span {
+	if d, ok := err.(*Diagnostic); ok {
+		return d.Span
+	}
+	return nil
+}
+
 func getLine(source string, line int) string {
 	if line < 1 {
 		return ""
@@ -179,7 +217,27 @@ const (
 
 var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
 
+// colorMode is set from the command line, "auto" leaves the decision to the environment.
+var colorMode = "auto"
+
+// SetColorMode chooses whether diagnostics are colored, mode is one of auto, always or never.
+func SetColorMode(mode string) error {
+	switch mode {
+	case "auto", "always", "never":
+		colorMode = mode
+		return nil
+	}
+	return fmt.Errorf("Invalid color mode %q, expected auto, always or never.", mode)
+}
+
 func colorEnabled() bool {
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
 	if os.Getenv("NO_COLOR") != "" {
 		return false
 	}
@@ -196,7 +254,13 @@ func colorEnabled() bool {
 		return false
 	}
 
-	return true
+	// Diagnostics are written to stderr, piping them into a file or another program drops the color.
+	info, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
 func style(input string, codes ...string) string {
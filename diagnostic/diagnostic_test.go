@@ -61,3 +61,46 @@ func TestPrettyColorEnabled(t *testing.T) {
 		t.Fatalf("expected ansi color escape sequence, got: %q", rendered)
 	}
 }
+
+func TestSortByPosition(t *testing.T) {
+	at := func(line, column int, message string) error {
+		tok := &token.Token{Value: "x", Line: line, Column: column}
+		return NewAtToken("typechecker", "", "", tok, 1, "%s", message)
+	}
+
+	errs := []error{
+		at(3, 1, "third"),
+		New("typechecker", "", "", "unplaced"),
+		at(1, 9, "second"),
+		at(1, 2, "first"),
+	}
+
+	Sort(errs)
+
+	got := []string{}
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+
+	if strings.Join(got, " ") != "first second third unplaced" {
+		t.Fatalf("unexpected order: %v", got)
+	}
+}
+
+func TestColorModeOverridesEnvironment(t *testing.T) {
+	_ = os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	defer SetColorMode("auto")
+
+	if err := SetColorMode("always"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(New("parser", "", "", "Unexpected token.").Pretty(), "\x1b[") {
+		t.Fatalf("expected color when the mode is always")
+	}
+
+	if err := SetColorMode("sometimes"); err == nil {
+		t.Fatalf("expected an error for an invalid color mode")
+	}
+}
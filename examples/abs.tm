@@ -9,4 +9,3 @@ end
 -- prefix expression doesn't work I think
 let result int = abs(-42)
 print(str(result))
-
@@ -1,2 +1,2 @@
-let a = [1,2,3,4,5]
+let a = [1, 2, 3, 4, 5]
 let something = ["something", "else"]
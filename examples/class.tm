@@ -0,0 +1,18 @@
+class Point
+    x int
+    y int
+
+    fn norm() int then
+        return self.x * self.x + self.y * self.y
+    end
+
+    fn shift(dx int) then
+        self.x += dx
+    end
+end
+
+let p = Point(3, 4)
+p.shift(1)
+
+print(p.x)
+print(p.norm())
@@ -9,4 +9,3 @@ if x / 2 == 0 then
 else
     print("odd")
 end
-
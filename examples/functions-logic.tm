@@ -6,4 +6,3 @@ fn max(a int, b int) int then
 end
 
 print(str(max(10, 3)))
-
@@ -3,4 +3,3 @@ fn greet(name string) string then
 end
 
 print(greet("pspiagicw"))
-
@@ -4,4 +4,3 @@ end
 
 let result int = add(10, 32)
 print(str(result))
-
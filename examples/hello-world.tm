@@ -1,4 +1,2 @@
 -- this is how comments look like.
 print("Hello, World")
-
-
@@ -1,4 +1,3 @@
--- Shouldn't work, cause of recursion.
 fn pow(x int, n int) int then
     if n == 0 then
         return 1
@@ -10,4 +9,3 @@ end
 let result int = pow(2, 8)
 
 print(str(result))
-
@@ -0,0 +1,438 @@
+// Package formatter prints tremor source in its canonical layout.
+//
+// The source is parsed and printed back from the tree. Blocks are indented by four spaces, binary operators are
+// spaced, lists are separated by ", " and strings use double quotes, with escapes kept as written. Comments come from
+// the lexer and are printed before the statement that follows them, or at the end of the line they were on. Single
+// blank lines between statements are kept, longer runs are collapsed.
+package formatter
+
+import (
+	"strings"
+
+	"github.com/pspiagicw/tremor/ast"
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/pspiagicw/tremor/parser"
+	"github.com/pspiagicw/tremor/token"
+	"github.com/pspiagicw/tremor/types"
+)
+
+const indentation = "    "
+
+// Format returns source in the canonical layout. Source with syntax errors is not formatted, the errors are returned
+// instead.
+func Format(source string, file string) (string, []error) {
+	l := lexer.NewLexerWithFile(source, file)
+	p := parser.NewParser(l)
+
+	tree := p.ParseAST()
+
+	if len(p.Errors()) != 0 {
+		errs := []error{}
+		for _, err := range p.Errors() {
+			errs = append(errs, err)
+		}
+		return "", errs
+	}
+
+	printer := &printer{comments: l.Comments()}
+	for _, statement := range tree.Statements {
+		printer.statement(statement)
+	}
+	printer.flushComments(len(source))
+
+	if printer.out.Len() == 0 {
+		return "", nil
+	}
+
+	return printer.out.String() + "\n", nil
+}
+
+type printer struct {
+	out    strings.Builder
+	indent int
+	// Comments not printed yet, in source order.
+	comments []*token.Token
+	// Source line of the last thing printed, 0 before anything is.
+	lastLine int
+	// Set at the start of a block, blank lines are not kept there.
+	blockStart bool
+}
+
+func (p *printer) write(values ...string) {
+	for _, value := range values {
+		p.out.WriteString(value)
+	}
+}
+
+// line starts a new line, with a blank line before it when the source had one before line.
+func (p *printer) line(line int) {
+	if p.out.Len() != 0 {
+		if !p.blockStart && p.lastLine != 0 && line-p.lastLine > 1 {
+			p.write("\n")
+		}
+		p.write("\n")
+	}
+	p.write(strings.Repeat(indentation, p.indent))
+	p.blockStart = false
+}
+
+// flushComments prints the comments before offset, a comment on the line printed last stays at its end.
+func (p *printer) flushComments(offset int) {
+	for len(p.comments) != 0 && p.comments[0].Offset < offset {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+
+		if p.lastLine == comment.Line && p.out.Len() != 0 {
+			p.write(" ", comment.Value)
+		} else {
+			p.line(comment.Line)
+			p.write(comment.Value)
+		}
+
+		p.lastLine = comment.Line + strings.Count(comment.Value, "\n")
+	}
+}
+
+func (p *printer) statement(statement ast.Statement) {
+	first, last := span(statement)
+	if first != nil {
+		p.flushComments(first.Offset)
+		p.line(first.Line)
+	} else {
+		p.line(p.lastLine)
+	}
+
+	switch s := statement.(type) {
+	case *ast.LetStatement:
+		p.write("let ", s.Name.Value)
+		if s.Type != types.AutoType {
+			p.write(" ", formatType(s.Type))
+		}
+		p.write(" = ")
+		p.expression(s.Value)
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.Value != nil {
+			p.write(" ")
+			p.expression(s.Value)
+		}
+	case *ast.ExpressionStatement:
+		p.expression(s.Inside)
+	case *ast.BreakStatement:
+		p.write("break")
+	case *ast.ContinueStatement:
+		p.write("continue")
+	case *ast.IfStatement:
+		p.write("if ")
+		p.expression(s.Condition)
+		p.write(" then")
+		p.block(s.Consequence)
+		if s.Alternative != nil {
+			p.closing("else")
+			p.block(s.Alternative)
+		}
+		p.closing("end")
+	case *ast.WhileStatement:
+		p.write("while ")
+		p.expression(s.Condition)
+		p.write(" then")
+		p.block(s.Body)
+		p.closing("end")
+	case *ast.ForStatement:
+		p.write("for ")
+		for i, variable := range s.Variables {
+			if i != 0 {
+				p.write(", ")
+			}
+			p.write(variable.Value)
+		}
+		p.write(" in ")
+		p.expression(s.Iterable)
+		p.write(" then")
+		p.block(s.Body)
+		p.closing("end")
+	case *ast.FunctionStatement:
+		p.write("fn ", s.Name.Value)
+		p.function(s.Args, s.Type, s.ReturnType, s.Body)
+	case *ast.ClassStatement:
+		p.write("class ", s.Name.Value)
+		p.class(s)
+	default:
+		p.write(statement.String())
+	}
+
+	if last != nil {
+		p.lastLine = last.Line
+	}
+}
+
+// block prints the statements of a block one level deeper, along with the comments before its closing token.
+func (p *printer) block(block *ast.BlockStatement) {
+	p.indent++
+	p.blockStart = true
+	if block.Start != nil {
+		p.lastLine = block.Start.Line
+	}
+
+	for _, statement := range block.Statements {
+		p.statement(statement)
+	}
+	if block.End != nil {
+		p.flushComments(block.End.Offset)
+	}
+
+	p.indent--
+}
+
+// closing prints the keyword which ends a block on its own line, blank lines before it are dropped.
+func (p *printer) closing(keyword string) {
+	p.lastLine = 0
+	p.line(0)
+	p.write(keyword)
+}
+
+// function prints what follows the fn keyword and the name, if there is one.
+func (p *printer) function(args []*token.Token, argTypes []*types.Type, returnType *types.Type, body *ast.BlockStatement) {
+	p.write("(")
+	for i, arg := range args {
+		if i != 0 {
+			p.write(", ")
+		}
+		p.write(arg.Value)
+		if argTypes[i] != types.AutoType {
+			p.write(" ", formatType(argTypes[i]))
+		}
+	}
+	p.write(")")
+
+	if returnType != types.VoidType {
+		p.write(" ", formatType(returnType))
+	}
+	p.write(" then")
+
+	p.block(body)
+	p.closing("end")
+}
+
+// class prints fields and methods in the order they were declared.
+func (p *printer) class(class *ast.ClassStatement) {
+	p.indent++
+	p.blockStart = true
+	p.lastLine = class.Name.Line
+
+	field, method := 0, 0
+	for field < len(class.Fields) || method < len(class.Methods) {
+		if method == len(class.Methods) || (field < len(class.Fields) && class.Fields[field].Offset < class.Methods[method].Name.Offset) {
+			name := class.Fields[field]
+			p.flushComments(name.Offset)
+			p.line(name.Line)
+			p.write(name.Value, " ", formatType(class.FieldTypes[field]))
+			p.lastLine = name.Line
+			field++
+		} else {
+			p.statement(class.Methods[method])
+			method++
+		}
+	}
+	if class.End != nil {
+		p.flushComments(class.End.Offset)
+	}
+
+	p.indent--
+	p.closing("end")
+}
+
+func (p *printer) expression(expression ast.Expression) {
+	switch e := expression.(type) {
+	case *ast.StringExpression:
+		p.write(quote(e))
+	case *ast.InterpolationExpression:
+		p.write("\"")
+		for i, part := range e.Strings {
+			p.write(doubleQuoted(part.Raw))
+			if i < len(e.Expressions) {
+				p.write("${")
+				p.expression(e.Expressions[i])
+				p.write("}")
+			}
+		}
+		p.write("\"")
+	case *ast.BinaryExpression:
+		p.expression(e.Left)
+		p.write(" ", e.Operator.Value, " ")
+		p.expression(e.Right)
+	case *ast.PrefixExpression:
+		p.write(e.Operator.Value)
+		// Two minus signs in a row start a comment.
+		if e.Operator.Type == token.NOT || e.Operator.Type == token.MINUS && startsWithMinus(e.Right) {
+			p.write(" ")
+		}
+		p.expression(e.Right)
+	case *ast.AssignmentStatement:
+		p.expression(e.Target)
+		p.write(" ", e.Operator.Value, " ")
+		p.expression(e.Value)
+	case *ast.ParenthesisExpression:
+		p.write("(")
+		p.expression(e.Inside)
+		p.write(")")
+	case *ast.FunctionCallExpression:
+		p.expression(e.Caller)
+		p.write("(")
+		p.list(e.Arguments)
+		p.write(")")
+	case *ast.IndexExpression:
+		p.expression(e.Caller)
+		p.write("[")
+		p.expression(e.Index)
+		p.write("]")
+	case *ast.FieldExpression:
+		p.expression(e.Caller)
+		p.write(".")
+		p.expression(e.Field)
+	case *ast.RangeExpression:
+		p.expression(e.Start)
+		p.write("..")
+		p.expression(e.End)
+	case *ast.ArrayExpression:
+		p.write("[")
+		p.list(e.Elements)
+		p.write("]")
+	case *ast.HashExpression:
+		p.write("{")
+		for i, key := range e.Keys {
+			if i != 0 {
+				p.write(", ")
+			}
+			p.expression(key)
+			p.write(": ")
+			p.expression(e.Values[i])
+		}
+		p.write("}")
+	case *ast.LambdaExpression:
+		p.write("fn")
+		p.function(e.Args, e.Type, e.ReturnType, e.Body)
+	default:
+		p.write(expression.String())
+	}
+}
+func (p *printer) list(expressions []ast.Expression) {
+	for i, expression := range expressions {
+		if i != 0 {
+			p.write(", ")
+		}
+		p.expression(expression)
+	}
+}
+
+// quote prints strings in double quotes, long strings are left alone.
+func quote(s *ast.StringExpression) string {
+	if s.Type == ast.MULTILINE {
+		return "[[" + s.Raw + "]]"
+	}
+	return "\"" + doubleQuoted(s.Raw) + "\""
+}
+
+// doubleQuoted turns the text of a string into the text of a double quoted one, escapes are kept as they were written
+// except for \' which is not needed anymore.
+func doubleQuoted(raw string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(raw); i++ {
+		switch {
+		case raw[i] == '\\' && i+1 < len(raw):
+			if raw[i+1] != '\'' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(raw[i+1])
+			i++
+		case raw[i] == '"':
+			b.WriteString("\\\"")
+		default:
+			b.WriteByte(raw[i])
+		}
+	}
+
+	return b.String()
+}
+
+// formatType prints a type the way it is declared, types.Type.String() leaves out the spaces between arguments.
+func formatType(t *types.Type) string {
+	switch t.Kind {
+	case types.ARRAY:
+		return "[]" + formatType(t.KeyType)
+	case types.HASH:
+		return "[" + formatType(t.KeyType) + "]" + formatType(t.ValueType)
+	case types.OPTIONAL:
+		return "?" + formatType(t.ValueType)
+	case types.FUNCTION:
+		args := []string{}
+		for _, arg := range t.Args {
+			args = append(args, formatType(arg))
+		}
+		return "fn(" + strings.Join(args, ", ") + ") " + formatType(t.ReturnType)
+	}
+	return t.String()
+}
+
+// span returns the first and last tokens of a node, the closing end of blocks included.
+func span(node ast.Node) (*token.Token, *token.Token) {
+	var first, last *token.Token
+
+	visit := func(tok *token.Token) {
+		if tok == nil || tok.Line < 1 {
+			return
+		}
+		if first == nil || tok.Offset < first.Offset {
+			first = tok
+		}
+		if last == nil || tok.Offset > last.Offset {
+			last = tok
+		}
+	}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		visit(ast.NodeToken(n))
+		switch n := n.(type) {
+		case *ast.BlockStatement:
+			if n != nil {
+				visit(n.End)
+			}
+		case *ast.StringExpression:
+			visit(n.Token)
+			// Long strings can span lines.
+			if n.Token != nil && strings.Contains(n.Raw, "\n") {
+				end := *n.Token
+				end.Offset += len(n.Raw)
+				end.Line += strings.Count(n.Raw, "\n")
+				visit(&end)
+			}
+		case *ast.ClassStatement:
+			visit(n.End)
+			for _, field := range n.Fields {
+				visit(field)
+			}
+		}
+		return true
+	})
+
+	return first, last
+}
+
+// startsWithMinus reports whether the printed form of an expression starts with a '-'.
+func startsWithMinus(node ast.Expression) bool {
+	switch e := node.(type) {
+	case *ast.PrefixExpression:
+		return e.Operator.Type == token.MINUS
+	case *ast.BinaryExpression:
+		return startsWithMinus(e.Left)
+	case *ast.IndexExpression:
+		return startsWithMinus(e.Caller)
+	case *ast.FunctionCallExpression:
+		return startsWithMinus(e.Caller)
+	case *ast.FieldExpression:
+		return startsWithMinus(e.Caller)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,239 @@
+package formatter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/pspiagicw/tremor/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFormat(t *testing.T, input string, expected string) {
+	t.Helper()
+
+	actual, errs := Format(input, "test.tm")
+	require.Empty(t, errs)
+	assert.Equal(t, expected, actual)
+
+	again, errs := Format(actual, "test.tm")
+	require.Empty(t, errs)
+	assert.Equal(t, actual, again, "formatting is not idempotent")
+}
+
+func TestIndentation(t *testing.T) {
+	input := `fn f(x int) int then
+if x > 0 then
+      while x > 10 then
+  x -= 1
+   end
+else
+x = 0
+  end
+	return x
+end`
+	expected := `fn f(x int) int then
+    if x > 0 then
+        while x > 10 then
+            x -= 1
+        end
+    else
+        x = 0
+    end
+    return x
+end
+`
+	testFormat(t, input, expected)
+}
+
+func TestOneLineBlocks(t *testing.T) {
+	input := `if true then print("yes") end
+for i in 0..10 then print(i) end`
+	expected := `if true then
+    print("yes")
+end
+for i in 0..10 then
+    print(i)
+end
+`
+	testFormat(t, input, expected)
+}
+
+func TestOperatorSpacing(t *testing.T) {
+	input := `let x=1+2*(3-4)
+let y = -x
+let z = not   true  and false
+let s = "a".."b"
+let a = [1,2,   3]
+let h = {"a":1,"b" :2}
+let v=a[0]
+x+=1`
+	expected := `let x = 1 + 2 * (3 - 4)
+let y = -x
+let z = not true and false
+let s = "a" .. "b"
+let a = [1, 2, 3]
+let h = {"a": 1, "b": 2}
+let v = a[0]
+x += 1
+`
+	testFormat(t, input, expected)
+}
+
+func TestNestedMinusIsNotAComment(t *testing.T) {
+	input := `let y = - -1
+let z = -(-x)
+let w = - - x[0]`
+	expected := `let y = - -1
+let z = -(-x)
+let w = - -x[0]
+`
+	testFormat(t, input, expected)
+
+	output, errs := Format(input, "test.tm")
+	require.Empty(t, errs)
+	assert.Equal(t, parse(t, input), parse(t, output))
+}
+
+func TestStringQuotes(t *testing.T) {
+	input := `let a = 'single'
+let b = "double\t\u{41}"
+let c = 'has "quotes" and it\'s'
+let d = [[long \n
+  string]]
+let e = 'x = ${x + 1}, \${not}'
+let f = "${"nested ${y}"}"`
+	expected := `let a = "single"
+let b = "double\t\u{41}"
+let c = "has \"quotes\" and it's"
+let d = [[long \n
+  string]]
+let e = "x = ${x + 1}, \${not}"
+let f = "${"nested ${y}"}"
+`
+	testFormat(t, input, expected)
+}
+
+func TestTypes(t *testing.T) {
+	input := `let a []int = [1]
+let b [string]int = {"a": 1}
+let c ?int = nil
+let f fn(int,string) bool = fn(x int,y string) bool then return true end
+fn g(p Point) void then
+end`
+	expected := `let a []int = [1]
+let b [string]int = {"a": 1}
+let c ?int = nil
+let f fn(int, string) bool = fn(x int, y string) bool then
+    return true
+end
+fn g(p Point) then
+end
+`
+	testFormat(t, input, expected)
+}
+
+func TestComments(t *testing.T) {
+	input := `-- leading
+let x = 1 -- trailing
+
+
+
+--[[ block
+comment ]]
+fn f() int then -- header
+  -- inside
+  return x
+  -- before end
+end
+-- last`
+	expected := `-- leading
+let x = 1 -- trailing
+
+--[[ block
+comment ]]
+fn f() int then -- header
+    -- inside
+    return x
+    -- before end
+end
+-- last
+`
+	testFormat(t, input, expected)
+}
+
+func TestClassMembersKeepTheirOrder(t *testing.T) {
+	input := `class Point
+x int
+fn norm() int then return self.x end
+  -- the second coordinate
+  y int
+end`
+	expected := `class Point
+    x int
+    fn norm() int then
+        return self.x
+    end
+    -- the second coordinate
+    y int
+end
+`
+	testFormat(t, input, expected)
+}
+
+func TestBlankLinesAtBlockEdgesAreDropped(t *testing.T) {
+	input := `if true then
+
+    print(1)
+
+end`
+	expected := `if true then
+    print(1)
+end
+`
+	testFormat(t, input, expected)
+}
+
+func TestOnlyComments(t *testing.T) {
+	testFormat(t, "--  a\n\n\n-- b", "--  a\n\n-- b\n")
+	testFormat(t, "", "")
+}
+
+func TestSyntaxErrorsAreReturned(t *testing.T) {
+	output, errs := Format("let x = \nlet y = )", "test.tm")
+	assert.Empty(t, output)
+	assert.NotEmpty(t, errs)
+}
+
+// The formatter only moves whitespace and quotes, the examples must parse to the same tree and format to themselves
+// the second time.
+func TestExamplesAreIdempotent(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.tm")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			source, err := os.ReadFile(file)
+			require.NoError(t, err)
+
+			once, errs := Format(string(source), file)
+			require.Empty(t, errs)
+
+			twice, errs := Format(once, file)
+			require.Empty(t, errs)
+			assert.Equal(t, once, twice)
+
+			assert.Equal(t, parse(t, string(source)), parse(t, once))
+		})
+	}
+}
+
+func parse(t *testing.T, source string) string {
+	p := parser.NewParser(lexer.NewLexer(source))
+	tree := p.ParseAST()
+	require.Empty(t, p.Errors())
+	return tree.String()
+}
@@ -2,7 +2,9 @@ package lexer
 
 import (
 	"strings"
+	"unicode/utf8"
 
+	"github.com/pspiagicw/tremor/diagnostic"
 	"github.com/pspiagicw/tremor/token"
 )
 
@@ -16,6 +18,24 @@ type Lexer struct {
 	line    int
 	column  int
 	EOF     bool
+	// Comments skipped so far, in source order.
+	comments []*token.Token
+	// Strings whose interpolated expression is being lexed, innermost last.
+	interpolations []interpolation
+	// Invalid characters and unterminated strings or comments, the parser reports them before its own errors.
+	errors []*diagnostic.Diagnostic
+	// Set when the input ends inside a string, comment or interpolation.
+	unterminated bool
+}
+
+// interpolation is a string interrupted by ${, the string resumes at the brace which closes it.
+type interpolation struct {
+	// The quote the string was opened with.
+	opening *token.Token
+	// The $ of the ${ being lexed.
+	dollar *token.Token
+	// Braces opened inside the expression and not closed yet.
+	depth int
 }
 
 func (l *Lexer) peek() string {
@@ -25,6 +45,13 @@ func (l *Lexer) peek() string {
 	return ""
 }
 
+func (l *Lexer) peekNext() string {
+	if l.readPos+1 < l.length {
+		return string(l.input[l.readPos+1])
+	}
+	return ""
+}
+
 func (l *Lexer) advance() {
 	if l.readPos == l.length {
 		if !l.EOF {
@@ -101,34 +128,86 @@ func (l *Lexer) identifier() string {
 	end := l.curPos
 	return l.input[start : end+1]
 }
+
+// number lexes a numeric literal, it is validated by the parser. Letters and underscores are taken in as well, so
+// malformed literals like 0xZZ or 1.2.3 end up in a single token.
 func (l *Lexer) number() string {
 	start := l.curPos
-	for !l.EOF && isDigit(l.peek()) || l.peek() == "." {
+	hex := strings.HasPrefix(l.input[start:], "0x") || strings.HasPrefix(l.input[start:], "0X")
+	for !l.EOF {
+		next := l.peek()
+		// Stop before '..', so ranges like 0..10 lex as INTEGER CONCAT INTEGER.
+		dot := next == "." && l.peekNext() != "."
+		// The sign of an exponent, e is a digit in hexadecimal.
+		sign := (next == "+" || next == "-") && (l.current == "e" || l.current == "E") && !hex
+		if !isAlpha(next) && !isDigit(next) && !dot && !sign {
+			break
+		}
 		l.advance()
 	}
 	end := l.curPos
 	return l.input[start : end+1]
 }
-func (l *Lexer) longString() string {
+func (l *Lexer) longString(opening *token.Token) string {
 	l.advance()
 	start := l.curPos
 	for !l.EOF && !(l.current == "]" && l.peek() == "]") {
 		l.advance()
 	}
+	if l.EOF {
+		l.unterminated = true
+		l.registerError(opening, 2, "Unterminated long string, expected ']]' before the end of the file.")
+		return l.input[start:]
+	}
 	end := l.curPos
 	l.advance() // Skip over the first ], the second ] will be automatically skipped over
 	return l.input[start:end]
 }
-func (l *Lexer) string(endValue string) string {
+
+// string returns the text up to the closing quote, or up to a ${ in which case open is true. Escapes are kept as they
+// are, the parser decodes them, but an escaped quote does not end the string. At the end of the input the rest of it
+// is returned.
+func (l *Lexer) string(quote string) (value string, open bool) {
 	l.advance()
 	start := l.curPos
-	for !l.EOF && l.current != endValue {
+	for !l.EOF && l.current != quote {
+		if l.current == "\\" {
+			l.advance()
+		} else if l.current == "$" && l.peek() == "{" {
+			value = l.input[start:l.curPos]
+			l.advance()
+			return value, true
+		}
 		l.advance()
 	}
+	if l.EOF {
+		return l.input[start:], false
+	}
 	end := l.curPos
-	return l.input[start:end]
+	return l.input[start:end], false
+}
+
+// quoted lexes the rest of a string, from its opening quote or the brace closing an interpolated expression. open is
+// the type of the token when the string is interrupted by another ${, closed when it ends.
+func (l *Lexer) quoted(opening *token.Token, open token.TokenType, closed token.TokenType, emit func(token.TokenType, string) *token.Token) *token.Token {
+	value, interrupted := l.string(opening.Value)
+	if interrupted {
+		// The string stops at the {, the $ is right before it.
+		dollar := newToken(token.INTERPOLATION, "${", l.curPos-1, l.line, l.column-1)
+		l.interpolations = append(l.interpolations, interpolation{opening: opening, dollar: dollar})
+		return emit(open, value)
+	}
+	if l.EOF {
+		l.unterminated = true
+		l.registerError(opening, 1, "Unterminated string, expected '%s' before the end of the file.", opening.Value)
+	}
+	return emit(closed, value)
 }
-func (l *Lexer) comment() {
+
+// comment skips a comment and returns its text, dashes included.
+func (l *Lexer) comment() string {
+	start := l.curPos
+	opening := newToken(token.COMMENT, "--[[", l.curPos, l.line, l.column)
 	l.advance()
 	l.advance() // Skip the 2 dashes
 	multiline := false
@@ -141,6 +220,11 @@ func (l *Lexer) comment() {
 		l.advance()
 	}
 
+	if l.EOF && multiline {
+		l.unterminated = true
+		l.registerError(opening, 4, "Unterminated comment, expected ']]' before the end of the file.")
+	}
+
 	if !l.EOF && multiline {
 		l.advance()
 	}
@@ -149,19 +233,25 @@ func (l *Lexer) comment() {
 		l.advance()
 	}
 
+	switch {
+	case l.EOF:
+		return l.input[start:]
+	case multiline:
+		return l.input[start : l.curPos+1]
+	default:
+		return l.input[start:l.curPos]
+	}
 }
-func predictNumber(input string) token.TokenType {
-	// TOOD: Complete lexing of integer and floats.
-
-	dotcount := strings.Count(input, ".")
 
-	if dotcount == 0 {
+// predictNumber tells integers from floats, prefixed literals are always integers.
+func predictNumber(input string) token.TokenType {
+	if len(input) > 1 && input[0] == '0' && strings.ContainsRune("xXoObB", rune(input[1])) {
 		return token.INTEGER
 	}
-	if dotcount == 1 {
+	if strings.ContainsAny(input, ".eE") {
 		return token.FLOAT
 	}
-	return token.INVALID
+	return token.INTEGER
 }
 
 func predictType(input string) token.TokenType {
@@ -194,6 +284,16 @@ func predictType(input string) token.TokenType {
 		return token.THEN
 	case "class":
 		return token.CLASS
+	case "while":
+		return token.WHILE
+	case "for":
+		return token.FOR
+	case "in":
+		return token.IN
+	case "break":
+		return token.BREAK
+	case "continue":
+		return token.CONTINUE
 	case "int":
 		fallthrough
 	case "void":
@@ -224,17 +324,30 @@ func (l *Lexer) Next() *token.Token {
 	}
 
 	if l.EOF {
+		for _, i := range l.interpolations {
+			l.unterminated = true
+			l.registerError(i.dollar, 2, "Unterminated interpolation, expected '}' before the end of the file.")
+		}
+		l.interpolations = nil
 		return newToken(token.EOF, "", l.readPos, l.line, l.column)
 	}
 
 	switch l.current {
 	case "+":
+		if l.peek() == "=" {
+			l.advance()
+			return emit(token.PLUS_ASSIGN, "+=")
+		}
 		return emit(token.PLUS, l.current)
 	case "-":
 		if l.peek() == "-" {
-			l.comment()
+			l.comments = append(l.comments, emit(token.COMMENT, l.comment()))
 			return l.Next()
 		}
+		if l.peek() == "=" {
+			l.advance()
+			return emit(token.MINUS_ASSIGN, "-=")
+		}
 		return emit(token.MINUS, l.current)
 	case "%":
 		return emit(token.MODULUS, l.current)
@@ -248,18 +361,32 @@ func (l *Lexer) Next() *token.Token {
 		return emit(token.SLASH, l.current)
 	case ":":
 		return emit(token.COLON, l.current)
+	case "?":
+		return emit(token.QUESTION, l.current)
 	case "(":
 		return emit(token.LPAREN, l.current)
 	case ")":
 		return emit(token.RPAREN, l.current)
 	case "{":
+		if n := len(l.interpolations); n != 0 {
+			l.interpolations[n-1].depth++
+		}
 		return emit(token.LBRACE, l.current)
 	case "}":
+		if n := len(l.interpolations); n != 0 {
+			if l.interpolations[n-1].depth == 0 {
+				opening := l.interpolations[n-1].opening
+				l.interpolations = l.interpolations[:n-1]
+				return l.quoted(opening, token.INTERPOLATION_MIDDLE, token.INTERPOLATION_END, emit)
+			}
+			l.interpolations[n-1].depth--
+		}
 		return emit(token.RBRACE, l.current)
 	case "[":
 		if l.peek() == "[" {
+			opening := emit(token.STRING_MULTILINE, "[[")
 			l.advance()
-			value := l.longString()
+			value := l.longString(opening)
 			return emit(token.STRING_MULTILINE, value)
 		}
 		return emit(token.LSQUARE, l.current)
@@ -272,6 +399,10 @@ func (l *Lexer) Next() *token.Token {
 				l.advance()
 				return emit(token.ELLIPSIS, "...")
 			}
+			if l.peek() == "=" {
+				l.advance()
+				return emit(token.CONCAT_ASSIGN, "..=")
+			}
 			return emit(token.CONCAT, "..")
 		}
 		return emit(token.DOT, l.current)
@@ -300,11 +431,9 @@ func (l *Lexer) Next() *token.Token {
 		}
 		return emit(token.GT, l.current)
 	case "'":
-		value := l.string(l.current)
-		return emit(token.STRING_SINGLE, value)
+		return l.quoted(emit(token.STRING_SINGLE, l.current), token.INTERPOLATION, token.STRING_SINGLE, emit)
 	case "\"":
-		value := l.string(l.current)
-		return emit(token.STRING_DOUBLE, value)
+		return l.quoted(emit(token.STRING_DOUBLE, l.current), token.INTERPOLATION, token.STRING_DOUBLE, emit)
 	default:
 		if isAlpha(l.current) {
 			value := l.identifier()
@@ -315,10 +444,26 @@ func (l *Lexer) Next() *token.Token {
 			tokentype := predictNumber(value)
 			return emit(tokentype, value)
 		}
-		return emit(token.INVALID, l.current)
+		return l.invalid(emit)
 	}
 }
 
+// invalid reports a character which cannot start a token, characters spanning several bytes are taken whole.
+func (l *Lexer) invalid(emit func(token.TokenType, string) *token.Token) *token.Token {
+	r, size := utf8.DecodeRuneInString(l.input[l.curPos:])
+	tok := emit(token.INVALID, l.input[l.curPos:l.curPos+size])
+	l.registerError(tok, size, "Unexpected character %q.", r)
+
+	for i := 1; i < size; i++ {
+		l.advance()
+	}
+	return tok
+}
+func (l *Lexer) registerError(tok *token.Token, width int, format string, args ...any) {
+	err := diagnostic.NewAtToken("lexer", l.file, l.input, tok, width, format, args...)
+	l.errors = append(l.errors, err)
+}
+
 func NewLexer(input string) *Lexer {
 	return NewLexerWithFile(input, "<input>")
 }
@@ -345,3 +490,18 @@ func (l *Lexer) Source() string {
 func (l *Lexer) FileName() string {
 	return l.file
 }
+
+// Comments returns the comments lexed so far, they are left out of the token stream.
+func (l *Lexer) Comments() []*token.Token {
+	return l.comments
+}
+
+// Errors returns the problems found in the input lexed so far.
+func (l *Lexer) Errors() []*diagnostic.Diagnostic {
+	return l.errors
+}
+
+// Unterminated tells whether the input ended inside a string, comment or interpolation, the REPL then waits for more.
+func (l *Lexer) Unterminated() bool {
+	return l.unterminated
+}
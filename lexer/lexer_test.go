@@ -49,6 +49,20 @@ func TestSingleCharComparisonAndAssignment(t *testing.T) {
 	testToken(t, input, expected)
 }
 
+func TestCompoundAssignment(t *testing.T) {
+	input := "+= -= ..= + - .."
+	expected := []token.Token{
+		{Type: token.PLUS_ASSIGN, Value: "+="},
+		{Type: token.MINUS_ASSIGN, Value: "-="},
+		{Type: token.CONCAT_ASSIGN, Value: "..="},
+		{Type: token.PLUS, Value: "+"},
+		{Type: token.MINUS, Value: "-"},
+		{Type: token.CONCAT, Value: ".."},
+		{Type: token.EOF, Value: ""},
+	}
+	testToken(t, input, expected)
+}
+
 func TestDelimiters(t *testing.T) {
 	input := "( ) { } [ ]"
 	expected := []token.Token{
@@ -94,6 +108,40 @@ func TestNumbers(t *testing.T) {
 	testToken(t, input, expected)
 }
 
+func TestNumberLiterals(t *testing.T) {
+	input := "0xFF 0o17 0b1010 1_000_000 1e-9 2.5E+3 0x1e-1 1.2.3 0xZZ 12abc"
+	expected := []token.Token{
+		{Type: token.INTEGER, Value: "0xFF"},
+		{Type: token.INTEGER, Value: "0o17"},
+		{Type: token.INTEGER, Value: "0b1010"},
+		{Type: token.INTEGER, Value: "1_000_000"},
+		{Type: token.FLOAT, Value: "1e-9"},
+		{Type: token.FLOAT, Value: "2.5E+3"},
+		{Type: token.INTEGER, Value: "0x1e"},
+		{Type: token.MINUS, Value: "-"},
+		{Type: token.INTEGER, Value: "1"},
+		{Type: token.FLOAT, Value: "1.2.3"},
+		{Type: token.INTEGER, Value: "0xZZ"},
+		{Type: token.INTEGER, Value: "12abc"},
+		{Type: token.EOF, Value: ""},
+	}
+	testToken(t, input, expected)
+}
+
+func TestRangeNumbers(t *testing.T) {
+	input := "0..10 1.5..n"
+	expected := []token.Token{
+		{Type: token.INTEGER, Value: "0"},
+		{Type: token.CONCAT, Value: ".."},
+		{Type: token.INTEGER, Value: "10"},
+		{Type: token.FLOAT, Value: "1.5"},
+		{Type: token.CONCAT, Value: ".."},
+		{Type: token.IDENTIFIER, Value: "n"},
+		{Type: token.EOF, Value: ""},
+	}
+	testToken(t, input, expected)
+}
+
 func TestKeywords(t *testing.T) {
 	input := "if else return fn end let not and or then class"
 	expected := []token.Token{
@@ -113,6 +161,19 @@ func TestKeywords(t *testing.T) {
 	testToken(t, input, expected)
 }
 
+func TestLoopKeywords(t *testing.T) {
+	input := "while for in break continue"
+	expected := []token.Token{
+		{Type: token.WHILE, Value: "while"},
+		{Type: token.FOR, Value: "for"},
+		{Type: token.IN, Value: "in"},
+		{Type: token.BREAK, Value: "break"},
+		{Type: token.CONTINUE, Value: "continue"},
+		{Type: token.EOF, Value: ""},
+	}
+	testToken(t, input, expected)
+}
+
 func TestLiterals(t *testing.T) {
 	input := "nil true false"
 	expected := []token.Token{
@@ -174,6 +235,131 @@ func TestMultilineCommentBetweenCode(t *testing.T) {
 	testToken(t, input, expected)
 }
 
+func TestCommentsAreKept(t *testing.T) {
+	input := "-- first\nlet y = 10 -- trailing\n--[[ block\n comment ]]\n--"
+	lexer := NewLexer(input)
+
+	for tok := lexer.Next(); tok.Type != token.EOF; tok = lexer.Next() {
+		if tok.Type == token.COMMENT {
+			t.Fatalf("Comment returned as a token: %q", tok.Value)
+		}
+	}
+
+	tests := []struct {
+		value  string
+		offset int
+		line   int
+		column int
+	}{
+		{value: "-- first", offset: 0, line: 1, column: 1},
+		{value: "-- trailing", offset: 20, line: 2, column: 12},
+		{value: "--[[ block\n comment ]]", offset: 32, line: 3, column: 1},
+		{value: "--", offset: 55, line: 5, column: 1},
+	}
+
+	comments := lexer.Comments()
+	if len(comments) != len(tests) {
+		t.Fatalf("Expected %d comments, got %d", len(tests), len(comments))
+	}
+
+	for i, tt := range tests {
+		tok := comments[i]
+		if tok.Type != token.COMMENT {
+			t.Fatalf("Comment type mismatch: got %s", tok.Type)
+		}
+		if tok.Value != tt.value {
+			t.Fatalf("Comment value mismatch: got %q expected %q", tok.Value, tt.value)
+		}
+		if tok.Offset != tt.offset || tok.Line != tt.line || tok.Column != tt.column {
+			t.Fatalf("Comment location mismatch: got %d %d:%d expected %d %d:%d", tok.Offset, tok.Line, tok.Column, tt.offset, tt.line, tt.column)
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    int
+		column  int
+		width   int
+	}{
+		{input: "let x = 1 @ 2", message: "Unexpected character '@'.", line: 1, column: 11, width: 1},
+		{input: "let é = 1", message: "Unexpected character 'é'.", line: 1, column: 5, width: 2},
+		{input: "let s = \"open\nlet y = 2", message: "Unterminated string, expected '\"' before the end of the file.", line: 1, column: 9, width: 1},
+		{input: "print('a', 'b)", message: "Unterminated string, expected ''' before the end of the file.", line: 1, column: 12, width: 1},
+		{input: "let s = \"ok\"\nlet t = [[long\nstring", message: "Unterminated long string, expected ']]' before the end of the file.", line: 2, column: 9, width: 2},
+		{input: "let x = 1\n  --[[ never\nclosed", message: "Unterminated comment, expected ']]' before the end of the file.", line: 2, column: 3, width: 4},
+		{input: "\"a ${b} c ${d", message: "Unterminated interpolation, expected '}' before the end of the file.", line: 1, column: 11, width: 2},
+		{input: "\"a ${b} c", message: "Unterminated string, expected '\"' before the end of the file.", line: 1, column: 1, width: 1},
+	}
+
+	for _, tt := range tests {
+		lexer := NewLexer(tt.input)
+		for tok := lexer.Next(); tok.Type != token.EOF; tok = lexer.Next() {
+		}
+
+		errors := lexer.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("Expected 1 error for %q, got %d", tt.input, len(errors))
+		}
+
+		err := errors[0]
+		if err.Message != tt.message {
+			t.Fatalf("Error message mismatch: got %q expected %q", err.Message, tt.message)
+		}
+		if err.Span.StartLine != tt.line || err.Span.StartColumn != tt.column || err.Span.EndColumn != tt.column+tt.width-1 {
+			t.Fatalf("Error span mismatch for %q: got %d:%d-%d expected %d:%d-%d", tt.input, err.Span.StartLine, err.Span.StartColumn, err.Span.EndColumn, tt.line, tt.column, tt.column+tt.width-1)
+		}
+	}
+}
+
+func TestUnterminatedStringKeepsTheRest(t *testing.T) {
+	input := "'abc"
+	expected := []token.Token{
+		{Type: token.STRING_SINGLE, Value: "abc"},
+		{Type: token.EOF, Value: ""},
+	}
+	testToken(t, input, expected)
+}
+
+func TestEscapedQuotes(t *testing.T) {
+	input := `"say \"hi\"" 'it\'s' "\\"`
+	expected := []token.Token{
+		{Type: token.STRING_DOUBLE, Value: `say \"hi\"`},
+		{Type: token.STRING_SINGLE, Value: `it\'s`},
+		{Type: token.STRING_DOUBLE, Value: `\\`},
+		{Type: token.EOF, Value: ""},
+	}
+	testToken(t, input, expected)
+}
+
+func TestInterpolation(t *testing.T) {
+	input := `"a ${x} b ${ {"k": 1}["k"] } c" '${"in ${y}"}' "\${no}"`
+	expected := []token.Token{
+		{Type: token.INTERPOLATION, Value: "a "},
+		{Type: token.IDENTIFIER, Value: "x"},
+		{Type: token.INTERPOLATION_MIDDLE, Value: " b "},
+		{Type: token.LBRACE, Value: "{"},
+		{Type: token.STRING_DOUBLE, Value: "k"},
+		{Type: token.COLON, Value: ":"},
+		{Type: token.INTEGER, Value: "1"},
+		{Type: token.RBRACE, Value: "}"},
+		{Type: token.LSQUARE, Value: "["},
+		{Type: token.STRING_DOUBLE, Value: "k"},
+		{Type: token.RSQUARE, Value: "]"},
+		{Type: token.INTERPOLATION_END, Value: " c"},
+		{Type: token.INTERPOLATION, Value: ""},
+		{Type: token.INTERPOLATION, Value: "in "},
+		{Type: token.IDENTIFIER, Value: "y"},
+		{Type: token.INTERPOLATION_END, Value: ""},
+		{Type: token.INTERPOLATION_END, Value: ""},
+		{Type: token.STRING_DOUBLE, Value: `\${no}`},
+		{Type: token.EOF, Value: ""},
+	}
+	testToken(t, input, expected)
+}
+
 func TestArray(t *testing.T) {
 	input := `[1,2,3]`
 
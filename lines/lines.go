@@ -0,0 +1,32 @@
+// Package lines maps compiled instructions back to the tremor source they came from, the compiler writes the tables and
+// .tmc files carry them.
+package lines
+
+import "sort"
+
+// Line says that the instructions from Offset up to the next entry were compiled from the token at Line and Column.
+type Line struct {
+	Offset int
+	Line   int
+	Column int
+	Width  int
+}
+
+// Lines is the line table of one tape, sorted by offset.
+type Lines []Line
+
+// Find returns the source position of the instruction at offset.
+func (l Lines) Find(offset int) (Line, bool) {
+	i := sort.Search(len(l), func(i int) bool { return l[i].Offset > offset })
+	if i == 0 {
+		return Line{}, false
+	}
+	return l[i-1], true
+}
+
+// Table maps the instructions of a program back to the source. Functions[i] is the table of the i-th compiled function
+// among the constants, in the order they appear there.
+type Table struct {
+	Main      Lines
+	Functions []Lines
+}
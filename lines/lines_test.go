@@ -0,0 +1,26 @@
+package lines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinesFind(t *testing.T) {
+	lines := Lines{
+		{Offset: 0, Line: 1, Column: 1},
+		{Offset: 3, Line: 2, Column: 5},
+		{Offset: 7, Line: 3, Column: 1},
+	}
+
+	line, ok := lines.Find(4)
+	assert.True(t, ok)
+	assert.Equal(t, 2, line.Line)
+
+	line, ok = lines.Find(7)
+	assert.True(t, ok)
+	assert.Equal(t, 3, line.Line)
+
+	_, ok = Lines{}.Find(0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,262 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pspiagicw/tremor/ast"
+	"github.com/pspiagicw/tremor/diagnostic"
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/pspiagicw/tremor/parser"
+	"github.com/pspiagicw/tremor/token"
+	"github.com/pspiagicw/tremor/typechecker"
+	"github.com/pspiagicw/tremor/types"
+)
+
+var keywords = []string{
+	"if", "else", "then", "end", "fn", "return", "let", "class", "while", "for", "in", "break", "continue",
+	"and", "or", "not", "true", "false", "nil", "int", "float", "string", "bool", "void",
+}
+
+// analysis is the result of running the frontend over one version of a document.
+type analysis struct {
+	source string
+	tree   ast.Node
+	errors []error
+	// Whether the document parsed without errors.
+	parsed bool
+	// Nil only when the checker failed on the tree the parser recovered.
+	checker *typechecker.TypeChecker
+	scope   *typechecker.TypeScope
+}
+
+// analyze parses and typechecks a document like `tremor check` does. Unlike it the statements which parsed are checked
+// even when others did not, the user is in the middle of typing most of the time.
+func analyze(uri string, source string) *analysis {
+	file := filename(uri)
+
+	l := lexer.NewLexerWithFile(source, file)
+	p := parser.NewParser(l)
+	tree := p.ParseAST()
+
+	a := &analysis{source: source, tree: tree, parsed: len(p.Errors()) == 0}
+
+	for _, err := range p.Errors() {
+		a.errors = append(a.errors, err)
+	}
+
+	a.check(file, source)
+	return a
+}
+
+// check typechecks the tree, a recovered tree is new ground for the checker so a panic only loses the type errors.
+func (a *analysis) check(file string, source string) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.checker = nil
+			a.scope = nil
+		}
+	}()
+
+	tc := typechecker.NewTypeChecker()
+	tc.SetSourceContext(file, source)
+	scope := typechecker.NewScope()
+	scope.SetupBuiltinFunctions()
+	_ = tc.TypeCheck(a.tree, scope)
+
+	for _, err := range tc.Errors() {
+		a.errors = append(a.errors, err)
+	}
+	a.checker = tc
+	a.scope = scope
+}
+
+// filename turns a file URI into a path for diagnostics, other URIs are used as they are.
+func filename(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+func (a *analysis) diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	for _, err := range a.errors {
+		d := Diagnostic{Severity: SeverityError, Source: "tremor", Message: err.Error()}
+		if diag, ok := err.(*diagnostic.Diagnostic); ok {
+			d.Source = "tremor " + diag.Stage
+			d.Range = spanRange(diag.Span)
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	return diagnostics
+}
+
+// hover shows the type of the identifier or declaration under pos.
+func (a *analysis) hover(pos Position) *Hover {
+	if a.checker == nil {
+		return nil
+	}
+
+	var found *token.Token
+	var nodetype *types.Type
+
+	ast.Inspect(a.tree, func(node ast.Node) bool {
+		tok := declaredName(node)
+		if tok == nil || !covers(tok, pos) {
+			return true
+		}
+		if t, ok := a.checker.Map()[node]; ok && t != types.UnknownType {
+			found, nodetype = tok, t
+		}
+		return true
+	})
+
+	if found == nil {
+		return nil
+	}
+
+	r := tokenRange(found)
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: fmt.Sprintf("```tremor\n%s: %s\n```", found.Value, nodetype)},
+		Range:    &r,
+	}
+}
+
+// declaredName returns the name token of identifiers and declarations, the nodes worth hovering.
+func declaredName(node ast.Node) *token.Token {
+	switch n := node.(type) {
+	case *ast.IdentifierExpression:
+		return n.Value
+	case *ast.LetStatement:
+		return n.Name
+	case *ast.FunctionStatement:
+		return n.Name
+	case *ast.ClassStatement:
+		return n.Name
+	}
+	return nil
+}
+
+// definition finds where the identifier under pos was declared.
+func (a *analysis) definition(uri string, pos Position) *Location {
+	if a.checker == nil {
+		return nil
+	}
+
+	for ident, tok := range a.checker.Definitions() {
+		if covers(ident.Value, pos) {
+			return &Location{URI: uri, Range: tokenRange(tok)}
+		}
+	}
+
+	return nil
+}
+
+// completion lists the symbols visible at pos followed by the keywords. Variables declared further down are left out,
+// functions and classes are hoisted so they are not.
+func (a *analysis) completion(pos Position) []CompletionItem {
+	items := []CompletionItem{}
+
+	if a.checker != nil {
+		offset := offsetOf(a.source, pos)
+
+		for _, symbol := range a.scopeAt(offset).Visible() {
+			if strings.HasPrefix(symbol.Name, "__") || symbol.Type == types.UnknownType {
+				continue
+			}
+
+			kind := KindVariable
+			switch symbol.Type.Kind {
+			case types.FUNCTION:
+				kind = KindFunction
+			case types.CLASS:
+				kind = KindClass
+			}
+
+			if kind == KindVariable && symbol.Definition != nil && symbol.Definition.Offset >= offset {
+				continue
+			}
+
+			items = append(items, CompletionItem{Label: symbol.Name, Kind: kind, Detail: symbol.Type.String()})
+		}
+
+		sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	}
+
+	for _, keyword := range keywords {
+		items = append(items, CompletionItem{Label: keyword, Kind: KindKeyword})
+	}
+
+	return items
+}
+
+// scopeAt returns the scope of the innermost block containing offset.
+func (a *analysis) scopeAt(offset int) *typechecker.TypeScope {
+	scope := a.scope
+	size := -1
+
+	for block, blockScope := range a.checker.Scopes() {
+		if block.Start == nil || block.End == nil {
+			continue
+		}
+		if offset <= block.Start.Offset || offset > block.End.Offset {
+			continue
+		}
+		if width := block.End.Offset - block.Start.Offset; size == -1 || width < size {
+			scope, size = blockScope, width
+		}
+	}
+
+	return scope
+}
+
+func covers(tok *token.Token, pos Position) bool {
+	start := tok.Column - 1
+	return tok.Line-1 == pos.Line && start <= pos.Character && pos.Character < start+tokenWidth(tok)
+}
+func tokenWidth(tok *token.Token) int {
+	if len(tok.Value) < 1 {
+		return 1
+	}
+	return len(tok.Value)
+}
+func tokenRange(tok *token.Token) Range {
+	start := Position{Line: tok.Line - 1, Character: tok.Column - 1}
+	return Range{Start: start, End: Position{Line: start.Line, Character: start.Character + tokenWidth(tok)}}
+}
+
+// spanRange converts a diagnostic span, its end column is inclusive.
+func spanRange(span *diagnostic.Span) Range {
+	if span == nil {
+		return Range{}
+	}
+	return Range{
+		Start: Position{Line: span.StartLine - 1, Character: span.StartColumn - 1},
+		End:   Position{Line: span.EndLine - 1, Character: span.EndColumn},
+	}
+}
+
+// offsetOf returns the byte offset of pos in source, positions past the end of a line are clamped to it.
+func offsetOf(source string, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(source[offset:], '\n')
+		if next == -1 {
+			return len(source)
+		}
+		offset += next + 1
+	}
+
+	end := strings.IndexByte(source[offset:], '\n')
+	if end == -1 {
+		end = len(source) - offset
+	}
+
+	return offset + min(pos.Character, end)
+}
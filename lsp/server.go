@@ -0,0 +1,219 @@
+// Package lsp is a language server for tremor, it speaks the Language Server Protocol over any reader and writer.
+//
+// Documents are checked with the same frontend as `tremor check` whenever they change, the server then publishes the
+// diagnostics and answers hover, definition and completion requests from the result.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrExitWithoutShutdown is returned by Serve when the client exits before asking the server to shut down.
+var ErrExitWithoutShutdown = errors.New("Client exited without shutting down the server.")
+
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	documents   map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+type document struct {
+	current *analysis
+	// The latest version which parsed, completion falls back to it while the user is in the middle of typing.
+	checked *analysis
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*document{},
+	}
+}
+
+// Serve handles messages until the client exits or the input is closed.
+func (s *Server) Serve() error {
+	for {
+		msg, err := ReadMessage(s.in)
+
+		var rpcErr *ResponseError
+		if errors.As(err, &rpcErr) {
+			if err := s.reply(nil, nil, rpcErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+
+		result, rpcErr := s.handle(msg)
+
+		// Nothing is sent back for notifications, not even errors.
+		if msg.ID == nil {
+			continue
+		}
+		if err := s.reply(msg.ID, result, rpcErr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *Message) (any, *ResponseError) {
+	if msg.Method == "" {
+		return nil, &ResponseError{Code: codeInvalidRequest, Message: "Request has no method."}
+	}
+	if !s.initialized && msg.Method != "initialize" {
+		return nil, &ResponseError{Code: codeNotInitialized, Message: "Server is not initialized."}
+	}
+	if s.shutdown {
+		return nil, &ResponseError{Code: codeInvalidRequest, Message: "Server is shutting down."}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		s.initialized = true
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:   1,
+				HoverProvider:      true,
+				DefinitionProvider: true,
+				CompletionProvider: map[string]any{},
+			},
+			ServerInfo: ServerInfo{Name: "tremor"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		params := DidOpenTextDocumentParams{}
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		params := DidChangeTextDocumentParams{}
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return nil, s.update(params.TextDocument.URI, text)
+	case "textDocument/didClose":
+		params := DidCloseTextDocumentParams{}
+		if err := decode(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		// Editors keep showing diagnostics of closed files unless they are cleared.
+		return nil, s.publish(params.TextDocument.URI, []Diagnostic{})
+	case "textDocument/hover":
+		doc, params, err := s.position(msg.Params)
+		if err != nil || doc == nil {
+			return nil, err
+		}
+		return doc.current.hover(params.Position), nil
+	case "textDocument/definition":
+		doc, params, err := s.position(msg.Params)
+		if err != nil || doc == nil {
+			return nil, err
+		}
+		return doc.current.definition(params.TextDocument.URI, params.Position), nil
+	case "textDocument/completion":
+		doc, params, err := s.position(msg.Params)
+		if err != nil || doc == nil {
+			return nil, err
+		}
+		return doc.checked.completion(params.Position), nil
+	}
+
+	return nil, &ResponseError{Code: codeMethodNotFound, Message: fmt.Sprintf("Method '%s' is not supported.", msg.Method)}
+}
+
+// update checks the new text of a document and publishes its diagnostics.
+func (s *Server) update(uri string, text string) *ResponseError {
+	doc, ok := s.documents[uri]
+	if !ok {
+		doc = &document{}
+		s.documents[uri] = doc
+	}
+
+	doc.current = analyze(uri, text)
+	if doc.current.parsed || doc.checked == nil {
+		doc.checked = doc.current
+	}
+
+	return s.publish(uri, doc.current.diagnostics())
+}
+func (s *Server) publish(uri string, diagnostics []Diagnostic) *ResponseError {
+	err := s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+	if err != nil {
+		return &ResponseError{Code: codeInvalidRequest, Message: err.Error()}
+	}
+	return nil
+}
+
+// position decodes the params of a request about a position, the document is nil when it is not open.
+func (s *Server) position(raw json.RawMessage) (*document, *TextDocumentPositionParams, *ResponseError) {
+	params := &TextDocumentPositionParams{}
+	if err := decode(raw, params); err != nil {
+		return nil, nil, err
+	}
+	return s.documents[params.TextDocument.URI], params, nil
+}
+func decode(raw json.RawMessage, v any) *ResponseError {
+	err := json.Unmarshal(raw, v)
+	if err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: fmt.Sprintf("Invalid params: %v", err)}
+	}
+	return nil
+}
+
+func (s *Server) reply(id *json.RawMessage, result any, rpcErr *ResponseError) error {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+
+	msg := &Message{ID: id}
+	if rpcErr != nil {
+		msg.Error = rpcErr
+		return WriteMessage(s.out, msg)
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	msg.Result = body
+
+	return WriteMessage(s.out, msg)
+}
+func (s *Server) notify(method string, params any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return WriteMessage(s.out, &Message{Method: method, Params: body})
+}
@@ -0,0 +1,347 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testURI = "file:///tmp/test.tm"
+
+// client drives a server running in the same process over pipes.
+type client struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+	// Notifications received while waiting for responses.
+	notifications []*Message
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, in: clientOut, out: bufio.NewReader(clientIn), done: make(chan error, 1)}
+
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+
+	t.Cleanup(func() { clientOut.Close() })
+
+	return c
+}
+
+func (c *client) send(msg *Message) {
+	require.NoError(c.t, WriteMessage(c.in, msg))
+}
+func (c *client) read() *Message {
+	msg, err := ReadMessage(c.out)
+	require.NoError(c.t, err)
+	return msg
+}
+
+// request sends a request and waits for its response.
+func (c *client) request(method string, params any) *Message {
+	c.nextID++
+	id := json.RawMessage(rawID(c.nextID))
+	c.send(&Message{ID: &id, Method: method, Params: marshal(c.t, params)})
+
+	for {
+		msg := c.read()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		require.Equal(c.t, string(id), string(*msg.ID))
+		return msg
+	}
+}
+func (c *client) notify(method string, params any) {
+	c.send(&Message{Method: method, Params: marshal(c.t, params)})
+}
+
+// diagnostics waits for the next diagnostics the server publishes.
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	msg := c.read()
+	require.Equal(c.t, "textDocument/publishDiagnostics", msg.Method)
+
+	params := PublishDiagnosticsParams{}
+	require.NoError(c.t, json.Unmarshal(msg.Params, &params))
+	return params
+}
+
+func (c *client) initialize() {
+	response := c.request("initialize", map[string]any{})
+	require.Nil(c.t, response.Error)
+	c.notify("initialized", map[string]any{})
+}
+func (c *client) open(text string) PublishDiagnosticsParams {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "tremor", Version: 1, Text: text},
+	})
+	return c.diagnostics()
+}
+func (c *client) change(text string) PublishDiagnosticsParams {
+	params := map[string]any{
+		"textDocument":   map[string]any{"uri": testURI, "version": 2},
+		"contentChanges": []map[string]any{{"text": text}},
+	}
+	c.notify("textDocument/didChange", params)
+	return c.diagnostics()
+}
+func (c *client) at(method string, line int, character int, result any) {
+	response := c.request(method, TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	})
+	require.Nil(c.t, response.Error)
+	require.NoError(c.t, json.Unmarshal(response.Result, result))
+}
+
+func marshal(t *testing.T, v any) json.RawMessage {
+	body, err := json.Marshal(v)
+	require.NoError(t, err)
+	return body
+}
+func rawID(id int) string {
+	body, _ := json.Marshal(id)
+	return string(body)
+}
+
+func TestInitialize(t *testing.T) {
+	c := newClient(t)
+
+	response := c.request("initialize", map[string]any{})
+	require.Nil(t, response.Error)
+
+	result := InitializeResult{}
+	require.NoError(t, json.Unmarshal(response.Result, &result))
+	assert.Equal(t, 1, result.Capabilities.TextDocumentSync)
+	assert.True(t, result.Capabilities.HoverProvider)
+	assert.True(t, result.Capabilities.DefinitionProvider)
+	assert.NotNil(t, result.Capabilities.CompletionProvider)
+}
+
+func TestRequestBeforeInitialize(t *testing.T) {
+	c := newClient(t)
+
+	response := c.request("textDocument/hover", TextDocumentPositionParams{})
+	require.NotNil(t, response.Error)
+	assert.Equal(t, codeNotInitialized, response.Error.Code)
+}
+
+func TestUnknownMethod(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+
+	response := c.request("workspace/symbol", map[string]any{})
+	require.NotNil(t, response.Error)
+	assert.Equal(t, codeMethodNotFound, response.Error.Code)
+}
+
+func TestShutdownAndExit(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+
+	response := c.request("shutdown", nil)
+	require.Nil(t, response.Error)
+	assert.Equal(t, "null", string(response.Result))
+
+	c.notify("exit", nil)
+	assert.NoError(t, <-c.done)
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+
+	c.notify("exit", nil)
+	assert.ErrorIs(t, <-c.done, ErrExitWithoutShutdown)
+}
+
+func TestSyntaxErrorDiagnostics(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+
+	params := c.open("let x int = \n")
+
+	assert.Equal(t, testURI, params.URI)
+	require.Len(t, params.Diagnostics, 1)
+	assert.Equal(t, "tremor parser", params.Diagnostics[0].Source)
+	assert.Equal(t, SeverityError, params.Diagnostics[0].Severity)
+}
+
+func TestTypeErrorDiagnostics(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+
+	params := c.open("let x int = 1\nlet y string = x\n")
+
+	require.Len(t, params.Diagnostics, 1)
+	d := params.Diagnostics[0]
+	assert.Equal(t, "tremor typechecker", d.Source)
+	assert.Contains(t, d.Message, "Declared type mismatch")
+	assert.Equal(t, 1, d.Range.Start.Line)
+	assert.Equal(t, 4, d.Range.Start.Character)
+	assert.Equal(t, Position{Line: 1, Character: 5}, d.Range.End)
+}
+
+func TestSyntaxAndTypeErrorDiagnostics(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+
+	params := c.open("let x int = true\nlet y = \n")
+
+	sources := []string{}
+	for _, d := range params.Diagnostics {
+		sources = append(sources, d.Source)
+	}
+	assert.ElementsMatch(t, []string{"tremor parser", "tremor typechecker"}, sources)
+}
+
+func TestDiagnosticsClearedOnChange(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+
+	params := c.open("let x int = true\n")
+	require.Len(t, params.Diagnostics, 1)
+
+	params = c.change("let x int = 1\n")
+	assert.Empty(t, params.Diagnostics)
+	assert.NotNil(t, params.Diagnostics, "an empty list clears the editor")
+}
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+	c.open("fn add(a int, b int) int then\n    return a + b\nend\nlet total = add(1, 2)\nprint(str(total))\n")
+
+	hover := &Hover{}
+	c.at("textDocument/hover", 3, 13, hover)
+	assert.Equal(t, "markdown", hover.Contents.Kind)
+	assert.Contains(t, hover.Contents.Value, "add: ")
+	assert.Equal(t, Range{Start: Position{Line: 3, Character: 12}, End: Position{Line: 3, Character: 15}}, *hover.Range)
+
+	hover = &Hover{}
+	c.at("textDocument/hover", 3, 5, hover)
+	assert.Contains(t, hover.Contents.Value, "total: int")
+
+	hover = &Hover{}
+	c.at("textDocument/hover", 1, 11, hover)
+	assert.Contains(t, hover.Contents.Value, "a: int")
+}
+
+func TestHoverAndDefinitionWhileEditing(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+	c.open("let total = 1\nprint(str(total))\nlet next = \n")
+
+	hover := &Hover{}
+	c.at("textDocument/hover", 1, 12, hover)
+	assert.Contains(t, hover.Contents.Value, "total: int")
+
+	location := &Location{}
+	c.at("textDocument/definition", 1, 12, location)
+	assert.Equal(t, 0, location.Range.Start.Line)
+}
+
+func TestHoverOnNothing(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+	c.open("let x = 1\n")
+
+	var hover *Hover
+	c.at("textDocument/hover", 0, 9, &hover)
+	assert.Nil(t, hover)
+}
+
+func TestDefinition(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+	c.open("let limit = 10\nfn twice(n int) int then\n    return n * 2\nend\nlet doubled = twice(limit)\n")
+
+	location := &Location{}
+	c.at("textDocument/definition", 4, 21, location)
+	assert.Equal(t, testURI, location.URI)
+	assert.Equal(t, Position{Line: 0, Character: 4}, location.Range.Start)
+
+	location = &Location{}
+	c.at("textDocument/definition", 4, 15, location)
+	assert.Equal(t, Position{Line: 1, Character: 3}, location.Range.Start)
+
+	location = &Location{}
+	c.at("textDocument/definition", 2, 11, location)
+	assert.Equal(t, Position{Line: 1, Character: 9}, location.Range.Start)
+}
+
+func TestDefinitionOfBuiltin(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+	c.open("print(\"hi\")\n")
+
+	var location *Location
+	c.at("textDocument/definition", 0, 1, &location)
+	assert.Nil(t, location)
+}
+
+func labels(items []CompletionItem) map[string]CompletionItem {
+	result := map[string]CompletionItem{}
+	for _, item := range items {
+		result[item.Label] = item
+	}
+	return result
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+	c.open("let outer = 1\nfn f(param int) int then\n    let inner = param\n    return inner\nend\nlet later = 2\n")
+
+	items := []CompletionItem{}
+	c.at("textDocument/completion", 3, 4, &items)
+	found := labels(items)
+
+	assert.Contains(t, found, "outer")
+	assert.Contains(t, found, "param")
+	assert.Contains(t, found, "inner")
+	assert.Contains(t, found, "f")
+	assert.Contains(t, found, "print")
+	assert.Contains(t, found, "return")
+	assert.NotContains(t, found, "later", "declared after the cursor")
+	assert.NotContains(t, found, "__keys", "internal builtins are hidden")
+
+	assert.Equal(t, KindFunction, found["f"].Kind)
+	assert.Equal(t, KindVariable, found["outer"].Kind)
+	assert.Equal(t, "int", found["outer"].Detail)
+	assert.Equal(t, KindKeyword, found["return"].Kind)
+
+	items = []CompletionItem{}
+	c.at("textDocument/completion", 5, 0, &items)
+	found = labels(items)
+
+	assert.Contains(t, found, "outer")
+	assert.NotContains(t, found, "param", "not visible outside the function")
+	assert.NotContains(t, found, "inner")
+}
+
+func TestCompletionWhileTyping(t *testing.T) {
+	c := newClient(t)
+	c.initialize()
+	c.open("let count = 1\n\n")
+
+	params := c.change("let count = 1\nlet next = \n")
+	require.NotEmpty(t, params.Diagnostics)
+
+	items := []CompletionItem{}
+	c.at("textDocument/completion", 1, 11, &items)
+	assert.Contains(t, labels(items), "count", "the last version which parsed is used")
+}
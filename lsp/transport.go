@@ -0,0 +1,69 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadMessage reads one message framed by a Content-Length header, other headers are ignored.
+func ReadMessage(r *bufio.Reader) (*Message, error) {
+	length := -1
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("Malformed header '%s'.", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("Invalid Content-Length '%s'.", strings.TrimSpace(value))
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("Message has no Content-Length header.")
+	}
+
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{}
+	err = json.Unmarshal(body, msg)
+	if err != nil {
+		return nil, &ResponseError{Code: codeParseError, Message: fmt.Sprintf("Invalid JSON: %v", err)}
+	}
+
+	return msg, nil
+}
+
+// WriteMessage writes msg with its Content-Length header.
+func WriteMessage(w io.Writer, msg *Message) error {
+	msg.JSONRPC = "2.0"
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
@@ -1,22 +1,221 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/pspiagicw/goreland"
 	"github.com/pspiagicw/tremor/batch"
+	"github.com/pspiagicw/tremor/builtins"
+	"github.com/pspiagicw/tremor/diagnostic"
+	"github.com/pspiagicw/tremor/lsp"
 	"github.com/pspiagicw/tremor/repl"
 )
 
+const usage = `Usage: tremor <command> [flags] [arguments]
+
+Commands:
+  run <file> [args...]  Compile and run a program, the sandbox flags below limit what it can do.
+  check <file>          Parse and typecheck a program without running it.
+  build <file> [-o out] Compile a program into a .tmc file, run it with 'tremor run out.tmc'.
+  disasm <file>         Print the constants and bytecode of a program or a .tmc file.
+  fmt <files...>        Print programs in the canonical layout, --check lists unformatted files, --write rewrites them.
+  repl                  Start the interactive REPL, also the default without a command.
+  lsp                   Start the language server on stdin and stdout, for editors.
+
+Flags:
+  --color=auto|always|never  Color diagnostics, auto colors them on a terminal.
+
+Sandbox flags of run, any of them runs the program in a sandbox:
+  --max-steps=N              Stop after N loop iterations and function calls.
+  --max-depth=N              Stop when function calls nest deeper than N.
+  --max-size=N               Stop when an array, hash or string grows past N elements, entries or bytes.
+  --timeout=DURATION         Stop after DURATION, like 500ms or 2s.
+  --deny=io,exit,env         Leave out the builtins which print, exit or read the arguments.
+`
+
+// fileCommands take a single file.
+var fileCommands = map[string]func(string, *options) int{
+	"check":  func(file string, _ *options) int { return batch.Check(file) },
+	"build":  func(file string, opts *options) int { return batch.Build(file, opts.output) },
+	"disasm": func(file string, _ *options) int { return batch.Disasm(file) },
+}
+
+// options holds the flags of a command.
+type options struct {
+	color  string
+	output string
+	check  bool
+	write  bool
+	// Only set by run, sandboxed is whether any of the sandbox flags was given.
+	sandbox   builtins.Sandbox
+	timeout   time.Duration
+	deny      string
+	sandboxed bool
+}
+
 func main() {
-	if len(os.Args) == 1 {
-		repl.StartREPL()
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		return repl.StartREPL()
+	}
+
+	command, args := args[0], args[1:]
+
+	switch command {
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return batch.ExitOK
+	case "repl":
+		if _, _, ok := parseFlags(command, args); !ok {
+			return batch.ExitUsage
+		}
+		return repl.StartREPL()
+	case "lsp":
+		if _, _, ok := parseFlags(command, args); !ok {
+			return batch.ExitUsage
+		}
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return batch.ExitRuntime
+		}
+		return batch.ExitOK
+	case "fmt":
+		rest, opts, ok := parseFlags(command, args)
+		if !ok {
+			return batch.ExitUsage
+		}
+		if len(rest) == 0 {
+			return usageError("Command 'fmt' expects at least 1 file.")
+		}
+		if opts.check && opts.write {
+			return usageError("Flags --check and --write cannot be used together.")
+		}
+		mode := batch.FormatPrint
+		if opts.check {
+			mode = batch.FormatCheck
+		} else if opts.write {
+			mode = batch.FormatWrite
+		}
+		return batch.Format(rest, mode)
+	case "run":
+		rest, opts, ok := parseFlags(command, args)
+		if !ok {
+			return batch.ExitUsage
+		}
+		if len(rest) == 0 {
+			return usageError("Command 'run' expects a file.")
+		}
+		if !opts.sandboxed {
+			return batch.Run(rest[0], rest[1:])
+		}
+		if err := grantCapabilities(&opts.sandbox, opts.deny); err != nil {
+			return usageError(err.Error())
+		}
+		ctx := context.Background()
+		if opts.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+			defer cancel()
+		}
+		return batch.RunSandboxed(ctx, rest[0], rest[1:], opts.sandbox)
+	}
+
+	exec, ok := fileCommands[command]
+	if !ok {
+		return usageError(fmt.Sprintf("Unknown command '%s'.", command))
+	}
+
+	rest, opts, ok := parseFlags(command, args)
+	if !ok {
+		return batch.ExitUsage
 	}
-	if len(os.Args) != 2 {
-		goreland.LogFatal("Expected 1 arguments program")
+	if len(rest) != 1 {
+		return usageError(fmt.Sprintf("Command '%s' expects 1 file, got %d.", command, len(rest)))
 	}
 
-	program := os.Args[1]
+	return exec(rest[0], opts)
+}
+
+// parseFlags handles the flags of a command and returns the remaining arguments. Flags can come before or after the
+// file, except for run where they stop at the script, so `tremor run script.tm --color` passes `--color` on to it.
+func parseFlags(command string, args []string) ([]string, *options, bool) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+
+	opts := &options{}
+	flags.StringVar(&opts.color, "color", "auto", "Color diagnostics: auto, always or never.")
+	switch command {
+	case "build":
+		flags.StringVar(&opts.output, "o", "", "File to write the compiled program to.")
+	case "fmt":
+		flags.BoolVar(&opts.check, "check", false, "List the files which are not formatted.")
+		flags.BoolVar(&opts.write, "write", false, "Rewrite the files which are not formatted.")
+	case "run":
+		flags.IntVar(&opts.sandbox.Steps, "max-steps", 0, "Loop iterations and function calls the program may make.")
+		flags.IntVar(&opts.sandbox.CallDepth, "max-depth", 0, "How deeply function calls may nest.")
+		flags.IntVar(&opts.sandbox.CollectionSize, "max-size", 0, "Elements, entries or bytes an array, hash or string may hold.")
+		flags.DurationVar(&opts.timeout, "timeout", 0, "How long the program may run.")
+		flags.StringVar(&opts.deny, "deny", "", "Capabilities to take away: io, exit and env.")
+	}
+
+	rest := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, nil, false
+		}
 
-	batch.ExecFile(program)
+		args = flags.Args()
+		if len(args) == 0 || command == "run" {
+			rest = append(rest, args...)
+			break
+		}
+
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+
+	if err := diagnostic.SetColorMode(opts.color); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return nil, nil, false
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		opts.sandboxed = opts.sandboxed || strings.HasPrefix(f.Name, "max-") || f.Name == "timeout" || f.Name == "deny"
+	})
+
+	return rest, opts, true
+}
+
+// grantCapabilities grants the sandbox every capability which deny does not list.
+func grantCapabilities(sandbox *builtins.Sandbox, deny string) error {
+	denied := map[builtins.Capability]bool{}
+	for _, name := range strings.Split(deny, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(builtins.Capabilities, builtins.Capability(name)) {
+			return fmt.Errorf("Unknown capability '%s', expected io, exit or env.", name)
+		}
+		denied[builtins.Capability(name)] = true
+	}
+
+	for _, capability := range builtins.Capabilities {
+		if !denied[capability] {
+			sandbox.Capabilities = append(sandbox.Capabilities, capability)
+		}
+	}
+	return nil
+}
+func usageError(message string) int {
+	fmt.Fprintf(os.Stderr, "%s\n\n%s", message, usage)
+	return batch.ExitUsage
 }
@@ -3,3 +3,4 @@ package parser
 const FAILED_EXPECT_MESSAGE = "Expected token type %s, got %s."
 const FAILED_FUNCTION_MESSAGE = "Expected token %s, got %s."
 const FAILED_PREFIX_MESSAGE = "Cannot parse expression starting with %s."
+const FAILED_ASSIGNMENT_MESSAGE = "Cannot assign to %s."
@@ -324,7 +324,7 @@ func TestPrecedence_MixedComplex(t *testing.T) {
 // 1. Exponentiation precedence
 func TestPrec_Exp1(t *testing.T) {
 	input := "2 ^ 3 ^ 4"
-	expected := "((2 ^ 3) ^ 4)"
+	expected := "(2 ^ (3 ^ 4))"
 	testParser(t, input, expected)
 }
 
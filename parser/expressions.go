@@ -14,11 +14,6 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		return nil
 	}
 
-	if p.peek.Type == token.ASSIGN {
-		// Exceptional case, the expression is actually a assignment statement
-		return p.parseAssignmentStatement()
-	}
-
 	// Should have a advance function automatically in it.
 	left := prefixFn()
 
@@ -38,9 +33,22 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 	}
 
+	if precedence == LOWEST && isAssignmentOperator(p.current.Type) {
+		// Exceptional case, the expression is actually a assignment statement
+		return p.parseAssignmentStatement(left)
+	}
+
 	return left
 }
 
+func isAssignmentOperator(tokentype token.TokenType) bool {
+	switch tokentype {
+	case token.ASSIGN, token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.CONCAT_ASSIGN:
+		return true
+	}
+	return false
+}
+
 func (p *Parser) currentPrecedence() int {
 	val, ok := precedence[p.current.Type]
 
@@ -51,34 +59,17 @@ func (p *Parser) currentPrecedence() int {
 	return LOWEST
 }
 
-func (p *Parser) parseIntegerExpression() ast.Expression {
-	n := &ast.IntegerExpression{
-		Value: p.current.Value,
-	}
-
-	p.advance()
-	return n
-}
-func (p *Parser) parseFloatExpression() ast.Expression {
-	n := &ast.FloatExpression{
-		Value: p.current.Value,
-	}
-
-	p.advance()
-	return n
-}
 func (p *Parser) parseStringExpression() ast.Expression {
-	s := &ast.StringExpression{
-		Value: p.current.Value,
-	}
+	var s *ast.StringExpression
 
 	switch p.current.Type {
 	case token.STRING_DOUBLE:
-		s.Type = ast.DOUBLE_QUOTED
+		s = p.stringPart(p.current, ast.DOUBLE_QUOTED)
 	case token.STRING_SINGLE:
-		s.Type = ast.SINGLE_QUOTED
+		s = p.stringPart(p.current, ast.SINGLE_QUOTED)
 	default:
-		s.Type = ast.MULTILINE
+		// Long strings are raw, a backslash is just a backslash.
+		s = &ast.StringExpression{Value: p.current.Value, Raw: p.current.Value, Type: ast.MULTILINE, Token: p.current}
 	}
 
 	p.advance()
@@ -101,6 +92,14 @@ func (p *Parser) parseBooleanExpression() ast.Expression {
 
 	return b
 }
+func (p *Parser) parseNilExpression() ast.Expression {
+	n := &ast.NilExpression{
+		Token: p.current,
+	}
+	p.advance()
+
+	return n
+}
 func (p *Parser) parseParenthesisExpression() ast.Expression {
 	exp := &ast.ParenthesisExpression{}
 
@@ -108,8 +107,7 @@ func (p *Parser) parseParenthesisExpression() ast.Expression {
 
 	exp.Inside = p.parseExpression(LOWEST)
 
-	// Skip over the ending round brackets.
-	p.advance()
+	p.expect(token.RPAREN)
 
 	return exp
 }
@@ -136,6 +134,11 @@ func (p *Parser) parseBinaryExpression(left ast.Expression) ast.Expression {
 
 	operatorPrecedence := p.currentPrecedence()
 
+	// Exponentiation is right associative, 2 ^ 3 ^ 4 is 2 ^ (3 ^ 4).
+	if operator.Type == token.EXPONENT {
+		operatorPrecedence--
+	}
+
 	p.advance()
 
 	b.Right = p.parseExpression(operatorPrecedence)
@@ -159,9 +162,7 @@ func (p *Parser) parseFunctionCallExpression(left ast.Expression) ast.Expression
 		}
 	}
 
-	// TODO: There should be a expect right here right ?
-	// TODO: Check all parse functions.
-	p.advance()
+	p.expect(token.RPAREN)
 
 	return f
 }
@@ -174,7 +175,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 	i.Index = p.parseExpression(LOWEST)
 
-	p.advance()
+	p.expect(token.RSQUARE)
 
 	return i
 }
@@ -192,10 +193,9 @@ func (p *Parser) parseFieldExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseLambdaExpression() ast.Expression {
+	l := &ast.LambdaExpression{Token: p.current}
 	p.advance() // remove the fn token
 
-	l := &ast.LambdaExpression{}
-
 	p.expect(token.LPAREN)
 
 	l.Args = []*token.Token{}
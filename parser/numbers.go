@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/pspiagicw/tremor/ast"
+	"github.com/pspiagicw/tremor/token"
+)
+
+var bases = map[byte]int{
+	'x': 16,
+	'X': 16,
+	'o': 8,
+	'O': 8,
+	'b': 2,
+	'B': 2,
+}
+
+var baseNames = map[int]string{
+	2:  "binary",
+	8:  "octal",
+	10: "decimal",
+	16: "hexadecimal",
+}
+
+func (p *Parser) parseIntegerExpression() ast.Expression {
+	n := &ast.IntegerExpression{
+		Value:   p.current.Value,
+		Integer: p.integer(p.current),
+		Token:   p.current,
+	}
+
+	p.advance()
+	return n
+}
+func (p *Parser) parseFloatExpression() ast.Expression {
+	n := &ast.FloatExpression{
+		Value: p.current.Value,
+		Float: p.float(p.current),
+		Token: p.current,
+	}
+
+	p.advance()
+	return n
+}
+
+// integer decodes an integer literal, with an optional 0x, 0o or 0b prefix. Malformed literals are reported and decode
+// to 0.
+func (p *Parser) integer(tok *token.Token) int {
+	text, base, start := tok.Value, 10, 0
+	if len(text) > 1 && text[0] == '0' {
+		if prefixed, ok := bases[text[1]]; ok {
+			base, start = prefixed, 2
+		}
+	}
+
+	if !p.digits(tok, start, len(text), base) {
+		return 0
+	}
+
+	value, err := strconv.ParseInt(strings.ReplaceAll(text[start:], "_", ""), base, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		p.registerErrorAt(tok, len(text), "Integer literal '%s' is out of range, integers are 64 bit.", text)
+		return 0
+	}
+
+	return int(value)
+}
+
+// float decodes a float literal like 1.5, 2. or 1_000.5e-3. Malformed literals are reported and decode to 0.
+func (p *Parser) float(tok *token.Token) float32 {
+	text := tok.Value
+
+	mantissa := text
+	exponent := -1
+	if i := strings.IndexAny(text, "eE"); i != -1 {
+		mantissa, exponent = text[:i], i+1
+	}
+
+	whole := len(mantissa)
+	if i := strings.IndexByte(mantissa, '.'); i != -1 {
+		whole = i
+		if j := strings.IndexByte(mantissa[i+1:], '.'); j != -1 {
+			p.registerErrorAt(positionAt(tok, i+1+j), 1, "Number literal '%s' has more than one '.'.", text)
+			return 0
+		}
+	}
+
+	if !p.digits(tok, 0, whole, 10) {
+		return 0
+	}
+	// The fraction can be left out, as in 2.
+	if whole+1 < len(mantissa) && !p.digits(tok, whole+1, len(mantissa), 10) {
+		return 0
+	}
+	if exponent != -1 {
+		if exponent < len(text) && (text[exponent] == '+' || text[exponent] == '-') {
+			exponent++
+		}
+		if !p.digits(tok, exponent, len(text), 10) {
+			return 0
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 32)
+	if errors.Is(err, strconv.ErrRange) {
+		p.registerErrorAt(tok, len(text), "Float literal '%s' is out of range, floats are 32 bit.", text)
+		return 0
+	}
+
+	return float32(value)
+}
+
+// digits checks the digits of a literal between start and end, '_' is allowed between two digits. The first problem is
+// reported at the character which causes it.
+func (p *Parser) digits(tok *token.Token, start int, end int, base int) bool {
+	text := tok.Value
+
+	if start == end {
+		p.registerErrorAt(positionAt(tok, start-1), 1, "Missing digits after '%c' in number literal '%s'.", text[start-1], text)
+		return false
+	}
+
+	for i := start; i < end; i++ {
+		c := text[i]
+		if c == '_' {
+			if i == start || i == end-1 || text[i+1] == '_' {
+				p.registerErrorAt(positionAt(tok, i), 1, "Misplaced '_' in number literal '%s', '_' can only separate digits.", text)
+				return false
+			}
+			continue
+		}
+		if !isDigitOf(c, base) {
+			p.registerErrorAt(positionAt(tok, i), 1, "Invalid digit '%c' in %s literal '%s'.", c, baseNames[base], text)
+			return false
+		}
+	}
+
+	return true
+}
+
+func isDigitOf(c byte, base int) bool {
+	var value int
+	switch {
+	case '0' <= c && c <= '9':
+		value = int(c - '0')
+	case 'a' <= c && c <= 'z':
+		value = int(c-'a') + 10
+	case 'A' <= c && c <= 'Z':
+		value = int(c-'A') + 10
+	default:
+		return false
+	}
+	return value < base
+}
+
+// positionAt returns the location of the index-th byte of a token which does not span lines.
+func positionAt(tok *token.Token, index int) *token.Token {
+	return &token.Token{Type: tok.Type, Offset: tok.Offset + index, Line: tok.Line, Column: tok.Column + index}
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/pspiagicw/tremor/ast"
+	"github.com/pspiagicw/tremor/diagnostic"
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseLiteral(t *testing.T, input string) ast.Expression {
+	p := NewParser(lexer.NewLexer(input))
+	node := p.ParseAST()
+	printParserErrors(t, p)
+
+	require.Len(t, node.Statements, 1)
+	return node.Statements[0].(*ast.ExpressionStatement).Inside
+}
+
+func TestIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{input: "42", expected: 42},
+		{input: "007", expected: 7},
+		{input: "0xFF", expected: 255},
+		{input: "0Xff_ff", expected: 65535},
+		{input: "0o17", expected: 15},
+		{input: "0b1010", expected: 10},
+		{input: "1_000_000", expected: 1000000},
+		{input: "9223372036854775807", expected: 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		integer, ok := parseLiteral(t, tt.input).(*ast.IntegerExpression)
+		require.True(t, ok, tt.input)
+		assert.Equal(t, tt.expected, integer.Integer, tt.input)
+		assert.Equal(t, tt.input, integer.String())
+	}
+}
+
+func TestFloatLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float32
+	}{
+		{input: "3.14", expected: 3.14},
+		{input: "2.", expected: 2},
+		{input: "1e-9", expected: 1e-9},
+		{input: "2.5E+3", expected: 2500},
+		{input: "1_000.000_5", expected: 1000.0005},
+	}
+
+	for _, tt := range tests {
+		float, ok := parseLiteral(t, tt.input).(*ast.FloatExpression)
+		require.True(t, ok, tt.input)
+		assert.Equal(t, tt.expected, float.Float, tt.input)
+		assert.Equal(t, tt.input, float.String())
+	}
+}
+
+func TestInvalidNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		column  int
+		width   int
+	}{
+		{input: "1.2.3", message: "Number literal '1.2.3' has more than one '.'.", column: 4, width: 1},
+		{input: "0xZZ", message: "Invalid digit 'Z' in hexadecimal literal '0xZZ'.", column: 3, width: 1},
+		{input: "0b102", message: "Invalid digit '2' in binary literal '0b102'.", column: 5, width: 1},
+		{input: "0o8", message: "Invalid digit '8' in octal literal '0o8'.", column: 3, width: 1},
+		{input: "12abc", message: "Invalid digit 'a' in decimal literal '12abc'.", column: 3, width: 1},
+		{input: "0x", message: "Missing digits after 'x' in number literal '0x'.", column: 2, width: 1},
+		{input: "1e", message: "Missing digits after 'e' in number literal '1e'.", column: 2, width: 1},
+		{input: "1e+", message: "Missing digits after '+' in number literal '1e+'.", column: 3, width: 1},
+		{input: "1__0", message: "Misplaced '_' in number literal '1__0', '_' can only separate digits.", column: 2, width: 1},
+		{input: "1_", message: "Misplaced '_' in number literal '1_', '_' can only separate digits.", column: 2, width: 1},
+		{input: "0x_1", message: "Misplaced '_' in number literal '0x_1', '_' can only separate digits.", column: 3, width: 1},
+		{input: "1_.5", message: "Misplaced '_' in number literal '1_.5', '_' can only separate digits.", column: 2, width: 1},
+		{input: "9223372036854775808", message: "Integer literal '9223372036854775808' is out of range, integers are 64 bit.", column: 1, width: 19},
+		{input: "0x1_0000_0000_0000_0000", message: "Integer literal '0x1_0000_0000_0000_0000' is out of range, integers are 64 bit.", column: 1, width: 23},
+		{input: "1e39", message: "Float literal '1e39' is out of range, floats are 32 bit.", column: 1, width: 4},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer("let x = " + tt.input))
+		p.ParseAST()
+
+		require.Len(t, p.Errors(), 1, tt.input)
+		d, ok := p.Errors()[0].(*diagnostic.Diagnostic)
+		require.True(t, ok)
+		assert.Equal(t, tt.message, d.Message)
+		assert.Equal(t, 1, d.Span.StartLine)
+		assert.Equal(t, 8+tt.column, d.Span.StartColumn, tt.input)
+		assert.Equal(t, 8+tt.column+tt.width-1, d.Span.EndColumn, tt.input)
+	}
+}
+
+func TestEveryInvalidNumberIsReported(t *testing.T) {
+	testParserErrorCount(t, "let a = 0xG\nlet b = [1.2.3, 0b2]\nlet c = 1..10", 3)
+}
@@ -15,6 +15,7 @@ type Parser struct {
 	lexer            *lexer.Lexer
 	current          *token.Token
 	peek             *token.Token
+	previous         *token.Token
 	prefixParseFnMap map[token.TokenType]prefixParseFn
 	infixParseFnMap  map[token.TokenType]infixParseFn
 	EOF              bool
@@ -32,7 +33,6 @@ func NewParser(l *lexer.Lexer) *Parser {
 		errors:           []ParserError{},
 		info:             []string{},
 		EOF:              false,
-		peek:             l.Next(),
 		source:           l.Source(),
 		file:             l.FileName(),
 	}
@@ -43,10 +43,12 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerPrefixFn(token.NOT, p.parsePrefixExpression)
 	p.registerPrefixFn(token.TRUE, p.parseBooleanExpression)
 	p.registerPrefixFn(token.FALSE, p.parseBooleanExpression)
+	p.registerPrefixFn(token.NIL, p.parseNilExpression)
 	p.registerPrefixFn(token.LPAREN, p.parseParenthesisExpression)
 	p.registerPrefixFn(token.STRING_DOUBLE, p.parseStringExpression)
 	p.registerPrefixFn(token.STRING_SINGLE, p.parseStringExpression)
 	p.registerPrefixFn(token.STRING_MULTILINE, p.parseStringExpression)
+	p.registerPrefixFn(token.INTERPOLATION, p.parseInterpolationExpression)
 	p.registerPrefixFn(token.IDENTIFIER, p.parseIdentifierExpression)
 	p.registerPrefixFn(token.FN, p.parseLambdaExpression)
 	p.registerPrefixFn(token.LSQUARE, p.parseArrayExpression)
@@ -71,6 +73,7 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerInfixFn(token.LTE, p.parseBinaryExpression)
 	p.registerInfixFn(token.GTE, p.parseBinaryExpression)
 
+	p.peek = p.next()
 	p.advance()
 	return p
 }
@@ -87,32 +90,111 @@ type infixParseFn func(ast.Expression) ast.Expression
 
 func (p *Parser) advance() {
 	// p.current = p.lexer.Next()
+	p.previous = p.current
 	p.current = p.peek
-	p.peek = p.lexer.Next()
+	p.peek = p.next()
 
 	if p.current.Type == token.EOF {
 		p.EOF = true
 	}
 }
 
+// next returns the next token from the lexer, invalid characters are skipped since the lexer reported them already.
+func (p *Parser) next() *token.Token {
+	tok := p.lexer.Next()
+	for tok.Type == token.INVALID {
+		tok = p.lexer.Next()
+	}
+	return tok
+}
+
 func (p *Parser) ParseAST() *ast.AST {
 	a := &ast.AST{}
 
 	for !p.EOF {
-		statement := p.parseStatement()
+		statement := p.parseStatementOrRecover()
 
 		if statement != nil {
 			a.Statements = append(a.Statements, statement)
-		} else {
-			p.advance()
 		}
 	}
 
 	return a
 }
 
+// bailout is raised by registerError, it unwinds the parser to the innermost statement being parsed.
+type bailout struct{}
+
+// parseStatementOrRecover parses a statement, on a syntax error the rest of the statement is skipped and nil is
+// returned. Statements with errors are left out of the tree.
+func (p *Parser) parseStatementOrRecover() (statement ast.Statement) {
+	p.try(func() {
+		statement = p.parseStatement()
+	})
+	return statement
+}
+
+// try runs parse and recovers from a syntax error inside it, false is returned after skipping ahead to where parsing
+// can resume.
+func (p *Parser) try(parse func()) (ok bool) {
+	start := p.current
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, isBailout := r.(bailout); !isBailout {
+			panic(r)
+		}
+
+		// Always make progress, the error might be on the very first token.
+		if p.current == start {
+			p.advance()
+		}
+		p.synchronize()
+		ok = false
+	}()
+
+	parse()
+	return true
+}
+
+// synchronize skips tokens until the start of the next statement. Blocks opened by the skipped tokens are skipped as
+// a whole, an `end` closing the enclosing block is left for it.
+func (p *Parser) synchronize() {
+	depth := 0
+
+	for !p.EOF {
+		switch p.current.Type {
+		case token.THEN:
+			depth++
+		case token.END:
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 {
+				p.advance()
+				return
+			}
+		case token.ELSE, token.LET, token.FN, token.IF, token.CLASS, token.WHILE, token.FOR, token.RETURN:
+			if depth == 0 {
+				return
+			}
+		}
+		p.advance()
+	}
+}
+
+// Errors returns the errors of the lexer followed by those of the parser, syntax errors are often caused by the
+// former.
 func (p *Parser) Errors() []ParserError {
-	return p.errors
+	errors := []ParserError{}
+	for _, err := range p.lexer.Errors() {
+		errors = append(errors, err)
+	}
+	return append(errors, p.errors...)
 }
 func (p *Parser) registerError(format string, args ...any) {
 	err := diagnostic.NewAtToken(
@@ -125,6 +207,14 @@ func (p *Parser) registerError(format string, args ...any) {
 		args...,
 	)
 	p.errors = append(p.errors, err)
+
+	panic(bailout{})
+}
+
+// registerErrorAt reports a mistake inside a token which leaves the structure intact, parsing carries on.
+func (p *Parser) registerErrorAt(tok *token.Token, width int, format string, args ...any) {
+	err := diagnostic.NewAtToken("parser", p.file, p.source, tok, width, format, args...)
+	p.errors = append(p.errors, err)
 }
 func (p *Parser) registerInfo(format string, args ...any) {
 	msg := fmt.Sprintf(format, args...)
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/pspiagicw/tremor/ast"
 	"github.com/pspiagicw/tremor/lexer"
 	"github.com/pspiagicw/tremor/token"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestLetStatementError(t *testing.T) {
@@ -24,6 +26,105 @@ func TestStatementError(t *testing.T) {
 	testParserError(t, input, expected)
 }
 
+func TestAssignmentTargetError(t *testing.T) {
+	input := `1 = 2`
+
+	expected := fmt.Sprintf(FAILED_ASSIGNMENT_MESSAGE, "integer-expression")
+
+	testParserError(t, input, expected)
+}
+
+func TestIndependentStatementErrors(t *testing.T) {
+	input := `
+        let a = = 1
+        let b = 2
+        let c int "x"
+        let d = (b
+    `
+
+	testParserErrorCount(t, input, 3)
+}
+
+func TestErrorsInsideFunctionBodies(t *testing.T) {
+	input := `
+        fn f() then
+            let x = = 1
+            let y = 2
+            return y +
+        end
+        fn g() then
+            return )
+        end
+    `
+
+	node := testParserErrorCount(t, input, 3)
+
+	assert.Len(t, node.Statements, 2, "Both functions should be kept.")
+}
+
+func TestBrokenHeaderSkipsBlock(t *testing.T) {
+	input := `
+        if x + then
+            let a = 1
+        end
+        fn h( then
+            let b = 2
+        end
+        let c = 3
+    `
+
+	node := testParserErrorCount(t, input, 2)
+
+	assert.Equal(t, "let c auto = 3", node.String())
+}
+
+func TestErrorsInsideClassBody(t *testing.T) {
+	input := `
+        class Point
+            x int
+            y 5
+            fn norm() int then
+                return self.x +
+            end
+        end
+        let p = 1
+    `
+
+	testParserErrorCount(t, input, 2)
+}
+
+func TestStrayEndError(t *testing.T) {
+	input := `let a = 1 end let b = 2`
+
+	node := testParserErrorCount(t, input, 1)
+
+	assert.Equal(t, "let a auto = 1 let b auto = 2", node.String())
+}
+
+func TestMissingParenthesisError(t *testing.T) {
+	input := `let a = (1 + 2 let b = 3`
+
+	expected := fmt.Sprintf(FAILED_EXPECT_MESSAGE, token.RPAREN, token.LET)
+
+	testParserError(t, input, expected)
+	testParserErrorCount(t, input, 1)
+}
+
+func TestInvalidCharactersAreSkipped(t *testing.T) {
+	input := "let a = 1 # 2\nlet b = a @+ 2"
+
+	node := testParserErrorCount(t, input, 2)
+
+	assert.Equal(t, "let a auto = 1 2 let b auto = (a + 2)", node.String())
+}
+
+func TestLexerErrorsComeFirst(t *testing.T) {
+	input := "let a = (1 + \nlet b = 'open"
+
+	testParserError(t, input, "Unterminated string, expected ''' before the end of the file.")
+	testParserErrorCount(t, input, 2)
+}
+
 // func TestLetStatementTypeError(t *testing.T) {
 // 	input := `let a b = 1`
 //
@@ -33,6 +134,21 @@ func TestStatementError(t *testing.T) {
 //
 // }
 
+func testParserErrorCount(t *testing.T, input string, count int) *ast.AST {
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+
+	node := p.ParseAST()
+
+	if !assert.Len(t, p.Errors(), count, "Wrong number of errors.") {
+		for _, err := range p.Errors() {
+			t.Logf("%q", err.Error())
+		}
+	}
+
+	return node
+}
+
 func testParserError(t *testing.T, input string, message string) {
 	l := lexer.NewLexer(input)
 	p := NewParser(l)
@@ -27,6 +27,30 @@ func TestAssignmentStatement(t *testing.T) {
 	testParser(t, input, input)
 }
 
+func TestIndexAssignmentStatement(t *testing.T) {
+	input := `arr[0] = 1`
+
+	testParser(t, input, input)
+}
+
+func TestHashAssignmentStatement(t *testing.T) {
+	input := `hash["key"] = (1 + 2)`
+
+	testParser(t, input, input)
+}
+
+func TestFieldAssignmentStatement(t *testing.T) {
+	input := `obj.field = 1`
+
+	testParser(t, input, input)
+}
+
+func TestCompoundAssignmentStatement(t *testing.T) {
+	input := `a += 1 b -= 2 arr[i] ..= "x"`
+
+	testParser(t, input, input)
+}
+
 func TestLetStatementWithFloat(t *testing.T) {
 	input := "let a int = 1.5"
 
@@ -148,12 +172,80 @@ func TestClassDeclerationEmpty(t *testing.T) {
 	testParser(t, input, input)
 }
 
+func TestWhileStatement(t *testing.T) {
+	input := `while (i < 10) then i = (i + 1) end`
+
+	testParser(t, input, input)
+}
+
+func TestWhileStatementWithBreakAndContinue(t *testing.T) {
+	input := `while true then if (i > 5) then break else continue end end`
+
+	testParser(t, input, input)
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for x in arr then print(x) end`
+
+	testParser(t, input, input)
+}
+
+func TestForStatementWithTwoVariables(t *testing.T) {
+	input := `for k, v in {"a": 1} then print(k) end`
+
+	testParser(t, input, input)
+}
+
+func TestForStatementWithRange(t *testing.T) {
+	input := `for i in 0..n - 1 then print(i) end`
+
+	expected := `for i in 0..(n - 1) then print(i) end`
+
+	testParser(t, input, expected)
+}
+
 func TestClassDecleration(t *testing.T) {
 	input := `class Animal fn eat() void then print("Eat food!") end fn bark() void then print("Bark") end end`
 
 	testParser(t, input, input)
 }
 
+func TestClassDeclerationWithFields(t *testing.T) {
+	input := `class Point x int y int fn norm() int then return ((self.x * self.x) + (self.y * self.y)) end end`
+
+	testParser(t, input, input)
+}
+
+func TestFunctionStatementWithClassType(t *testing.T) {
+	input := `fn mirror(p Point) Point then return Point(p.y, p.x) end`
+
+	testParser(t, input, input)
+}
+
+func TestMethodCall(t *testing.T) {
+	input := `p.shift(1, 2)`
+
+	testParser(t, input, input)
+}
+
+func TestLetStatementOptional(t *testing.T) {
+	input := `let a ?int = nil`
+
+	testParser(t, input, input)
+}
+
+func TestFunctionStatementOptional(t *testing.T) {
+	input := `fn find(xs []int, x int) ?int then return nil end`
+
+	testParser(t, input, input)
+}
+
+func TestNilComparison(t *testing.T) {
+	input := `if (a != nil) then print(a) end`
+
+	testParser(t, input, input)
+}
+
 func testParser(t *testing.T, input string, expected string) {
 	l := lexer.NewLexer(input)
 	p := NewParser(l)
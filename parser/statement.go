@@ -18,6 +18,14 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseFunctionStatement()
 	case token.CLASS:
 		return p.parseClassStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	default:
 		statement := p.parseExpressionStatement()
 		if statement.Inside == nil {
@@ -30,16 +38,32 @@ func (p *Parser) parseClassStatement() *ast.ClassStatement {
 	p.advance()
 
 	c := &ast.ClassStatement{}
+	c.Fields = []*token.Token{}
+	c.FieldTypes = []*types.Type{}
 	c.Methods = []*ast.FunctionStatement{}
 
 	c.Name = p.expect(token.IDENTIFIER)
 
 	for p.current.Type != token.EOF && p.current.Type != token.END {
-		method := p.parseFunctionStatement()
-		c.Methods = append(c.Methods, method)
+		// A broken member only loses that member.
+		p.try(func() {
+			switch p.current.Type {
+			case token.FN:
+				method := p.parseFunctionStatement()
+				c.Methods = append(c.Methods, method)
+			case token.IDENTIFIER:
+				// Fields are declared as `name type`.
+				field := p.expect(token.IDENTIFIER)
+				fieldType := p.parseTypeDec(false)
+				c.Fields = append(c.Fields, field)
+				c.FieldTypes = append(c.FieldTypes, fieldType)
+			default:
+				p.registerError("Expected a field or method in class %s, got %s.", c.Name.Value, p.current.Type)
+			}
+		})
 	}
 
-	p.expect(token.END)
+	c.End = p.expect(token.END)
 
 	return c
 }
@@ -118,6 +142,14 @@ func (p *Parser) parseTypeDec(auto bool) *types.Type {
 		return p.parseNestedTypeDec()
 	case token.LSQUARE:
 		return p.parseComplexType()
+	case token.QUESTION:
+		p.advance()
+		return types.NewOptionalType(p.parseTypeDec(false))
+	case token.IDENTIFIER:
+		// Refers to a class, the typechecker resolves the name.
+		name := p.current.Value
+		p.advance()
+		return types.NewClassType(name)
 	default:
 		if auto {
 			p.registerInfo("No type info found, using type inference.")
@@ -253,29 +285,100 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 
 	return i
 }
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	p.advance()
+
+	w := &ast.WhileStatement{}
+
+	w.Condition = p.parseExpression(LOWEST)
+
+	p.expect(token.THEN)
+
+	w.Body = p.parseBlockStatement()
+
+	p.expect(token.END)
+
+	return w
+}
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	p.advance()
+
+	f := &ast.ForStatement{}
+
+	f.Variables = []*token.Token{p.expect(token.IDENTIFIER)}
+
+	if p.current.Type == token.COMMA {
+		p.advance()
+		f.Variables = append(f.Variables, p.expect(token.IDENTIFIER))
+	}
+
+	p.expect(token.IN)
+
+	// Parse above concat precedence, so that a '..' here starts a range.
+	f.Iterable = p.parseExpression(CONCAT)
+
+	if p.current.Type == token.CONCAT {
+		p.advance()
+
+		f.Iterable = &ast.RangeExpression{
+			Start: f.Iterable,
+			End:   p.parseExpression(CONCAT),
+		}
+	}
+
+	p.expect(token.THEN)
+
+	f.Body = p.parseBlockStatement()
+
+	p.expect(token.END)
+
+	return f
+}
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	b := &ast.BreakStatement{Token: p.current}
+
+	p.advance()
+
+	return b
+}
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	c := &ast.ContinueStatement{Token: p.current}
+
+	p.advance()
+
+	return c
+}
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	b := &ast.BlockStatement{}
+	b := &ast.BlockStatement{Start: p.previous}
 
 	b.Statements = []ast.Statement{}
 	for p.current.Type != token.EOF &&
 		p.current.Type != token.END &&
 		p.current.Type != token.ELSE {
-		s := p.parseStatement()
-		if s == nil {
-			p.registerError("Could not parse a statement inside this block.")
-			return nil
+		s := p.parseStatementOrRecover()
+		if s != nil {
+			b.Statements = append(b.Statements, s)
 		}
-		b.Statements = append(b.Statements, s)
 	}
 
+	b.End = p.current
+
 	return b
 }
-func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
-	a := &ast.AssignmentStatement{}
+func (p *Parser) parseAssignmentStatement(target ast.Expression) ast.Expression {
+	switch target.(type) {
+	case *ast.IdentifierExpression, *ast.IndexExpression, *ast.FieldExpression:
+	default:
+		p.registerError(FAILED_ASSIGNMENT_MESSAGE, target.TypeInfo())
+		return nil
+	}
 
-	a.Name = p.expect(token.IDENTIFIER)
+	a := &ast.AssignmentStatement{
+		Target:   target,
+		Operator: p.current,
+	}
 
-	p.expect(token.ASSIGN)
+	p.advance()
 
 	a.Value = p.parseExpression(LOWEST)
 
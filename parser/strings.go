@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pspiagicw/tremor/ast"
+	"github.com/pspiagicw/tremor/token"
+)
+
+var escapes = map[byte]string{
+	'n':  "\n",
+	't':  "\t",
+	'r':  "\r",
+	'0':  "\x00",
+	'\\': "\\",
+	'"':  "\"",
+	'\'': "'",
+	'$':  "$",
+}
+
+// stringPart builds a string literal from a quoted token, or from a piece of an interpolated string.
+func (p *Parser) stringPart(tok *token.Token, quote ast.StringType) *ast.StringExpression {
+	return &ast.StringExpression{
+		Value: p.unescape(tok),
+		Raw:   tok.Value,
+		Type:  quote,
+		Token: tok,
+	}
+}
+
+// parseInterpolationExpression parses "a ${x} b" and desugars it into "a " .. str(x) .. " b".
+func (p *Parser) parseInterpolationExpression() ast.Expression {
+	i := &ast.InterpolationExpression{Token: p.current}
+	dollars := []*token.Token{}
+
+	i.Strings = append(i.Strings, p.stringPart(p.current, ast.DOUBLE_QUOTED))
+
+	for p.current.Type == token.INTERPOLATION || p.current.Type == token.INTERPOLATION_MIDDLE {
+		dollars = append(dollars, positionIn(p.current, len(p.current.Value)))
+		p.advance()
+
+		if p.current.Type == token.INTERPOLATION_MIDDLE || p.current.Type == token.INTERPOLATION_END {
+			p.registerError("Expected an expression inside '${}'.")
+		}
+
+		i.Expressions = append(i.Expressions, p.parseExpression(LOWEST))
+
+		if p.current.Type != token.INTERPOLATION_MIDDLE && p.current.Type != token.INTERPOLATION_END {
+			p.registerError("Expected '}' to close the interpolated expression, got %s.", p.current.Type)
+		}
+
+		i.Strings = append(i.Strings, p.stringPart(p.current, ast.DOUBLE_QUOTED))
+	}
+
+	p.advance()
+
+	i.Value = desugarInterpolation(i, dollars)
+
+	return i
+}
+
+// desugarInterpolation concatenates the pieces of an interpolated string, empty strings are left out. The tokens of
+// the generated nodes point at the ${ of their expression.
+func desugarInterpolation(i *ast.InterpolationExpression, dollars []*token.Token) ast.Expression {
+	var value ast.Expression
+
+	concat := func(right ast.Expression, at *token.Token) {
+		if value == nil {
+			value = right
+			return
+		}
+		value = &ast.BinaryExpression{
+			Left:     value,
+			Right:    right,
+			Operator: &token.Token{Type: token.CONCAT, Value: "..", Offset: at.Offset, Line: at.Line, Column: at.Column},
+		}
+	}
+
+	for j, s := range i.Strings {
+		if s.Value != "" {
+			at := i.Token
+			if j > 0 {
+				at = dollars[j-1]
+			}
+			concat(s, at)
+		}
+
+		if j < len(i.Expressions) {
+			at := dollars[j]
+			str := &token.Token{Type: token.IDENTIFIER, Value: "str", Offset: at.Offset, Line: at.Line, Column: at.Column}
+			concat(&ast.FunctionCallExpression{
+				Caller:    &ast.IdentifierExpression{Value: str},
+				Arguments: []ast.Expression{i.Expressions[j]},
+			}, at)
+		}
+	}
+
+	return value
+}
+
+// unescape decodes the escapes in the text of a string token, invalid ones are reported and left out.
+func (p *Parser) unescape(tok *token.Token) string {
+	raw := tok.Value
+	if !strings.Contains(raw, "\\") {
+		return raw
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			b.WriteByte(raw[i])
+			continue
+		}
+
+		if i+1 == len(raw) {
+			p.registerErrorAt(positionIn(tok, i), 1, "Unfinished escape sequence at the end of the string.")
+			break
+		}
+
+		if value, ok := escapes[raw[i+1]]; ok {
+			b.WriteString(value)
+			i++
+			continue
+		}
+
+		if raw[i+1] == 'u' {
+			value, width, ok := unicodeEscape(raw[i:])
+			if !ok {
+				p.registerErrorAt(positionIn(tok, i), width, "Invalid unicode escape '%s', expected \\u{...} with 1 to 6 hex digits of a valid code point.", raw[i:i+width])
+			} else {
+				b.WriteRune(value)
+			}
+			i += width - 1
+			continue
+		}
+
+		// Multibyte characters are reported whole.
+		_, size := utf8.DecodeRuneInString(raw[i+1:])
+		p.registerErrorAt(positionIn(tok, i), 1+size, "Invalid escape sequence '%s'.", raw[i:i+1+size])
+		i += size
+	}
+
+	return b.String()
+}
+
+// unicodeEscape decodes \u{...} at the start of s, width is how much of s the escape takes up.
+func unicodeEscape(s string) (rune, int, bool) {
+	if len(s) < 3 || s[2] != '{' {
+		return 0, 2, false
+	}
+
+	// At most 6 digits, the closing brace is not looked for any further.
+	end := strings.IndexByte(s[:min(len(s), 10)], '}')
+	if end == -1 {
+		return 0, 3, false
+	}
+
+	digits := s[3:end]
+	if len(digits) < 1 || len(digits) > 6 {
+		return 0, end + 1, false
+	}
+
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(value)) {
+		return 0, end + 1, false
+	}
+
+	return rune(value), end + 1, true
+}
+
+// positionIn returns the location of the index-th byte in the text of a string token, which starts after the quote
+// or brace the token begins with.
+func positionIn(tok *token.Token, index int) *token.Token {
+	line, column := tok.Line, tok.Column+1
+
+	for _, c := range []byte(tok.Value[:index]) {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return &token.Token{Type: tok.Type, Offset: tok.Offset + 1 + index, Line: line, Column: column}
+}
@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/pspiagicw/tremor/ast"
+	"github.com/pspiagicw/tremor/diagnostic"
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseString(t *testing.T, input string) *ast.StringExpression {
+	p := NewParser(lexer.NewLexer(input))
+	node := p.ParseAST()
+	printParserErrors(t, p)
+
+	require.Len(t, node.Statements, 1)
+	s, ok := node.Statements[0].(*ast.ExpressionStatement).Inside.(*ast.StringExpression)
+	require.True(t, ok, "Expected a string expression.")
+	return s
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: `"line\n"`, expected: "line\n"},
+		{input: `"a\tb\rc\0"`, expected: "a\tb\rc\x00"},
+		{input: `"back\\slash"`, expected: "back\\slash"},
+		{input: `"say \"hi\""`, expected: "say \"hi\""},
+		{input: `'it\'s'`, expected: "it's"},
+		{input: `"\u{41}\u{e9}\u{1F600}"`, expected: "Aé😀"},
+		{input: `"\${x}"`, expected: "${x}"},
+		{input: `"$ and {}"`, expected: "$ and {}"},
+		{input: "[[raw\\n]]", expected: "raw\\n"},
+	}
+
+	for _, tt := range tests {
+		s := parseString(t, tt.input)
+		assert.Equal(t, tt.expected, s.Value, tt.input)
+	}
+}
+
+func TestStringKeepsRawText(t *testing.T) {
+	s := parseString(t, `"a\tb"`)
+
+	assert.Equal(t, `a\tb`, s.Raw)
+	assert.Equal(t, `"a\tb"`, s.String())
+}
+
+func TestInvalidEscapes(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		column  int
+		width   int
+	}{
+		{input: `"bad \q"`, message: "Invalid escape sequence '\\q'.", column: 6, width: 2},
+		{input: `"\u41"`, message: "Invalid unicode escape '\\u', expected \\u{...} with 1 to 6 hex digits of a valid code point.", column: 2, width: 2},
+		{input: `"x\u{110000}"`, message: "Invalid unicode escape '\\u{110000}', expected \\u{...} with 1 to 6 hex digits of a valid code point.", column: 3, width: 10},
+		{input: `"\u{zz}"`, message: "Invalid unicode escape '\\u{zz}', expected \\u{...} with 1 to 6 hex digits of a valid code point.", column: 2, width: 6},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseAST()
+
+		require.Len(t, p.Errors(), 1, tt.input)
+		d, ok := p.Errors()[0].(*diagnostic.Diagnostic)
+		require.True(t, ok)
+		assert.Equal(t, tt.message, d.Message)
+		assert.Equal(t, 1, d.Span.StartLine)
+		assert.Equal(t, tt.column, d.Span.StartColumn, tt.input)
+		assert.Equal(t, tt.column+tt.width-1, d.Span.EndColumn, tt.input)
+	}
+}
+
+func TestEveryInvalidEscapeIsReported(t *testing.T) {
+	testParserErrorCount(t, "let a = \"\\q \\w\"\nlet b = 'ok\\n'\nlet c = \"\n\\x\"", 3)
+}
+
+func TestInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: `"x = ${x}"`, expected: `("x = " .. str(x))`},
+		{input: `"${x}"`, expected: `str(x)`},
+		{input: `"${a + 1} and ${b}!"`, expected: `(((str((a + 1)) .. " and ") .. str(b)) .. "!")`},
+		{input: `'${f(1, 2)}'`, expected: `str(f(1, 2))`},
+		{input: `"${"in ${x}"}"`, expected: `str(("in " .. str(x)))`},
+		{input: `"${{"k": 1}["k"]}"`, expected: `str({"k": 1}["k"])`},
+	}
+
+	for _, tt := range tests {
+		testParser(t, tt.input, tt.expected)
+	}
+}
+
+func TestInterpolationKeepsItsParts(t *testing.T) {
+	p := NewParser(lexer.NewLexer(`"a\t${x}b"`))
+	node := p.ParseAST()
+	printParserErrors(t, p)
+
+	i, ok := node.Statements[0].(*ast.ExpressionStatement).Inside.(*ast.InterpolationExpression)
+	require.True(t, ok)
+
+	require.Len(t, i.Strings, 2)
+	require.Len(t, i.Expressions, 1)
+	assert.Equal(t, "a\t", i.Strings[0].Value)
+	assert.Equal(t, `a\t`, i.Strings[0].Raw)
+	assert.Equal(t, "b", i.Strings[1].Value)
+	assert.Equal(t, "x", i.Expressions[0].String())
+}
+
+func TestInterpolationErrors(t *testing.T) {
+	testParserError(t, `"${}"`, "Expected an expression inside '${}'.")
+	testParserError(t, `"${x y}"`, "Expected '}' to close the interpolated expression, got IDENTIFIER.")
+	testParserError(t, `"${x`, "Unterminated interpolation, expected '}' before the end of the file.")
+}
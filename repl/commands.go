@@ -0,0 +1,110 @@
+package repl
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pspiagicw/tremor/typechecker"
+)
+
+const help = `:type <expr>       print the type of expr without running it
+:ast <expr>        print the tree expr parses to
+:bytecode <expr>   run expr and print the instructions it compiled to
+:env               list the variables, functions and classes declared so far
+:load <file.tm>    run a file, its declarations stay in the session
+:reset             forget every declaration
+:help              print this list
+:quit              leave the REPL
+`
+
+// command runs a meta command such as :type x, false is returned when the REPL should stop.
+func (s *session) command(input string) bool {
+	input = strings.TrimSpace(input)
+	name, arg := input, ""
+	if i := strings.IndexAny(input, " \t\n"); i != -1 {
+		name, arg = input[:i], strings.TrimSpace(input[i:])
+	}
+
+	switch name {
+	case ":quit", ":q":
+		return false
+	case ":help":
+		fmt.Fprint(s.out, help)
+	case ":reset":
+		*s = *newSession(s.out)
+	case ":env":
+		s.env()
+	case ":type":
+		if s.requireArgument(name, arg, "an expression") {
+			s.typeOf(arg)
+		}
+	case ":ast":
+		if s.requireArgument(name, arg, "an expression") {
+			if tree, ok := s.parse(arg, replFile); ok {
+				fmt.Fprintln(s.out, tree.String())
+			}
+		}
+	case ":bytecode":
+		if s.requireArgument(name, arg, "an expression") {
+			s.eval(arg, replFile, true)
+		}
+	case ":load":
+		if s.requireArgument(name, arg, "a file") {
+			s.load(arg)
+		}
+	default:
+		fmt.Fprintf(s.out, "Unknown command '%s', :help lists the commands.\n", name)
+	}
+
+	// :bytecode and :load run code, which can call exit.
+	return s.exited == nil
+}
+func (s *session) requireArgument(name string, arg string, what string) bool {
+	if arg == "" {
+		fmt.Fprintf(s.out, "%s expects %s.\n", name, what)
+		return false
+	}
+	return true
+}
+
+// typeOf checks an input in a scope of its own, so its declarations are forgotten afterwards.
+func (s *session) typeOf(source string) {
+	tree, ok := s.parse(source, replFile)
+	if !ok {
+		return
+	}
+
+	scope := typechecker.NewEnclosedScope(s.scope)
+	if valueType, ok := s.check(typechecker.NewTypeChecker(), tree, source, replFile, scope); ok {
+		fmt.Fprintln(s.out, valueType)
+	}
+}
+
+// env lists what was declared in the session, builtins are left out.
+func (s *session) env() {
+	symbols := []typechecker.Symbol{}
+	for _, symbol := range s.scope.Visible() {
+		if symbol.Definition != nil {
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Name < symbols[j].Name
+	})
+
+	for _, symbol := range symbols {
+		fmt.Fprintf(s.out, "%s: %s\n", symbol.Name, symbol.Type)
+	}
+}
+func (s *session) load(filename string) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(s.out, "Error reading file: %v\n", err)
+		return
+	}
+
+	s.eval(string(content), filename, false)
+}
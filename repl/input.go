@@ -0,0 +1,66 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/pspiagicw/tremor/token"
+)
+
+const (
+	prompt       = ">>> "
+	continuation = "... "
+)
+
+// readInput reads lines until they form a complete input, ok is false once the input has ended and nothing was read.
+func readInput(reader *bufio.Reader, out io.Writer) (input string, ok bool) {
+	lines := []string{}
+	fmt.Fprint(out, prompt)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			lines = append(lines, strings.TrimRight(line, "\r\n"))
+		}
+
+		if err == io.EOF {
+			// Whatever was typed before the end is still run, its errors are worth seeing.
+			return strings.Join(lines, "\n"), len(lines) != 0
+		}
+		if err != nil {
+			return "", false
+		}
+
+		input = strings.Join(lines, "\n")
+		if !incomplete(input) {
+			return input, true
+		}
+		fmt.Fprint(out, continuation)
+	}
+}
+
+// incomplete tells whether input stops before its end: inside a block with no end yet, inside brackets or inside a
+// string or comment. Input with too many closing tokens is complete, the parser reports it.
+func incomplete(input string) bool {
+	l := lexer.NewLexer(input)
+
+	blocks, brackets := 0, 0
+	for tok := l.Next(); tok.Type != token.EOF; tok = l.Next() {
+		switch tok.Type {
+		// if, while, for and fn open their block with then, classes have none.
+		case token.THEN, token.CLASS:
+			blocks++
+		case token.END:
+			blocks--
+		case token.LPAREN, token.LSQUARE, token.LBRACE:
+			brackets++
+		case token.RPAREN, token.RSQUARE, token.RBRACE:
+			brackets--
+		}
+	}
+
+	return l.Unterminated() || blocks > 0 || brackets > 0
+}
@@ -0,0 +1,38 @@
+package repl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input      string
+		incomplete bool
+	}{
+		{input: "1 + 2", incomplete: false},
+		{input: "fn add(a int, b int) int then", incomplete: true},
+		{input: "fn add(a int, b int) int then\n    return a + b\nend", incomplete: false},
+		{input: "if x then\nelse", incomplete: true},
+		{input: "if x then\nelse\nend", incomplete: false},
+		{input: "class Point\n    x int", incomplete: true},
+		{input: "class Point\n    x int\nend", incomplete: false},
+		{input: "let f fn(int) int = fn(x int) int then", incomplete: true},
+		{input: "print(1,", incomplete: true},
+		{input: "let a = [1, [2", incomplete: true},
+		{input: "let h = {", incomplete: true},
+		{input: "let s = \"open", incomplete: true},
+		{input: "let s = [[long", incomplete: true},
+		{input: "--[[ a comment", incomplete: true},
+		{input: "\"${", incomplete: true},
+		{input: "\"${x}\"", incomplete: false},
+		{input: "let s = \"then (\"", incomplete: false},
+		{input: "end", incomplete: false},
+		{input: "print(1))", incomplete: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.incomplete, incomplete(tt.input), tt.input)
+	}
+}
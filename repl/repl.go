@@ -2,13 +2,18 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"slices"
 	"strings"
 
-	"github.com/pspiagicw/fenc/dump"
+	"github.com/pspiagicw/fenc/code"
+	"github.com/pspiagicw/fenc/emitter"
+	"github.com/pspiagicw/fenc/object"
 	"github.com/pspiagicw/fenc/vm"
+	"github.com/pspiagicw/tremor/ast"
 	"github.com/pspiagicw/tremor/builtins"
 	"github.com/pspiagicw/tremor/compiler"
 	"github.com/pspiagicw/tremor/diagnostic"
@@ -18,91 +23,242 @@ import (
 	"github.com/pspiagicw/tremor/types"
 )
 
-func StartREPL() {
-	debugMode := os.Getenv("TREMOR_DEBUG") == "1"
+const replFile = "<repl>"
 
-	emptyScope := typechecker.NewScope()
-	emptyScope.SetupBuiltinFunctions()
-	t := typechecker.NewTypeChecker()
-	typeMap := t.Map()
-	c := compiler.NewCompiler(typeMap)
-
-	for {
+// StartREPL runs the REPL on the terminal and returns the status the session ended with.
+func StartREPL() int {
+	return Run(os.Stdin, os.Stdout)
+}
 
-		value := getLine()
+// Run reads inputs from in until :quit, a call to exit or the end of in. Input which stops inside a block, brackets or
+// a string is continued on the next line. Prompts, values, output and errors are all written to out. The status is the
+// one given to exit, 0 otherwise.
+func Run(in io.Reader, out io.Writer) int {
+	s := newSession(out)
+	reader := bufio.NewReader(in)
 
-		l := lexer.NewLexerWithFile(value, "<repl>")
-		p := parser.NewParser(l)
-		ast := p.ParseAST()
+	for {
+		input, ok := readInput(reader, out)
+		if !ok {
+			fmt.Fprintln(out)
+			return 0
+		}
 
-		if len(p.Errors()) != 0 {
-			for _, err := range p.Errors() {
-				log.Println(diagnostic.Render(err))
+		if strings.HasPrefix(strings.TrimSpace(input), ":") {
+			if !s.command(input) {
+				return s.status()
 			}
 			continue
 		}
 
-		if debugMode {
-			fmt.Printf("AST: %s\n", ast.String())
+		s.eval(input, replFile, false)
+		if s.exited != nil {
+			return s.status()
 		}
+	}
+}
 
-		t.SetSourceContext("<repl>", value)
-		valueType := t.TypeCheck(ast, emptyScope)
+// session is what the REPL keeps between inputs, :reset starts a new one.
+//
+// A fenc VM does not outlive its run, so the values of the globals are saved at the end of every run and stored back
+// at the start of the next one. The inputs which succeeded are checked and compiled again before each input, which
+// keeps their declarations and the slots of their globals, but their code is skipped and never runs twice. That makes
+// every input cost a compile of the history, running it costs only the input itself. An input which fails is not
+// kept, which takes back whatever it declared and the values it set. Arrays and hashes are shared between runs
+// though, changes made to their contents before the failure stay.
+type session struct {
+	out io.Writer
+	// The inputs which succeeded, in order.
+	inputs []input
+	// The scope after the inputs.
+	scope *typechecker.TypeScope
+	// The values of the globals after the inputs.
+	globals map[string]object.Object
+	// Set once an input calls exit, which ends the session.
+	exited *builtins.Exited
+}
 
-		if len(t.Errors()) != 0 {
-			for _, err := range t.Errors() {
-				log.Println(diagnostic.Render(err))
-			}
-			// Reset typechecker messages.
-			t.Flush()
-			continue
-		}
+type input struct {
+	source string
+	file   string
+}
 
-		if valueType == types.UnknownType {
-			log.Println("Typecheck failed!")
-			continue
-		}
+func newSession(out io.Writer) *session {
+	scope := typechecker.NewScope()
+	scope.SetupBuiltinFunctions()
 
-		if debugMode {
-			fmt.Printf("TYPE: %s\n", valueType)
-		}
+	return &session{out: out, scope: scope, globals: map[string]object.Object{}}
+}
 
-		tm := t.Map()
-		c.SetTypeMap(tm)
-		c.SetSourceContext("<repl>", value)
-		err := c.Compile(ast)
+// eval runs an input and prints its value, with dump the instructions it compiled to are printed first.
+func (s *session) eval(source string, file string, dumpInstructions bool) {
+	tree, ok := s.parse(source, file)
+	if !ok {
+		return
+	}
 
-		if err != nil {
-			log.Printf("Compiler faced errors:\n%s", diagnostic.Render(err))
-			continue
-		}
+	saved := map[string]object.Object{}
+	runtime := builtins.GetBuiltins(s.carry(saved)...)
 
-		bytecode := c.Bytecode()
-		if debugMode {
-			// dump.Constants(bytecode.Constants)
-			dump.Dump(bytecode.Tape)
+	scope, checker, c := s.replay(runtime)
+
+	if _, ok := s.check(checker, tree, source, file, scope); !ok {
+		return
+	}
+
+	entry := len(c.Bytecode().Tape)
+	start, end, err := compileInput(c, checker, tree, source, file)
+	if err != nil {
+		s.report(err)
+		return
+	}
+
+	bytecode := c.Bytecode()
+	if dumpInstructions {
+		// The inputs before this one are in the tape as well, offsets are kept so jumps can be followed.
+		for i := start; i < end; i++ {
+			fmt.Fprintf(s.out, "%04d %s %v\n", i, bytecode.Tape[i].OpCode, bytecode.Tape[i].Args)
 		}
+	}
+
+	builtins.SetOutput(s.out)
+	defer builtins.SetOutput(os.Stdout)
+
+	machine := vm.NewVM(skipHistory(bytecode, entry), runtime)
+	err = builtins.RunVM(machine)
+
+	if errors.As(err, &s.exited) {
+		return
+	}
+	if err != nil {
+		s.report(err)
+		return
+	}
 
-		// fmt.Println("==== OUTPUT === ")
+	s.inputs = append(s.inputs, input{source: source, file: file})
+	s.scope = scope
+	s.globals = saved
+
+	if checker.Map().ResultType(tree) != nil {
+		fmt.Fprintln(s.out, machine.Peek())
+	}
+}
 
-		vm := vm.NewVM(bytecode, builtins.GetBuiltins())
+// replay checks and compiles the inputs which succeeded, they are known to be free of errors. The scope is a new one,
+// the session's own is only replaced once an input succeeds.
+func (s *session) replay(runtime map[string]object.Builtin) (*typechecker.TypeScope, *typechecker.TypeChecker, *compiler.Compiler) {
+	scope := typechecker.NewScope()
+	scope.SetupBuiltinFunctions()
+	checker := typechecker.NewTypeChecker()
+	c := compiler.NewCompilerWithBuiltins(checker.Map(), runtime)
 
-		vm.Run()
+	for _, input := range s.inputs {
+		tree := parser.NewParser(lexer.NewLexerWithFile(input.source, input.file)).ParseAST()
 
-		fmt.Println(vm.Peek())
+		checker.SetSourceContext(input.file, input.source)
+		checker.TypeCheck(tree, scope)
 
-		// fmt.Println("---- ...... --- ")
+		_, _, _ = compileInput(c, checker, tree, input.source, input.file)
 	}
+
+	return scope, checker, c
 }
 
-func getLine() string {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print(">>> ")
-	input, err := reader.ReadString('\n')
+// compileInput compiles a checked input between the code restoring and saving the globals, start and end are where its
+// own code is. Closures saved by an earlier run refer to constants by index, so an input has to compile the same way
+// every time it is replayed.
+func compileInput(c *compiler.Compiler, checker *typechecker.TypeChecker, tree *ast.AST, source string, file string) (int, int, error) {
+	c.SetTypeMap(checker.Map())
+	c.RestoreGlobals(c.Globals(), "__restore")
+
+	c.SetSourceContext(file, source)
+	start := len(c.Bytecode().Tape)
+	err := c.CompileProgram(tree)
 	if err != nil {
-		log.Fatalf("Error reading input: %v", err)
+		return 0, 0, err
+	}
+	end := len(c.Bytecode().Tape)
+
+	c.SaveGlobals("__save")
+	return start, end, nil
+}
+
+// carry returns the builtins a run restores the globals of the session with and saves its own globals into saved.
+func (s *session) carry(saved map[string]object.Object) []builtins.BuiltinDefinition {
+	return []builtins.BuiltinDefinition{
+		{
+			Name:       "__restore",
+			InputType:  []*types.Type{types.StringType},
+			OutputType: types.AnyType,
+			Impl: func(args ...object.Object) object.Object {
+				if value, ok := s.globals[args[0].(object.String).Value]; ok {
+					return value
+				}
+				return object.Null{}
+			},
+		},
+		{
+			Name:       "__save",
+			InputType:  []*types.Type{types.StringType, types.AnyType},
+			OutputType: types.VoidType,
+			Impl: func(args ...object.Object) object.Object {
+				saved[args[0].(object.String).Value] = args[1]
+				return object.Null{}
+			},
+		},
+	}
+}
+
+// skipHistory starts the tape at start, the code of the earlier inputs ran already. Their first instruction is never
+// reached and is replaced by a jump.
+func skipHistory(bytecode emitter.ByteCode, start int) emitter.ByteCode {
+	tape := slices.Clone(bytecode.Tape)
+	if start > 0 {
+		tape[0] = code.Instruction{OpCode: code.JUMP, Args: []int{start}}
+	}
+	return emitter.ByteCode{Tape: tape, Constants: bytecode.Constants}
+}
+
+// check typechecks an input in scope, errors are reported and ok is false. The type is the type of the last
+// statement.
+func (s *session) check(checker *typechecker.TypeChecker, tree *ast.AST, source string, file string, scope *typechecker.TypeScope) (*types.Type, bool) {
+	checker.SetSourceContext(file, source)
+	valueType := checker.TypeCheck(tree, scope)
+
+	if len(checker.Errors()) != 0 {
+		for _, err := range checker.Errors() {
+			s.report(err)
+		}
+		return nil, false
 	}
-	value := strings.TrimSpace(input)
 
-	return value
+	if valueType == types.UnknownType {
+		fmt.Fprintln(s.out, "Typecheck failed!")
+		return nil, false
+	}
+
+	return valueType, true
+}
+
+func (s *session) parse(source string, file string) (*ast.AST, bool) {
+	p := parser.NewParser(lexer.NewLexerWithFile(source, file))
+	tree := p.ParseAST()
+
+	if len(p.Errors()) != 0 {
+		for _, err := range p.Errors() {
+			s.report(err)
+		}
+		return nil, false
+	}
+
+	return tree, true
+}
+func (s *session) status() int {
+	if s.exited == nil {
+		return 0
+	}
+	return s.exited.Status
+}
+func (s *session) report(err error) {
+	fmt.Fprintln(s.out, diagnostic.Render(err))
 }
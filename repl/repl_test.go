@@ -0,0 +1,210 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/tremor/builtins"
+	"github.com/pspiagicw/tremor/diagnostic"
+	"github.com/pspiagicw/tremor/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transcript runs the REPL on input and returns what it printed, without the prompts.
+func transcript(t *testing.T, input string) string {
+	t.Helper()
+	require.NoError(t, diagnostic.SetColorMode("never"))
+	t.Cleanup(func() { diagnostic.SetColorMode("auto") })
+
+	out := &bytes.Buffer{}
+	Run(strings.NewReader(input), out)
+
+	output := strings.ReplaceAll(out.String(), prompt, "")
+	return strings.ReplaceAll(output, continuation, "")
+}
+
+func TestValuesArePrinted(t *testing.T) {
+	output := transcript(t, "1 + 2\n\"a\" .. \"b\"\nlet x = 1\nprint(\"hi\")\n")
+
+	assert.Equal(t, "3\n\"ab\"\n\"hi\"\n\n", output)
+}
+
+func TestDeclarationsPersist(t *testing.T) {
+	input := `let x = 5
+x + 1
+fn twice(n int) int then
+    return n * 2
+end
+twice(x)
+x = 7
+twice(x)
+`
+	output := transcript(t, input)
+
+	assert.Equal(t, "6\n10\n14\n\n", output)
+}
+
+func TestOutputIsNotRepeated(t *testing.T) {
+	output := transcript(t, "print(\"once\")\nlet x = 1\nprint(x)\n")
+
+	assert.Equal(t, "\"once\"\n1\n\n", output)
+}
+
+func TestFailedTypecheckIsRolledBack(t *testing.T) {
+	input := `let ok = 1
+let bad int = "x"
+bad
+let bad = 2
+bad + ok
+`
+	output := transcript(t, input)
+
+	assert.Contains(t, output, "Declared type mismatch")
+	assert.Contains(t, output, "Symbol 'bad' is not declared in this scope.")
+	assert.True(t, strings.HasSuffix(output, "3\n\n"), output)
+}
+
+func TestEveryDeclarationOfAFailedInputIsRolledBack(t *testing.T) {
+	input := `let first = 1 let second string = 2
+first
+second
+`
+	output := transcript(t, input)
+
+	assert.Contains(t, output, "Symbol 'first' is not declared in this scope.")
+	assert.Contains(t, output, "Symbol 'second' is not declared in this scope.")
+}
+
+func TestRuntimeErrorIsRolledBack(t *testing.T) {
+	input := `let x = 1
+print("before")
+let y = x / 0
+y
+x
+`
+	output := transcript(t, input)
+
+	assert.Contains(t, output, "Division by zero.")
+	assert.Contains(t, output, "Symbol 'y' is not declared in this scope.")
+	// The output of the failed input is shown once, the session goes on without it.
+	assert.Equal(t, 1, strings.Count(output, "before"))
+	assert.True(t, strings.HasSuffix(output, "1\n\n"), output)
+}
+
+func TestEarlierInputsDoNotRunAgain(t *testing.T) {
+	calls := 0
+	original := builtins.Builtins
+	builtins.Builtins = append(slices.Clip(original), builtins.BuiltinDefinition{
+		Name:       "tick",
+		InputType:  []*types.Type{},
+		OutputType: types.IntType,
+		Impl: func(args ...object.Object) object.Object {
+			calls++
+			return object.CreateInt(calls)
+		},
+	})
+	t.Cleanup(func() { builtins.Builtins = original })
+
+	output := transcript(t, "let first = tick()\nlet add = fn(n int) int then return n + first end\nadd(1)\nfirst\n")
+
+	assert.Equal(t, "2\n1\n\n", output)
+	assert.Equal(t, 1, calls)
+}
+
+func TestFailedInputKeepsEarlierValues(t *testing.T) {
+	output := transcript(t, "let x = 1\nx = 2 let y = x / 0\nx\n")
+
+	assert.Contains(t, output, "Division by zero.")
+	assert.True(t, strings.HasSuffix(output, "1\n\n"), output)
+}
+
+func TestMultilineInput(t *testing.T) {
+	input := `let numbers = [
+    1,
+    2
+]
+fn sum(values []int) int then
+    let total = 0
+    for v in values then
+        total += v
+    end
+    return total
+end
+sum(numbers)
+let s = "two
+lines"
+len(s)
+`
+	output := transcript(t, input)
+
+	assert.Equal(t, "3\n9\n\n", output)
+}
+
+func TestMetaCommands(t *testing.T) {
+	input := `let x = 1
+:type x + 1.5
+:type let y = "a"
+:ast 1 + 2 * 3
+:env
+y
+:nope
+:type
+`
+	output := transcript(t, input)
+
+	assert.Contains(t, output, "float\n")
+	assert.Contains(t, output, "(1 + (2 * 3))\n")
+	assert.Contains(t, output, "x: int\n")
+	assert.NotContains(t, output, "print:", "builtins are left out")
+	assert.Contains(t, output, "Symbol 'y' is not declared in this scope.", ":type does not declare anything")
+	assert.Contains(t, output, "Unknown command ':nope', :help lists the commands.")
+	assert.Contains(t, output, ":type expects an expression.")
+}
+
+func TestBytecodeCommand(t *testing.T) {
+	output := transcript(t, "let x = 1\n:bytecode x + 2\n")
+
+	assert.Contains(t, output, "ADD_INT")
+	assert.True(t, strings.HasSuffix(output, "3\n\n"), output)
+}
+
+func TestLoadAndReset(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib.tm")
+	require.NoError(t, os.WriteFile(file, []byte("fn square(n int) int then\n    return n * n\nend\n"), 0o644))
+
+	output := transcript(t, ":load "+file+"\nsquare(4)\n:reset\nsquare(4)\n:load missing.tm\n")
+
+	assert.Contains(t, output, "16\n")
+	assert.Contains(t, output, "Function 'square' is not declared in this scope.")
+	assert.Contains(t, output, "Error reading file:")
+}
+
+func TestExitEndsTheSession(t *testing.T) {
+	require.NoError(t, diagnostic.SetColorMode("never"))
+	t.Cleanup(func() { diagnostic.SetColorMode("auto") })
+
+	out := &bytes.Buffer{}
+	status := Run(strings.NewReader("print(1)\nprint(2) exit(3)\nprint(4)\n"), out)
+
+	assert.Equal(t, 3, status)
+	assert.Equal(t, ">>> 1\n>>> 2\n", out.String())
+
+	file := filepath.Join(t.TempDir(), "done.tm")
+	require.NoError(t, os.WriteFile(file, []byte("exit()\n"), 0o644))
+
+	out.Reset()
+	assert.Equal(t, 0, Run(strings.NewReader(":load "+file+"\n1\n"), out))
+	assert.Equal(t, ">>> ", out.String())
+}
+
+func TestQuit(t *testing.T) {
+	output := transcript(t, "1\n:quit\n2\n")
+
+	assert.Equal(t, "1\n", output)
+}
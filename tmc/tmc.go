@@ -0,0 +1,387 @@
+// Package tmc reads and writes compiled tremor programs, .tmc files run without going through the frontend again.
+//
+// A file starts with the magic bytes and a format version, followed by the name and SHA-256 hash of the source, the
+// builtin table the program was compiled against, the constants, the tape and the line tables. Integers are varints, strings are
+// length prefixed and compiled functions are written inline with their own instructions.
+package tmc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/pspiagicw/fenc/code"
+	"github.com/pspiagicw/fenc/emitter"
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/tremor/lines"
+)
+
+// Version is bumped whenever the layout changes, files of any other version are rejected.
+const Version = 2
+
+var magic = []byte("TMC\x00")
+
+var ErrNotTMC = errors.New("Not a compiled tremor file.")
+
+// Constant tags.
+const (
+	tagInt byte = iota + 1
+	tagFloat
+	tagString
+	tagBool
+	tagNull
+	tagFunction
+	tagClass
+)
+
+type File struct {
+	// Name of the source file the program was compiled from.
+	Source string
+	// SHA-256 of the source, used to notice a .tmc which is older than its source.
+	Hash [sha256.Size]byte
+	// Sorted names of the builtins, LOAD_BUILTIN refers to them by index.
+	Builtins []string
+	Bytecode emitter.ByteCode
+	// Maps instructions back to the source for runtime errors, nil when the file has none.
+	Lines *lines.Table
+}
+
+// NewFile wraps compiled bytecode with the details of its source.
+func NewFile(source string, code string, bytecode emitter.ByteCode, builtins map[string]object.Builtin) *File {
+	return &File{
+		Source:   source,
+		Hash:     sha256.Sum256([]byte(code)),
+		Builtins: BuiltinNames(builtins),
+		Bytecode: bytecode,
+	}
+}
+
+// BuiltinNames returns the names of the builtins in the order the emitter indexes them.
+func BuiltinNames(builtins map[string]object.Builtin) []string {
+	names := []string{}
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsStale reports whether code is not the source the file was compiled from.
+func (f *File) IsStale(code string) bool {
+	return sha256.Sum256([]byte(code)) != f.Hash
+}
+
+// CheckBuiltins returns an error when the file was compiled against a different set of builtins, the indices on the
+// tape would call the wrong functions.
+func (f *File) CheckBuiltins(builtins map[string]object.Builtin) error {
+	current := BuiltinNames(builtins)
+
+	if len(current) != len(f.Builtins) {
+		return fmt.Errorf("Compiled with %d builtins, the runtime has %d; rebuild the program.", len(f.Builtins), len(current))
+	}
+
+	for i, name := range f.Builtins {
+		if current[i] != name {
+			return fmt.Errorf("Compiled with builtin '%s' which the runtime does not have; rebuild the program.", name)
+		}
+	}
+
+	return nil
+}
+
+func Write(w io.Writer, f *File) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+
+	e.bytes(magic)
+	e.uint(Version)
+	e.string(f.Source)
+	e.bytes(f.Hash[:])
+
+	e.uint(uint64(len(f.Builtins)))
+	for _, name := range f.Builtins {
+		e.string(name)
+	}
+
+	e.uint(uint64(len(f.Bytecode.Constants)))
+	for _, constant := range f.Bytecode.Constants {
+		e.object(constant)
+	}
+
+	e.tape(f.Bytecode.Tape)
+
+	table := f.Lines
+	if table == nil {
+		table = &lines.Table{}
+	}
+	e.lines(table.Main)
+	e.uint(uint64(len(table.Functions)))
+	for _, function := range table.Functions {
+		e.lines(function)
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+
+	return e.w.Flush()
+}
+
+func Read(r io.Reader) (*File, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	header := d.bytes(len(magic))
+	if d.err != nil || !bytes.Equal(header, magic) {
+		return nil, ErrNotTMC
+	}
+
+	version := d.uint()
+	if d.err == nil && version != Version {
+		return nil, fmt.Errorf("Unsupported .tmc version %d, expected %d; rebuild the program.", version, Version)
+	}
+
+	f := &File{}
+	f.Source = d.string()
+	copy(f.Hash[:], d.bytes(sha256.Size))
+
+	for range d.count() {
+		if d.err != nil {
+			break
+		}
+		f.Builtins = append(f.Builtins, d.string())
+	}
+
+	for range d.count() {
+		if d.err != nil {
+			break
+		}
+		f.Bytecode.Constants = append(f.Bytecode.Constants, d.object())
+	}
+
+	f.Bytecode.Tape = d.tape()
+
+	f.Lines = &lines.Table{Main: d.lines()}
+	for range d.count() {
+		if d.err != nil {
+			break
+		}
+		f.Lines.Functions = append(f.Lines.Functions, d.lines())
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("Corrupt .tmc file: %v", d.err)
+	}
+
+	return f, nil
+}
+
+// encoder remembers the first error, so a whole file is written before checking.
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+func (e *encoder) uint(v uint64) {
+	e.bytes(binary.AppendUvarint(nil, v))
+}
+func (e *encoder) int(v int64) {
+	e.bytes(binary.AppendVarint(nil, v))
+}
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.bytes([]byte(s))
+}
+func (e *encoder) tape(tape []code.Instruction) {
+	e.uint(uint64(len(tape)))
+	for _, ins := range tape {
+		e.string(string(ins.OpCode))
+		e.uint(uint64(len(ins.Args)))
+		for _, arg := range ins.Args {
+			e.int(int64(arg))
+		}
+	}
+}
+func (e *encoder) lines(entries lines.Lines) {
+	e.uint(uint64(len(entries)))
+	for _, line := range entries {
+		e.uint(uint64(line.Offset))
+		e.uint(uint64(line.Line))
+		e.uint(uint64(line.Column))
+		e.uint(uint64(line.Width))
+	}
+}
+func (e *encoder) object(o object.Object) {
+	switch o := o.(type) {
+	case object.Int:
+		e.bytes([]byte{tagInt})
+		e.int(int64(o.Value))
+	case object.Float:
+		e.bytes([]byte{tagFloat})
+		e.uint(uint64(math.Float32bits(o.Value)))
+	case object.String:
+		e.bytes([]byte{tagString})
+		e.string(o.Value)
+	case object.Bool:
+		value := byte(0)
+		if o.Value {
+			value = 1
+		}
+		e.bytes([]byte{tagBool, value})
+	case object.Null:
+		e.bytes([]byte{tagNull})
+	case *object.CompiledFunction:
+		e.bytes([]byte{tagFunction})
+		e.string(o.Name)
+		e.uint(uint64(o.NumLocals))
+		e.uint(uint64(o.NumParams))
+		e.tape(o.Instructions)
+	case object.Class:
+		e.bytes([]byte{tagClass})
+		e.string(o.Name)
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("Cannot serialize constant of type %s.", o.Type())
+		}
+	}
+}
+
+// decoder remembers the first error, later reads return zero values.
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if d.err == nil {
+		d.err = err
+	}
+}
+func (d *decoder) bytes(n int) []byte {
+	b := make([]byte, n)
+	if d.err != nil {
+		return b
+	}
+	_, err := io.ReadFull(d.r, b)
+	if err != nil {
+		d.fail(err)
+	}
+	return b
+}
+func (d *decoder) byte() byte {
+	return d.bytes(1)[0]
+}
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+// count reads the length of a list or string.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > math.MaxInt32 {
+		d.fail(fmt.Errorf("length %d is too large", n))
+		return 0
+	}
+	return int(n)
+}
+func (d *decoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+
+	// Copied rather than allocated upfront, a corrupt length fails at the end of the input.
+	var b bytes.Buffer
+	_, err := io.CopyN(&b, d.r, int64(n))
+	if err != nil {
+		d.fail(err)
+	}
+	return b.String()
+}
+func (d *decoder) tape() []code.Instruction {
+	var tape []code.Instruction
+
+	for range d.count() {
+		if d.err != nil {
+			break
+		}
+
+		ins := code.Instruction{OpCode: code.Op(d.string())}
+		for range d.count() {
+			if d.err != nil {
+				break
+			}
+			ins.Args = append(ins.Args, int(d.int()))
+		}
+		tape = append(tape, ins)
+	}
+
+	return tape
+}
+func (d *decoder) lines() lines.Lines {
+	var entries lines.Lines
+
+	for range d.count() {
+		if d.err != nil {
+			break
+		}
+		entries = append(entries, lines.Line{Offset: d.count(), Line: d.count(), Column: d.count(), Width: d.count()})
+	}
+
+	return entries
+}
+func (d *decoder) object() object.Object {
+	switch tag := d.byte(); tag {
+	case tagInt:
+		return object.Int{Value: int(d.int())}
+	case tagFloat:
+		return object.Float{Value: math.Float32frombits(uint32(d.uint()))}
+	case tagString:
+		return object.String{Value: d.string()}
+	case tagBool:
+		return object.Bool{Value: d.byte() == 1}
+	case tagNull:
+		return object.Null{}
+	case tagFunction:
+		fn := &object.CompiledFunction{}
+		fn.Name = d.string()
+		fn.NumLocals = d.count()
+		fn.NumParams = d.count()
+		fn.Instructions = d.tape()
+		return fn
+	case tagClass:
+		return object.Class{Name: d.string()}
+	default:
+		d.fail(fmt.Errorf("unknown constant tag %d", tag))
+		return object.Null{}
+	}
+}
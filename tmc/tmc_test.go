@@ -0,0 +1,147 @@
+package tmc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/tremor/builtins"
+	"github.com/pspiagicw/tremor/compiler"
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/pspiagicw/tremor/parser"
+	"github.com/pspiagicw/tremor/typechecker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTripLiterals(t *testing.T) {
+	input := `
+    let a = 1 + 2
+    let b = 2.5 * 4.0
+    let c = "hello" .. " world"
+    let d = not true
+    let e ?int = nil
+    let f = [1, 2, 3]
+    let g = {"one": 1}
+    `
+
+	testRoundTrip(t, input)
+}
+
+func TestRoundTripFunctions(t *testing.T) {
+	input := `
+    fn fib(n int) int then
+        if n < 2 then
+            return n
+        end
+        return fib(n - 1) + fib(n - 2)
+    end
+    let add = fn(a int, b int) int then
+        return a + b
+    end
+    let total = add(fib(10), -3)
+    `
+
+	testRoundTrip(t, input)
+}
+
+func TestRoundTripClasses(t *testing.T) {
+	input := `
+    class Point
+        x int
+        y int
+        fn sum() int then
+            return self.x + self.y
+        end
+    end
+    let p = Point(1, 2)
+    let s = p.sum()
+    `
+
+	testRoundTrip(t, input)
+}
+
+func TestRejectsOtherFiles(t *testing.T) {
+	_, err := Read(bytes.NewReader([]byte("let a = 1")))
+	assert.ErrorIs(t, err, ErrNotTMC)
+
+	_, err = Read(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrNotTMC)
+}
+
+func TestRejectsOtherVersions(t *testing.T) {
+	data := writeFile(t, compile(t, `let a = 1`))
+	// The version follows the magic bytes.
+	data[len(magic)] = Version + 1
+
+	_, err := Read(bytes.NewReader(data))
+	assert.EqualError(t, err, "Unsupported .tmc version 3, expected 2; rebuild the program.")
+}
+
+func TestRejectsTruncatedFiles(t *testing.T) {
+	data := writeFile(t, compile(t, `let a = "hello"`))
+
+	for _, size := range []int{len(magic) + 1, len(data) / 2, len(data) - 1} {
+		_, err := Read(bytes.NewReader(data[:size]))
+		assert.Error(t, err, "Expected an error when reading %d of %d bytes.", size, len(data))
+	}
+}
+
+func TestBuiltinsMismatch(t *testing.T) {
+	f := compile(t, `print(1)`)
+
+	assert.NoError(t, f.CheckBuiltins(builtins.GetBuiltins()))
+
+	changed := builtins.GetBuiltins()
+	changed["extra"] = object.Builtin{}
+	assert.Error(t, f.CheckBuiltins(changed))
+}
+
+func TestStaleSource(t *testing.T) {
+	f := compile(t, `let a = 1`)
+
+	assert.False(t, f.IsStale(`let a = 1`))
+	assert.True(t, f.IsStale(`let a = 2`))
+}
+
+func testRoundTrip(t *testing.T, input string) {
+	original := compile(t, input)
+
+	got, err := Read(bytes.NewReader(writeFile(t, original)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, original.Source, got.Source)
+	assert.Equal(t, original.Hash, got.Hash)
+	assert.Equal(t, original.Builtins, got.Builtins)
+	assert.Equal(t, original.Bytecode, got.Bytecode)
+	assert.Equal(t, original.Lines, got.Lines)
+}
+
+func writeFile(t *testing.T, f *File) []byte {
+	var buf bytes.Buffer
+	err := Write(&buf, f)
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func compile(t *testing.T, input string) *File {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	tc := typechecker.NewTypeChecker()
+
+	ast := p.ParseAST()
+	assert.Empty(t, p.Errors(), "Parser has errors!")
+
+	scope := typechecker.NewScope()
+	scope.SetupBuiltinFunctions()
+
+	_ = tc.TypeCheck(ast, scope)
+	assert.Empty(t, tc.Errors(), "Type Checker has errors!")
+
+	c := compiler.NewCompiler(tc.Map())
+	err := c.Compile(ast)
+	assert.NoError(t, err)
+
+	f := NewFile("program.tm", input, c.Bytecode(), builtins.GetBuiltins())
+	f.Lines = c.LineTable()
+	return f
+}
@@ -23,6 +23,7 @@ const (
 	EXPONENT = "EXPONENT"
 	COMMA    = "COMMA"
 	COLON    = "COLON"
+	QUESTION = "QUESTION"
 
 	EQ  = "EQ"
 	NEQ = "NEQ"
@@ -33,6 +34,10 @@ const (
 	GT     = "GT"
 	ASSIGN = "ASSIGN"
 
+	PLUS_ASSIGN   = "PLUS_ASSIGN"
+	MINUS_ASSIGN  = "MINUS_ASSIGN"
+	CONCAT_ASSIGN = "CONCAT_ASSIGN"
+
 	LPAREN  = "LPAREN"
 	RPAREN  = "RPAREN"
 	LBRACE  = "LBRACE"
@@ -51,6 +56,12 @@ const (
 	END    = "END"
 	LET    = "LET"
 
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+
 	NIL   = "NIL"
 	TRUE  = "TRUE"
 	FALSE = "FALSE"
@@ -69,5 +80,14 @@ const (
 	STRING_SINGLE    = "STRING_SINGLE"
 	STRING_MULTILINE = "STRING_MULTILINE"
 
+	// "a ${x} b ${y} c" lexes as INTERPOLATION("a "), x, INTERPOLATION_MIDDLE(" b "), y, INTERPOLATION_END(" c").
+	// The text after an expression starts at its closing brace.
+	INTERPOLATION        = "INTERPOLATION"
+	INTERPOLATION_MIDDLE = "INTERPOLATION_MIDDLE"
+	INTERPOLATION_END    = "INTERPOLATION_END"
+
 	TYPE = "TYPE"
+
+	// Comments never reach the parser, the lexer keeps them aside for tools like the formatter.
+	COMMENT = "COMMENT"
 )
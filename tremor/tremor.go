@@ -0,0 +1,228 @@
+// Package tremor embeds tremor in Go programs.
+//
+// A Runtime compiles source into a Program and runs it. Host functions registered on the runtime can be called from
+// tremor like any builtin, they are typechecked against the signature they were registered with.
+//
+//	r := tremor.New()
+//	r.Register(builtins.BuiltinDefinition{
+//		Name:       "double",
+//		InputType:  []*types.Type{types.IntType},
+//		OutputType: types.IntType,
+//		Impl: func(args ...object.Object) object.Object {
+//			return object.CreateInt(args[0].(object.Int).Value * 2)
+//		},
+//	})
+//	value, err := r.Eval("double(21)") // 42
+package tremor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pspiagicw/fenc/emitter"
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/fenc/vm"
+	"github.com/pspiagicw/tremor/builtins"
+	"github.com/pspiagicw/tremor/compiler"
+	"github.com/pspiagicw/tremor/diagnostic"
+	"github.com/pspiagicw/tremor/lexer"
+	"github.com/pspiagicw/tremor/lines"
+	"github.com/pspiagicw/tremor/parser"
+	"github.com/pspiagicw/tremor/token"
+	"github.com/pspiagicw/tremor/typechecker"
+)
+
+const evalFile = "<eval>"
+
+// Runtime compiles and runs tremor with the builtins and the host functions registered on it.
+type Runtime struct {
+	hosts []builtins.BuiltinDefinition
+	// nil when programs run without limits.
+	sandbox *builtins.Sandbox
+}
+
+func New() *Runtime {
+	return &Runtime{}
+}
+
+// NewSandboxed returns a runtime for untrusted source, its programs run within the limits of sandbox and can only
+// call the builtins and host functions whose capability it grants.
+func NewSandboxed(sandbox builtins.Sandbox) *Runtime {
+	return &Runtime{sandbox: &sandbox}
+}
+
+// Program is compiled tremor, it can be run any number of times.
+type Program struct {
+	bytecode emitter.ByteCode
+	lines    *lines.Table
+	name     string
+	source   string
+	// The builtins the program was compiled against, host functions registered later are not in it.
+	definitions []builtins.BuiltinDefinition
+	sandbox     *builtins.Sandbox
+	// Whether the program ends with a value Run returns.
+	hasValue bool
+}
+
+// Error lists what went wrong compiling or running a program, in source order.
+type Error struct {
+	Diagnostics []*diagnostic.Diagnostic
+}
+
+func (e *Error) Error() string {
+	messages := []string{}
+	for _, d := range e.Diagnostics {
+		messages = append(messages, d.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Register adds a host function, programs compiled afterwards can call it. Its name must be an identifier which is not
+// taken by a builtin or another host function.
+func (r *Runtime) Register(function builtins.BuiltinDefinition) error {
+	if !isIdentifier(function.Name) || strings.HasPrefix(function.Name, "__") {
+		return fmt.Errorf("Invalid host function name '%s'.", function.Name)
+	}
+	if _, ok := builtins.GetBuiltins(r.hosts...)[function.Name]; ok {
+		return fmt.Errorf("Function '%s' is already defined.", function.Name)
+	}
+	if function.Impl == nil || function.OutputType == nil {
+		return fmt.Errorf("Host function '%s' needs an implementation and an output type.", function.Name)
+	}
+	for _, input := range function.InputType {
+		if input == nil {
+			return fmt.Errorf("Host function '%s' has an argument without a type.", function.Name)
+		}
+	}
+
+	r.hosts = append(r.hosts, function)
+	return nil
+}
+
+// RegisterFunc adds an ordinary Go function as a host function, see builtins.FromFunc for the functions it accepts.
+func (r *Runtime) RegisterFunc(name string, fn any) error {
+	function, err := builtins.FromFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	return r.Register(function)
+}
+func isIdentifier(name string) bool {
+	l := lexer.NewLexer(name)
+	return l.Next().Type == token.IDENTIFIER && l.Next().Type == token.EOF
+}
+
+// Compile parses, typechecks and compiles source, name is the file name diagnostics refer to. Every syntax or type
+// error is returned in an *Error.
+func (r *Runtime) Compile(source string, name string) (*Program, error) {
+	p := parser.NewParser(lexer.NewLexerWithFile(source, name))
+	tree := p.ParseAST()
+
+	if len(p.Errors()) != 0 {
+		return nil, newError(p.Errors(), name, source)
+	}
+
+	definitions := append(slices.Clip(builtins.Builtins), r.hosts...)
+	if r.sandbox != nil {
+		definitions = r.sandbox.Granted(definitions)
+	}
+
+	scope := typechecker.NewScope()
+	scope.DeclareBuiltins(definitions)
+	checker := typechecker.NewTypeChecker()
+	checker.SetSourceContext(name, source)
+	checker.TypeCheck(tree, scope)
+
+	if len(checker.Errors()) != 0 {
+		return nil, newError(checker.Errors(), name, source)
+	}
+
+	program := &Program{
+		name:        name,
+		source:      source,
+		definitions: definitions,
+		sandbox:     r.sandbox,
+		hasValue:    checker.Map().ResultType(tree) != nil,
+	}
+
+	c := compiler.NewCompilerWithBuiltins(checker.Map(), program.builtinMap(context.Background()))
+	c.SetSourceContext(name, source)
+	c.SetSandboxed(r.sandbox != nil)
+	err := c.CompileProgram(tree)
+	if err != nil {
+		return nil, newError([]error{err}, name, source)
+	}
+
+	program.bytecode = c.Bytecode()
+	program.lines = c.LineTable()
+
+	return program, nil
+}
+
+// Run runs a program and returns the value it ends with as a Go value, nil when it ends with a statement. A runtime
+// error is returned in an *Error, a call to exit as a *builtins.Exited.
+func (r *Runtime) Run(program *Program) (any, error) {
+	return r.RunContext(context.Background(), program)
+}
+
+// RunContext is Run, a sandboxed program stops with a runtime error once ctx is done. Programs of a runtime without a
+// sandbox do not watch ctx.
+func (r *Runtime) RunContext(ctx context.Context, program *Program) (any, error) {
+	machine := vm.NewVM(program.bytecode, program.builtinMap(ctx))
+
+	err := builtins.RunVM(machine)
+
+	// The program chose to stop, which is not a failure of it. The host decides what the status means.
+	var exited *builtins.Exited
+	if errors.As(err, &exited) {
+		return nil, exited
+	}
+	if err != nil {
+		d := compiler.RuntimeError(err, program.bytecode, program.lines, program.name, program.source)
+		return nil, &Error{Diagnostics: []*diagnostic.Diagnostic{d}}
+	}
+
+	if !program.hasValue {
+		return nil, nil
+	}
+	return toGo(machine.Peek())
+}
+
+// Eval compiles and runs source, see Compile and Run.
+func (r *Runtime) Eval(source string) (any, error) {
+	return r.EvalContext(context.Background(), source)
+}
+
+// EvalContext compiles and runs source, see Compile and RunContext.
+func (r *Runtime) EvalContext(ctx context.Context, source string) (any, error) {
+	program, err := r.Compile(source, evalFile)
+	if err != nil {
+		return nil, err
+	}
+	return r.RunContext(ctx, program)
+}
+
+// builtinMap returns the builtins of a run, a sandbox needs new guards for every run.
+func (p *Program) builtinMap(ctx context.Context) map[string]object.Builtin {
+	if p.sandbox == nil {
+		return builtins.Map(p.definitions)
+	}
+	return p.sandbox.Map(ctx, p.definitions)
+}
+
+// newError collects the errors of a stage, errors without a location are given the file they came from.
+func newError[E error](errs []E, name string, source string) *Error {
+	result := &Error{}
+	for _, err := range errs {
+		d, ok := any(err).(*diagnostic.Diagnostic)
+		if !ok {
+			d = diagnostic.New("tremor", name, source, "%s", err.Error())
+		}
+		result.Diagnostics = append(result.Diagnostics, d)
+	}
+	diagnostic.Sort(result.Diagnostics)
+	return result
+}
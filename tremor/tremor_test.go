@@ -0,0 +1,347 @@
+package tremor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pspiagicw/fenc/object"
+	"github.com/pspiagicw/tremor/builtins"
+	"github.com/pspiagicw/tremor/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func double() builtins.BuiltinDefinition {
+	return builtins.BuiltinDefinition{
+		Name:       "double",
+		InputType:  []*types.Type{types.IntType},
+		OutputType: types.IntType,
+		Impl: func(args ...object.Object) object.Object {
+			return object.CreateInt(args[0].(object.Int).Value * 2)
+		},
+	}
+}
+
+func TestEvalValues(t *testing.T) {
+	tests := []struct {
+		source string
+		value  any
+	}{
+		{source: "1 + 2", value: 3},
+		{source: "1.5 * 2.0", value: float32(3)},
+		{source: "\"a\" .. \"b\"", value: "ab"},
+		{source: "1 < 2", value: true},
+		{source: "[1, 2, 3]", value: []any{1, 2, 3}},
+		{source: "{\"a\": 1}", value: map[any]any{"a": 1}},
+		{source: "let x = 1", value: nil},
+		{source: "fn add(a int, b int) int then\n    return a + b\nend\nadd(2, 3)", value: 5},
+	}
+
+	r := New()
+	for _, tt := range tests {
+		value, err := r.Eval(tt.source)
+		require.NoError(t, err, tt.source)
+		assert.Equal(t, tt.value, value, tt.source)
+	}
+}
+
+func TestCompileErrorsAreDiagnostics(t *testing.T) {
+	_, err := New().Compile("let a int = \"x\"\nlet b string = 1", "main.tm")
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	require.Len(t, e.Diagnostics, 2)
+	assert.Equal(t, "main.tm", e.Diagnostics[0].File)
+	assert.Equal(t, 1, e.Diagnostics[0].Span.StartLine)
+	assert.Equal(t, 2, e.Diagnostics[1].Span.StartLine)
+
+	_, err = New().Eval("let = 1")
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "parser", e.Diagnostics[0].Stage)
+}
+
+func TestRuntimeErrorHasASpan(t *testing.T) {
+	r := New()
+	program, err := r.Compile("let x = 0\nlet y = 1 / x", "div.tm")
+	require.NoError(t, err)
+
+	_, err = r.Run(program)
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	require.Len(t, e.Diagnostics, 1)
+	assert.Contains(t, e.Diagnostics[0].Message, "Division by zero.")
+	require.NotNil(t, e.Diagnostics[0].Span)
+	assert.Equal(t, 2, e.Diagnostics[0].Span.StartLine)
+}
+
+func TestProgramRunsMoreThanOnce(t *testing.T) {
+	r := New()
+	program, err := r.Compile("let a = [1, 2]\na[1] = 3\na", "twice.tm")
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		value, err := r.Run(program)
+		require.NoError(t, err)
+		assert.Equal(t, []any{1, 3}, value)
+	}
+}
+
+func TestHostFunctions(t *testing.T) {
+	r := New()
+	require.NoError(t, r.Register(double()))
+
+	value, err := r.Eval("double(21)")
+	require.NoError(t, err)
+	assert.Equal(t, 42, value)
+
+	_, err = r.Eval("double(\"x\")")
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "typechecker", e.Diagnostics[0].Stage)
+
+	_, err = New().Eval("double(21)")
+	assert.Error(t, err, "host functions belong to the runtime they were registered on")
+}
+
+func TestHostFunctionErrors(t *testing.T) {
+	r := New()
+	require.NoError(t, r.Register(builtins.BuiltinDefinition{
+		Name:       "fail",
+		InputType:  []*types.Type{},
+		OutputType: types.IntType,
+		Impl: func(args ...object.Object) object.Object {
+			return object.Error{Message: "Host failure."}
+		},
+	}))
+
+	_, err := r.Eval("let x = 1\nfail()")
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Contains(t, e.Diagnostics[0].Message, "Host failure.")
+}
+
+func TestHostFunctionPanics(t *testing.T) {
+	r := New()
+	require.NoError(t, r.Register(builtins.BuiltinDefinition{
+		Name:       "boom",
+		InputType:  []*types.Type{},
+		OutputType: types.IntType,
+		Impl: func(args ...object.Object) object.Object {
+			panic("host bug")
+		},
+	}))
+
+	_, err := r.Eval("boom()")
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "runtime", e.Diagnostics[0].Stage)
+	assert.Equal(t, "Program crashed: host bug.", e.Diagnostics[0].Message)
+}
+
+func TestCompilerPanicIsAnError(t *testing.T) {
+	// The statement after return is never typechecked.
+	_, err := New().Compile("fn f() int then\n    return 1\n    print(zzz)\nend", "dead.tm")
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Contains(t, e.Diagnostics[0].Message, "Internal compiler error")
+}
+
+func TestRegisterErrors(t *testing.T) {
+	r := New()
+	require.NoError(t, r.Register(double()))
+
+	tests := []struct {
+		definition builtins.BuiltinDefinition
+		message    string
+	}{
+		{definition: double(), message: "Function 'double' is already defined."},
+		{definition: builtins.BuiltinDefinition{Name: "print", OutputType: types.VoidType, Impl: double().Impl}, message: "Function 'print' is already defined."},
+		{definition: builtins.BuiltinDefinition{Name: "two words"}, message: "Invalid host function name 'two words'."},
+		{definition: builtins.BuiltinDefinition{Name: "if"}, message: "Invalid host function name 'if'."},
+		{definition: builtins.BuiltinDefinition{Name: "__hidden"}, message: "Invalid host function name '__hidden'."},
+		{definition: builtins.BuiltinDefinition{Name: "noop", OutputType: types.VoidType}, message: "Host function 'noop' needs an implementation and an output type."},
+		{definition: builtins.BuiltinDefinition{Name: "noop", InputType: []*types.Type{nil}, OutputType: types.VoidType, Impl: double().Impl}, message: "Host function 'noop' has an argument without a type."},
+	}
+
+	for _, tt := range tests {
+		assert.EqualError(t, r.Register(tt.definition), tt.message)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	r := New()
+	require.NoError(t, r.RegisterFunc("repeat", strings.Repeat))
+	require.NoError(t, r.RegisterFunc("evens", func(values []int) []int {
+		result := []int{}
+		for _, v := range values {
+			if v%2 == 0 {
+				result = append(result, v)
+			}
+		}
+		return result
+	}))
+	require.NoError(t, r.RegisterFunc("lookup", func(table map[string]int, key string) (int, error) {
+		value, ok := table[key]
+		if !ok {
+			return 0, fmt.Errorf("No key '%s'.", key)
+		}
+		return value, nil
+	}))
+
+	value, err := r.Eval("repeat(\"ab\", 3)")
+	require.NoError(t, err)
+	assert.Equal(t, "ababab", value)
+
+	value, err = r.Eval("evens([1, 2, 3, 4])")
+	require.NoError(t, err)
+	assert.Equal(t, []any{2, 4}, value)
+
+	value, err = r.Eval("lookup({\"a\": 1}, \"a\")")
+	require.NoError(t, err)
+	assert.Equal(t, 1, value)
+
+	_, err = r.Eval("lookup({\"a\": 1}, \"b\")")
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Contains(t, e.Diagnostics[0].Message, "No key 'b'.")
+
+	_, err = r.Eval("repeat(3, \"ab\")")
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "typechecker", e.Diagnostics[0].Stage)
+
+	assert.EqualError(t, r.RegisterFunc("bad", func(c chan int) {}), "Builtin 'bad' argument 1: Go type chan int has no tremor type.")
+}
+
+func TestExit(t *testing.T) {
+	_, err := New().Eval("let x = 1\nexit(x + 1)\nx")
+
+	var exited *builtins.Exited
+	require.True(t, errors.As(err, &exited))
+	assert.Equal(t, 2, exited.Status)
+}
+
+func TestSandboxLimits(t *testing.T) {
+	sandbox := builtins.Sandbox{Steps: 100, CallDepth: 10, CollectionSize: 8, Capabilities: builtins.Capabilities}
+
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{source: "let i = 0\nwhile true then\n    i += 1\nend", message: "Step limit of 100 exceeded."},
+		{source: "for i in 0..1000 then\nend", message: "Step limit of 100 exceeded."},
+		{source: "fn down(n int) int then\n    return down(n + 1)\nend\ndown(0)", message: "Call depth limit of 10 exceeded."},
+		{source: "let s = \"\"\nfor i in 0..20 then\n    s ..= \"ab\"\nend", message: "String of 10 bytes exceeds the collection size limit of 8."},
+		{source: "let h = {\"a\": 0}\nfor i in 0..20 then\n    h[str(i)] = i\nend", message: "Hash of 9 entries exceeds the collection size limit of 8."},
+		{source: "repeat(\"abc\", 3)", message: "String of 9 bytes exceeds the collection size limit of 8."},
+		{source: "let xs = [0]\nfor i in 0..20 then\n    xs = push(xs, i)\nend", message: "Array of 9 elements exceeds the collection size limit of 8."},
+		{source: "fn down(n int) int then\n    return reduce([n], fn(total int, x int) int then return down(x) end, 0)\nend\ndown(0)", message: "Call depth limit of 10 exceeded."},
+	}
+
+	for _, tt := range tests {
+		r := NewSandboxed(sandbox)
+		require.NoError(t, r.RegisterFunc("repeat", strings.Repeat))
+
+		_, err := r.Eval(tt.source)
+
+		var e *Error
+		require.True(t, errors.As(err, &e), tt.source)
+		assert.Equal(t, "runtime", e.Diagnostics[0].Stage, tt.source)
+		assert.Equal(t, tt.message, e.Diagnostics[0].Message, tt.source)
+		assert.NotNil(t, e.Diagnostics[0].Span, tt.source)
+	}
+}
+
+func TestSandboxWithinLimits(t *testing.T) {
+	r := NewSandboxed(builtins.Sandbox{Steps: 100, CallDepth: 3, CollectionSize: 8})
+	program, err := r.Compile(`fn fib(n int) int then
+    if n < 2 then
+        return n
+    end
+    let a = 0
+    let b = 1
+    for i in 1..n then
+        let next = a + b
+        a = b
+        b = next
+    end
+    return b
+end
+let h = {"a": 1}
+h["b"] = 2
+fib(10) + len(h)`, "fib.tm")
+	require.NoError(t, err)
+
+	// Every run starts with a fresh budget.
+	for i := 0; i < 3; i++ {
+		value, err := r.Run(program)
+		require.NoError(t, err)
+		assert.Equal(t, 57, value)
+	}
+}
+
+func TestSandboxHigherOrderBuiltins(t *testing.T) {
+	r := NewSandboxed(builtins.Sandbox{Steps: 100, CallDepth: 3, CollectionSize: 8})
+
+	value, err := r.Eval(`reduce(map([1, 2, 3], fn(x int) int then return x * 2 end), fn(total int, x int) int then return total + x end, 0)`)
+	require.NoError(t, err)
+	assert.Equal(t, 12, value)
+}
+
+func TestSandboxPanicsAreErrors(t *testing.T) {
+	r := NewSandboxed(builtins.Sandbox{Steps: 100})
+	require.NoError(t, r.RegisterFunc("boom", func() int { panic("host bug") }))
+
+	for _, source := range []string{"boom()", "let h = {\"a\": 1}\nh[\"b\"] += 1"} {
+		_, err := r.Eval(source)
+
+		var e *Error
+		require.True(t, errors.As(err, &e), source)
+		assert.Equal(t, "runtime", e.Diagnostics[0].Stage, source)
+	}
+}
+
+func TestSandboxContext(t *testing.T) {
+	r := NewSandboxed(builtins.Sandbox{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := r.EvalContext(ctx, "while true then\nend")
+	assert.ErrorContains(t, err, "Program stopped: context deadline exceeded.")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = r.EvalContext(ctx, "fn f() int then\n    return 1\nend\nf()")
+	assert.ErrorContains(t, err, "Program stopped: context canceled.")
+}
+
+func TestSandboxCapabilities(t *testing.T) {
+	r := NewSandboxed(builtins.Sandbox{Capabilities: []builtins.Capability{builtins.Env}})
+	require.NoError(t, r.Register(builtins.BuiltinDefinition{
+		Name:       "save",
+		InputType:  []*types.Type{types.StringType},
+		OutputType: types.VoidType,
+		Impl:       func(args ...object.Object) object.Object { return object.Null{} },
+		Capability: builtins.IO,
+	}))
+
+	for _, source := range []string{"print(1)", "exit()", "save(\"x\")"} {
+		_, err := r.Eval(source)
+
+		var e *Error
+		require.True(t, errors.As(err, &e), source)
+		assert.Equal(t, "typechecker", e.Diagnostics[0].Stage, source)
+		assert.Contains(t, e.Diagnostics[0].Message, "is not declared in this scope.", source)
+	}
+
+	value, err := r.Eval("len(args())")
+	require.NoError(t, err)
+	assert.Equal(t, 0, value)
+}
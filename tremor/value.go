@@ -0,0 +1,50 @@
+package tremor
+
+import (
+	"fmt"
+
+	"github.com/pspiagicw/fenc/object"
+)
+
+// toGo converts a value of the VM to the Go value it holds. Arrays become []any and hashes map[any]any, functions and
+// classes have no Go counterpart.
+func toGo(value object.Object) (any, error) {
+	switch value := value.(type) {
+	case object.Int:
+		return value.Value, nil
+	case object.Float:
+		return value.Value, nil
+	case object.String:
+		return value.Value, nil
+	case object.Bool:
+		return value.Value, nil
+	case object.Null, nil:
+		return nil, nil
+	case object.Array:
+		values := []any{}
+		for _, element := range value.Values {
+			converted, err := toGo(element)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, converted)
+		}
+		return values, nil
+	case object.Hash:
+		values := map[any]any{}
+		for k, v := range value.Values {
+			key, err := toGo(k)
+			if err != nil {
+				return nil, err
+			}
+			converted, err := toGo(v)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = converted
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("Cannot convert a %s to a Go value.", value.Type())
+	}
+}
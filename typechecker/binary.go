@@ -14,6 +14,8 @@ var binaryResolvers = map[token.TokenType]typeResolver{
 	token.MINUS:    resolveArithmetic,
 	token.MULTIPLY: resolveArithmetic,
 	token.SLASH:    resolveArithmetic,
+	token.MODULUS:  resolveModulus,
+	token.EXPONENT: resolveArithmetic,
 	token.EQ:       resolveComparison,
 	token.NEQ:      resolveComparison,
 	token.LT:       resolveComparison,
@@ -25,6 +27,13 @@ var binaryResolvers = map[token.TokenType]typeResolver{
 	token.CONCAT:   resolveString,
 }
 
+// Compound assignments are typed like the binary operator they expand to.
+var compoundOperators = map[token.TokenType]token.TokenType{
+	token.PLUS_ASSIGN:   token.PLUS,
+	token.MINUS_ASSIGN:  token.MINUS,
+	token.CONCAT_ASSIGN: token.CONCAT,
+}
+
 func resolveString(left, right *types.Type) (*types.Type, error) {
 	if left == types.StringType && right == types.StringType {
 		return types.StringType, nil
@@ -43,6 +52,13 @@ func resolveArithmetic(left, right *types.Type) (*types.Type, error) {
 
 	return types.UnknownType, fmt.Errorf("invalid operands for arithmetic: %s, %s", left, right)
 }
+func resolveModulus(left, right *types.Type) (*types.Type, error) {
+	if left == types.IntType && right == types.IntType {
+		return types.IntType, nil
+	}
+
+	return types.UnknownType, fmt.Errorf("modulo requires int operands, got %s and %s", left, right)
+}
 func resolveComparison(left, right *types.Type) (*types.Type, error) {
 
 	// Confirm left and right are either int or float, nothing else.
@@ -2,24 +2,48 @@ package typechecker
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/pspiagicw/tremor/builtins"
+	"github.com/pspiagicw/tremor/token"
 	"github.com/pspiagicw/tremor/types"
 )
 
 type TypeScope struct {
 	symbols map[string]*types.Type
+	// Optionals known to be non-nil here, they take precedence over symbols.
+	narrowed map[string]*types.Type
+	// Where symbols were declared, builtins have no entry.
+	definitions map[string]*token.Token
+	// Names declared by DeclareBuiltins.
+	builtins map[string]bool
 
 	Outer *TypeScope
 }
 
-func (t *TypeScope) SetupBuiltinFunctions() {
-	for _, builtin := range builtins.Builtins {
+// SetupBuiltinFunctions declares the builtins, along with extra functions provided by a host program.
+func (t *TypeScope) SetupBuiltinFunctions(extra ...builtins.BuiltinDefinition) {
+	t.DeclareBuiltins(append(slices.Clip(builtins.Builtins), extra...))
+}
+
+// DeclareBuiltins declares exactly definitions, a sandbox leaves out the builtins it does not grant.
+func (t *TypeScope) DeclareBuiltins(definitions []builtins.BuiltinDefinition) {
+	for _, builtin := range definitions {
 		functiontype := types.NewFunctionType(builtin.InputType, builtin.OutputType)
-		t.Add(builtin.Name, functiontype)
+		if t.Add(builtin.Name, functiontype) == nil {
+			t.builtins[builtin.Name] = true
+		}
 	}
 }
 
+// IsBuiltin reports whether name refers to a builtin, they cannot be shadowed.
+func (t *TypeScope) IsBuiltin(name string) bool {
+	if t.builtins[name] {
+		return true
+	}
+	return t.Outer != nil && t.Outer.IsBuiltin(name)
+}
+
 func (t *TypeScope) Add(name string, nodetype *types.Type) error {
 	if val, ok := t.symbolExists(name); ok {
 		return fmt.Errorf("Symbol '%s', already declared with type '%s'", name, val)
@@ -28,14 +52,117 @@ func (t *TypeScope) Add(name string, nodetype *types.Type) error {
 	return nil
 }
 
-func (t *TypeScope) Get(name string) *types.Type {
+// Define adds a symbol declared at tok, tools can then find its declaration.
+func (t *TypeScope) Define(name string, nodetype *types.Type, tok *token.Token) error {
+	err := t.Add(name, nodetype)
+	if err != nil {
+		return err
+	}
+	t.definitions[name] = tok
+	return nil
+}
+
+// Shadow adds a symbol which can hide one declared in an outer scope, loop variables are declared this way. Builtins
+// still cannot be hidden.
+func (t *TypeScope) Shadow(name string, nodetype *types.Type, tok *token.Token) error {
+	val, ok := t.symbols[name]
+	if !ok && t.IsBuiltin(name) {
+		val, ok = t.Get(name), true
+	}
+	if ok {
+		return fmt.Errorf("Symbol '%s', already declared with type '%s'", name, val)
+	}
+
+	t.symbols[name] = nodetype
+	t.definitions[name] = tok
+	return nil
+}
+
+// Definition returns the token a symbol was declared at, nil for builtins and undeclared names.
+func (t *TypeScope) Definition(name string) *token.Token {
+	if _, ok := t.symbols[name]; ok {
+		return t.definitions[name]
+	}
+
+	if t.Outer != nil {
+		return t.Outer.Definition(name)
+	}
+
+	return nil
+}
+
+// Symbol is a name visible in a scope.
+type Symbol struct {
+	Name       string
+	Type       *types.Type
+	Definition *token.Token
+}
+
+// Visible returns every symbol which can be referred to from this scope, inner declarations hide outer ones.
+func (t *TypeScope) Visible() []Symbol {
+	seen := map[string]bool{}
+	symbols := []Symbol{}
+
+	for scope := t; scope != nil; scope = scope.Outer {
+		for name := range scope.symbols {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			symbols = append(symbols, Symbol{Name: name, Type: t.Get(name), Definition: scope.definitions[name]})
+		}
+	}
+
+	return symbols
+}
+
+// Poison declares a symbol whose declaration failed to type check. It has an unknown type, so uses of it fail quietly
+// instead of reporting that it is not declared.
+func (t *TypeScope) Poison(name string) {
+	if _, ok := t.symbolExists(name); ok {
+		return
+	}
+	t.symbols[name] = types.UnknownType
+}
+
+// IsPoisoned reports whether name was declared by a failed declaration.
+func (t *TypeScope) IsPoisoned(name string) bool {
 	val, ok := t.symbolExists(name)
+	return ok && val == types.UnknownType
+}
+
+// Narrow refines the type of a declared variable within this scope, used after a nil check.
+func (t *TypeScope) Narrow(name string, nodetype *types.Type) {
+	t.narrowed[name] = nodetype
+}
 
-	if !ok {
-		return types.UnknownType
+// Declared returns the type a variable was declared with, ignoring any narrowing.
+func (t *TypeScope) Declared(name string) *types.Type {
+	if val, ok := t.symbols[name]; ok {
+		return val
+	}
+
+	if t.Outer != nil {
+		return t.Outer.Declared(name)
+	}
+
+	return types.UnknownType
+}
+
+func (t *TypeScope) Get(name string) *types.Type {
+	if val, ok := t.narrowed[name]; ok {
+		return val
+	}
+
+	if val, ok := t.symbols[name]; ok {
+		return val
+	}
+
+	if t.Outer != nil {
+		return t.Outer.Get(name)
 	}
 
-	return val
+	return types.UnknownType
 }
 
 func (t *TypeScope) symbolExists(name string) (*types.Type, bool) {
@@ -54,7 +181,10 @@ func (t *TypeScope) symbolExists(name string) (*types.Type, bool) {
 
 func NewEnclosedScope(outer *TypeScope) *TypeScope {
 	s := &TypeScope{
-		symbols: map[string]*types.Type{},
+		symbols:     map[string]*types.Type{},
+		narrowed:    map[string]*types.Type{},
+		definitions: map[string]*token.Token{},
+		builtins:    map[string]bool{},
 	}
 
 	s.Outer = outer
@@ -63,8 +193,11 @@ func NewEnclosedScope(outer *TypeScope) *TypeScope {
 }
 func NewScope() *TypeScope {
 	s := &TypeScope{
-		symbols: map[string]*types.Type{},
-		Outer:   nil,
+		symbols:     map[string]*types.Type{},
+		narrowed:    map[string]*types.Type{},
+		definitions: map[string]*token.Token{},
+		builtins:    map[string]bool{},
+		Outer:       nil,
 	}
 
 	return s
@@ -2,6 +2,7 @@ package typechecker
 
 import (
 	"fmt"
+	"maps"
 	"reflect"
 
 	"github.com/pspiagicw/tremor/ast"
@@ -14,12 +15,52 @@ type TypeError error
 
 type TypeMap map[ast.Node]*types.Type
 
+// ResultType returns the type of the value a program ends with, the value of its last statement when that is an
+// expression which leaves one behind. It is nil otherwise.
+func (t TypeMap) ResultType(tree *ast.AST) *types.Type {
+	if len(tree.Statements) == 0 {
+		return nil
+	}
+
+	statement, ok := tree.Statements[len(tree.Statements)-1].(*ast.ExpressionStatement)
+	if !ok {
+		return nil
+	}
+	// Assignments leave nothing behind.
+	if _, ok := statement.Inside.(*ast.AssignmentStatement); ok {
+		return nil
+	}
+
+	valueType, ok := t[statement.Inside]
+	if !ok || valueType == types.VoidType || valueType == types.UnknownType {
+		return nil
+	}
+	return valueType
+}
+
 type TypeChecker struct {
 	errors  []TypeError
 	info    []string
 	typeMap TypeMap
 	source  string
 	file    string
+	// Number of loops enclosing the current statement, break and continue need atleast one.
+	loopDepth int
+	// Number of function statement bodies enclosing the current statement, they run once called so they can refer to
+	// functions defined later. A lambda outside them cannot, the compiler only reserves globals for function statements.
+	functionDepth int
+	// Top-level functions are declared before any statement is checked, so they can call each other.
+	declared map[*ast.FunctionStatement]bool
+	// Declared functions whose definition has not been reached, top-level code cannot call them yet.
+	pending map[string]bool
+	// The top-level functions and classes each top-level function refers to, calling it can run them as well.
+	references map[string][]string
+	// Classes declared so far, type annotations refer to them by name.
+	classes         map[string]*types.Type
+	declaredClasses map[*ast.ClassStatement]bool
+	// Where the symbol of each identifier was declared, and the scope each block was checked in. Used by tools.
+	definitions map[*ast.IdentifierExpression]*token.Token
+	scopes      map[*ast.BlockStatement]*TypeScope
 }
 
 func (t *TypeChecker) Flush() {
@@ -28,10 +69,17 @@ func (t *TypeChecker) Flush() {
 
 func NewTypeChecker() *TypeChecker {
 	t := &TypeChecker{
-		errors:  []TypeError{},
-		info:    []string{},
-		typeMap: make(map[ast.Node]*types.Type),
-		file:    "<input>",
+		errors:          []TypeError{},
+		info:            []string{},
+		typeMap:         make(map[ast.Node]*types.Type),
+		file:            "<input>",
+		declared:        map[*ast.FunctionStatement]bool{},
+		pending:         map[string]bool{},
+		references:      map[string][]string{},
+		classes:         map[string]*types.Type{},
+		declaredClasses: map[*ast.ClassStatement]bool{},
+		definitions:     map[*ast.IdentifierExpression]*token.Token{},
+		scopes:          map[*ast.BlockStatement]*TypeScope{},
 	}
 
 	return t
@@ -41,6 +89,22 @@ func (t *TypeChecker) Map() TypeMap {
 	return t.typeMap
 }
 
+// Definitions maps identifiers to the token their symbol was declared at, builtins are left out.
+func (t *TypeChecker) Definitions() map[*ast.IdentifierExpression]*token.Token {
+	return t.definitions
+}
+
+// Scopes returns the scope each block was checked in.
+func (t *TypeChecker) Scopes() map[*ast.BlockStatement]*TypeScope {
+	return t.scopes
+}
+
+func (t *TypeChecker) recordDefinition(node *ast.IdentifierExpression, scope *TypeScope) {
+	if tok := scope.Definition(node.Value.Value); tok != nil {
+		t.definitions[node] = tok
+	}
+}
+
 func (t *TypeChecker) SetSourceContext(file string, source string) {
 	if file == "" {
 		file = "<input>"
@@ -64,8 +128,12 @@ func (t *TypeChecker) TypeCheck(node ast.Node, scope *TypeScope) *types.Type {
 		nodeType = types.FloatType
 	case *ast.StringExpression:
 		nodeType = types.StringType
+	case *ast.InterpolationExpression:
+		nodeType = t.TypeCheck(node.Value, scope)
 	case *ast.BooleanExpression:
 		nodeType = types.BoolType
+	case *ast.NilExpression:
+		nodeType = types.NilType
 	case *ast.LetStatement:
 		nodeType = t.typeLetStatement(node, scope)
 	case *ast.ReturnStatement:
@@ -96,6 +164,18 @@ func (t *TypeChecker) TypeCheck(node ast.Node, scope *TypeScope) *types.Type {
 		nodeType = t.typeIndexExpression(node, scope)
 	case *ast.ClassStatement:
 		nodeType = t.typeClassStatement(node, scope)
+	case *ast.FieldExpression:
+		nodeType = t.typeFieldExpression(node, scope)
+	case *ast.WhileStatement:
+		nodeType = t.typeWhileStatement(node, scope)
+	case *ast.ForStatement:
+		nodeType = t.typeForStatement(node, scope)
+	case *ast.RangeExpression:
+		nodeType = t.typeRangeExpression(node, scope)
+	case *ast.BreakStatement:
+		nodeType = t.typeLoopControl(node, "break")
+	case *ast.ContinueStatement:
+		nodeType = t.typeLoopControl(node, "continue")
 	default:
 		t.registerErrorAtNode(node, "Cannot type-check node of type %T.", node)
 		return types.UnknownType
@@ -106,21 +186,252 @@ func (t *TypeChecker) TypeCheck(node ast.Node, scope *TypeScope) *types.Type {
 	return nodeType
 }
 func (t *TypeChecker) typeClassStatement(node *ast.ClassStatement, scope *TypeScope) *types.Type {
-	classType := &types.Type{Kind: types.CLASS}
+	defer delete(t.pending, node.Name.Value)
 
-	err := scope.Add(node.Name.Value, classType)
-	if err != nil {
-		t.addError(err)
+	if !t.declaredClasses[node] {
+		t.registerErrorAtNode(node, "Classes can only be declared at the top level.")
+		return types.UnknownType
+	}
+
+	classType := t.classes[node.Name.Value]
+	failed := false
+
+	for _, method := range node.Methods {
+		methodScope := NewEnclosedScope(scope)
+		methodScope.Define("self", classType, node.Name)
+
+		methodType := t.TypeCheck(method, methodScope)
+		if methodType == types.UnknownType {
+			failed = true
+		}
+	}
+
+	if !t.checkFieldsAssigned(node, classType) {
+		failed = true
+	}
+
+	if failed {
 		return types.UnknownType
 	}
 
 	return classType
 }
+
+// checkFieldsAssigned makes sure init assigns every field without a zero value, the constructor leaves those out of the
+// instance. Only assignments directly in the body of init count, one inside an if or a loop might not run.
+func (t *TypeChecker) checkFieldsAssigned(node *ast.ClassStatement, classType *types.Type) bool {
+	var init *ast.FunctionStatement
+	for _, method := range node.Methods {
+		if method.Name.Value == "init" {
+			init = method
+		}
+	}
+	if init == nil {
+		return true
+	}
+
+	assigned := map[string]bool{}
+	for _, statement := range init.Body.Statements {
+		expression, ok := statement.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		assignment, ok := expression.Inside.(*ast.AssignmentStatement)
+		if !ok || assignment.IsCompound() {
+			continue
+		}
+		field, ok := assignment.Target.(*ast.FieldExpression)
+		if !ok {
+			continue
+		}
+		if caller, ok := field.Caller.(*ast.IdentifierExpression); ok && caller.Value.Value == "self" {
+			assigned[field.Field.String()] = true
+		}
+	}
+
+	ok := true
+	for i, field := range node.Fields {
+		if types.HasZeroValue(node.FieldTypes[i]) || assigned[field.Value] {
+			continue
+		}
+		t.registerErrorAtNode(&ast.IdentifierExpression{Value: field}, "Field '%s' of class %s is not assigned in init and has no zero value, assign it there or make it optional.", field.Value, classType)
+		ok = false
+	}
+	return ok
+}
+
+// declareClasses builds the type of every top-level class before any statement is checked, fields and methods can then
+// refer to any class and functions can take and return instances.
+func (t *TypeChecker) declareClasses(statements []ast.Statement, scope *TypeScope) {
+	classes := []*ast.ClassStatement{}
+
+	for _, statement := range statements {
+		class, ok := statement.(*ast.ClassStatement)
+		if !ok {
+			continue
+		}
+
+		// Marked even on failure, so a duplicate name is only reported once.
+		t.declaredClasses[class] = true
+
+		if _, exists := t.classes[class.Name.Value]; exists {
+			t.registerErrorAtNode(class, "Class '%s' is already declared.", class.Name.Value)
+			continue
+		}
+
+		t.classes[class.Name.Value] = types.NewClassType(class.Name.Value)
+		classes = append(classes, class)
+	}
+
+	for _, class := range classes {
+		t.declareMembers(class)
+
+		err := scope.Define(class.Name.Value, t.constructorType(class), class.Name)
+		if err != nil {
+			t.addErrorAt(class.Name, err)
+			continue
+		}
+
+		t.pending[class.Name.Value] = true
+	}
+}
+func (t *TypeChecker) declareMembers(node *ast.ClassStatement) {
+	classType := t.classes[node.Name.Value]
+
+	addMember := func(name *token.Token, memberType *types.Type) bool {
+		if _, exists := classType.Members[name.Value]; exists {
+			t.registerErrorAtNode(&ast.IdentifierExpression{Value: name}, "Class %s already has a member '%s'.", classType, name.Value)
+			return false
+		}
+		classType.Members[name.Value] = memberType
+		return true
+	}
+
+	for i, field := range node.Fields {
+		node.FieldTypes[i] = t.resolveType(node, node.FieldTypes[i])
+
+		if addMember(field, node.FieldTypes[i]) {
+			classType.Fields = append(classType.Fields, field.Value)
+		}
+	}
+
+	for _, method := range node.Methods {
+		t.resolveSignature(method)
+		// Methods are reached through an instance, they are never added to a scope by name.
+		t.declared[method] = true
+
+		if method.Name.Value == "init" && method.ReturnType != types.VoidType {
+			t.registerErrorAtNode(method, "Method 'init' cannot return a value.")
+		}
+
+		addMember(method.Name, functionSignature(method))
+	}
+}
+
+// constructorType takes the arguments of the init method, or every field in declaration order when there is none.
+func (t *TypeChecker) constructorType(node *ast.ClassStatement) *types.Type {
+	classType := t.classes[node.Name.Value]
+
+	for _, method := range node.Methods {
+		if method.Name.Value == "init" {
+			return types.NewFunctionType(functionSignature(method).Args, classType)
+		}
+	}
+
+	args := []*types.Type{}
+	for _, field := range classType.Fields {
+		args = append(args, classType.Members[field])
+	}
+
+	return types.NewFunctionType(args, classType)
+}
+
+// resolveType replaces classes referred to by name with their declared type.
+func (t *TypeChecker) resolveType(node ast.Node, tp *types.Type) *types.Type {
+	if tp == nil {
+		return nil
+	}
+
+	switch tp.Kind {
+	case types.CLASS:
+		classType, ok := t.classes[tp.Name]
+		if !ok {
+			t.registerErrorAtNode(node, "Unknown type '%s'.", tp.Name)
+			return types.UnknownType
+		}
+		return classType
+	case types.ARRAY, types.HASH, types.FUNCTION, types.OPTIONAL:
+		resolved := *tp
+		resolved.KeyType = t.resolveType(node, tp.KeyType)
+		resolved.ValueType = t.resolveType(node, tp.ValueType)
+		resolved.ReturnType = t.resolveType(node, tp.ReturnType)
+		resolved.Args = nil
+		for _, arg := range tp.Args {
+			resolved.Args = append(resolved.Args, t.resolveType(node, arg))
+		}
+		if reflect.DeepEqual(&resolved, tp) {
+			return tp
+		}
+		return &resolved
+	default:
+		return tp
+	}
+}
+func (t *TypeChecker) resolveSignature(node *ast.FunctionStatement) {
+	for i, argtype := range node.Type {
+		node.Type[i] = t.resolveType(node, argtype)
+	}
+	node.ReturnType = t.resolveType(node, node.ReturnType)
+}
+
+// typeMember returns the type of a field or method, method reports whether the member is a method.
+func (t *TypeChecker) typeMember(node *ast.FieldExpression, scope *TypeScope) (memberType *types.Type, method bool) {
+	hostType := t.TypeCheck(node.Caller, scope)
+
+	if hostType == types.UnknownType {
+		return types.UnknownType, false
+	}
+
+	field, ok := node.Field.(*ast.IdentifierExpression)
+	if !ok {
+		t.registerErrorAtNode(node, "Expected a field name, got %s.", node.Field)
+		return types.UnknownType, false
+	}
+
+	name := field.Value.Value
+
+	if hostType.Kind != types.CLASS {
+		t.registerErrorAtNode(node, "Type %s has no field '%s'.", hostType, name)
+		return types.UnknownType, false
+	}
+
+	memberType, ok = hostType.Members[name]
+	if !ok {
+		t.registerErrorAtNode(field, "Class %s has no member '%s'.", hostType, name)
+		return types.UnknownType, false
+	}
+
+	return memberType, !hostType.IsField(name)
+}
+func (t *TypeChecker) typeFieldExpression(node *ast.FieldExpression, scope *TypeScope) *types.Type {
+	memberType, method := t.typeMember(node, scope)
+
+	if method {
+		t.registerErrorAtNode(node.Field, "Method '%s' must be called.", node.Field)
+		return types.UnknownType
+	}
+
+	return memberType
+}
 func (t *TypeChecker) typeArrayIndex(node *ast.IndexExpression, scope *TypeScope) *types.Type {
 	arrayType := t.TypeCheck(node.Caller, scope)
 
 	indexType := t.TypeCheck(node.Index, scope)
 
+	if indexType == types.UnknownType {
+		return types.UnknownType
+	}
+
 	if indexType != types.IntType {
 		t.registerErrorAtNode(node.Index, "Array index must be int, got %s.", indexType)
 		return types.UnknownType
@@ -134,17 +445,24 @@ func (t *TypeChecker) typeHashAccess(node *ast.IndexExpression, scope *TypeScope
 
 	indexType := t.TypeCheck(node.Index, scope)
 
+	if indexType == types.UnknownType {
+		return types.UnknownType
+	}
+
 	if indexType != hashType.KeyType {
 		t.registerErrorAtNode(node.Index, "Hash key type mismatch: expected %s, got %s.", hashType.KeyType, indexType)
 		return types.UnknownType
 	}
 
-	return hashType.ValueType
+	// The key might be missing.
+	return types.NewOptionalType(hashType.ValueType)
 }
 func (t *TypeChecker) typeIndexExpression(node *ast.IndexExpression, scope *TypeScope) *types.Type {
 	hostType := t.TypeCheck(node.Caller, scope)
 
 	switch hostType.Kind {
+	case types.UNKNOWN:
+		return types.UnknownType
 	case types.ARRAY:
 		return t.typeArrayIndex(node, scope)
 	case types.HASH:
@@ -248,6 +566,10 @@ func (t *TypeChecker) typeArrayExpression(node *ast.ArrayExpression, scope *Type
 func (t *TypeChecker) typePrefixExpression(node *ast.PrefixExpression, scope *TypeScope) *types.Type {
 	nodeType := t.TypeCheck(node.Right, scope)
 
+	if nodeType == types.UnknownType {
+		return types.UnknownType
+	}
+
 	if node.Operator.Type == token.MINUS {
 		if nodeType != types.IntType && nodeType != types.FloatType {
 			t.registerErrorAtNode(node, "Unary '-' expects int or float, got %s.", nodeType)
@@ -270,25 +592,118 @@ func (t *TypeChecker) typeAssignmentExpression(node *ast.AssignmentStatement, sc
 	valuetype := t.TypeCheck(node.Value, scope)
 	// DONE: Check if the value type is void, can't assign void to anything.
 
+	if valuetype == types.UnknownType {
+		return types.UnknownType
+	}
+
 	if valuetype == types.VoidType {
 		t.registerErrorAtNode(node, "Cannot assign a value of type void.")
 		return types.UnknownType
 	}
 
-	existingType := scope.Get(node.Name.Value)
+	existingType := t.typeAssignmentTarget(node, scope)
 
 	if existingType == types.UnknownType {
-		t.registerErrorAtNode(node, "Variable '%s' is not declared.", node.Name.Value)
 		return types.UnknownType
 	}
 
-	if !reflect.DeepEqual(existingType, valuetype) {
-		t.registerErrorAtNode(node, "Assignment type mismatch: variable is %s, value is %s.", existingType, valuetype)
+	if node.IsCompound() {
+		valuetype = t.typeCompoundAssignment(node, existingType, valuetype)
+
+		if valuetype == types.UnknownType {
+			return types.UnknownType
+		}
+	}
+
+	if !types.IsAssignable(existingType, valuetype) {
+		t.registerErrorAtNode(node, "Assignment type mismatch: %s is %s, value is %s.", targetKind(node.Target), existingType, valuetype)
 		return types.UnknownType
 	}
 
+	// Assigning a value which might be nil undoes an earlier nil check.
+	if target, ok := node.Target.(*ast.IdentifierExpression); ok && existingType.Kind == types.OPTIONAL && !types.IsEqual(existingType.ValueType, valuetype) {
+		scope.Narrow(target.Value.Value, existingType)
+	}
+
 	return valuetype
 }
+func (t *TypeChecker) typeAssignmentTarget(node *ast.AssignmentStatement, scope *TypeScope) *types.Type {
+	switch target := node.Target.(type) {
+	case *ast.IdentifierExpression:
+		existingType := scope.Get(target.Value.Value)
+
+		if existingType == types.UnknownType {
+			if !scope.IsPoisoned(target.Value.Value) {
+				t.registerErrorAtNode(node, "Variable '%s' is not declared.", target.Value.Value)
+			}
+			return types.UnknownType
+		}
+
+		// A variable narrowed by a nil check can still be set to nil, compound assignments need the narrowed type.
+		if !node.IsCompound() {
+			existingType = scope.Declared(target.Value.Value)
+		}
+
+		// The compiler needs the target type for compound assignments.
+		t.typeMap[target] = existingType
+
+		return existingType
+	case *ast.IndexExpression:
+		// Same rules as reading, array index must be int and hash key must match the KeyType.
+		elementType := t.TypeCheck(target, scope)
+
+		// Reading a hash gives an optional, but the stored value is never nil. A compound assignment reads the key
+		// first, the compiler makes that read fail when the key is missing.
+		if elementType != types.UnknownType && t.typeMap[target.Caller].Kind == types.HASH {
+			elementType = t.typeMap[target.Caller].ValueType
+			t.typeMap[target] = elementType
+		}
+
+		return elementType
+	case *ast.FieldExpression:
+		fieldType, method := t.typeMember(target, scope)
+
+		if method {
+			t.registerErrorAtNode(target.Field, "Cannot assign to method '%s'.", target.Field)
+			return types.UnknownType
+		}
+
+		// The compiler needs the target type for compound assignments.
+		t.typeMap[target] = fieldType
+		return fieldType
+	default:
+		t.registerErrorAtNode(node, "Cannot assign to %s.", node.Target.TypeInfo())
+		return types.UnknownType
+	}
+}
+func (t *TypeChecker) typeCompoundAssignment(node *ast.AssignmentStatement, targetType *types.Type, valueType *types.Type) *types.Type {
+	operator := compoundOperators[node.Operator.Type]
+
+	resolver, ok := binaryResolvers[operator]
+
+	if !ok {
+		t.registerErrorAtNode(node, "Unsupported operator %q.", node.Operator.Type)
+		return types.UnknownType
+	}
+
+	resultType, err := resolver(targetType, valueType)
+	if err != nil {
+		t.registerErrorAtNode(node, "%s", err.Error())
+		return types.UnknownType
+	}
+
+	return resultType
+}
+func targetKind(target ast.Expression) string {
+	switch target.(type) {
+	case *ast.IndexExpression:
+		return "element"
+	case *ast.FieldExpression:
+		return "field"
+	default:
+		return "variable"
+	}
+}
 func (t *TypeChecker) typeParenthesisExpression(node *ast.ParenthesisExpression, scope *TypeScope) *types.Type {
 	return t.TypeCheck(node.Inside, scope)
 }
@@ -296,17 +711,29 @@ func (t *TypeChecker) typeParenthesisExpression(node *ast.ParenthesisExpression,
 func (t *TypeChecker) typeBinaryExpression(node *ast.BinaryExpression, scope *TypeScope) *types.Type {
 	left := t.TypeCheck(node.Left, scope)
 
+	// The right side is still checked for mistakes of its own, a long concatenation can hide several.
 	if left == types.UnknownType {
+		t.TypeCheck(node.Right, scope)
 		return types.UnknownType
 	}
 
-	right := t.TypeCheck(node.Right, scope)
+	// The right side of `x != nil and ...` only runs when x is not nil.
+	rightScope := scope
+	if node.Operator.Type == token.AND {
+		rightScope = t.narrow(node.Left, token.NEQ, scope)
+	}
+
+	right := t.TypeCheck(node.Right, rightScope)
 	if right == types.UnknownType {
 		return types.UnknownType
 	}
 
 	operator := node.Operator.Type
 
+	if (operator == token.EQ || operator == token.NEQ) && (left == types.NilType || right == types.NilType) {
+		return t.typeNilComparison(node, left, right)
+	}
+
 	resolver, ok := binaryResolvers[operator]
 
 	if !ok {
@@ -322,29 +749,119 @@ func (t *TypeChecker) typeBinaryExpression(node *ast.BinaryExpression, scope *Ty
 
 	return expType
 }
+func (t *TypeChecker) typeNilComparison(node *ast.BinaryExpression, left, right *types.Type) *types.Type {
+	other := left
+	if left == types.NilType {
+		other = right
+	}
+
+	if other.Kind != types.OPTIONAL && other != types.NilType {
+		t.registerErrorAtNode(node, "Only optionals can be compared with nil, got %s.", other)
+		return types.UnknownType
+	}
+
+	return types.BoolType
+}
+
+// narrow returns a scope where the variable checked by condition has its optional unwrapped. operator is the check
+// which must hold, `x != nil` narrows with NEQ and the else branch of `x == nil` narrows with EQ. Both sides of an
+// `and` which holds are narrowed, so are both sides of an `or` which does not.
+func (t *TypeChecker) narrow(condition ast.Expression, operator token.TokenType, scope *TypeScope) *TypeScope {
+	for {
+		inside, ok := condition.(*ast.ParenthesisExpression)
+		if !ok {
+			break
+		}
+		condition = inside.Inside
+	}
+
+	check, ok := condition.(*ast.BinaryExpression)
+	if !ok {
+		return scope
+	}
+
+	if (operator == token.NEQ && check.Operator.Type == token.AND) || (operator == token.EQ && check.Operator.Type == token.OR) {
+		return t.narrow(check.Right, operator, t.narrow(check.Left, operator, scope))
+	}
+
+	if check.Operator.Type != operator {
+		return scope
+	}
+
+	variable, isVariable := check.Left.(*ast.IdentifierExpression)
+	_, isNil := check.Right.(*ast.NilExpression)
+	if !isVariable || !isNil {
+		return scope
+	}
+
+	optional := scope.Get(variable.Value.Value)
+	if optional.Kind != types.OPTIONAL {
+		return scope
+	}
+
+	narrowed := NewEnclosedScope(scope)
+	narrowed.Narrow(variable.Value.Value, optional.ValueType)
+
+	return narrowed
+}
 func (t *TypeChecker) typeFunctionCall(node *ast.FunctionCallExpression, scope *TypeScope) *types.Type {
-	ftype := scope.Get(node.Caller.String())
+	ftype := t.typeCallee(node, scope)
 
 	if ftype == types.UnknownType {
-		t.registerErrorAtNode(node.Caller, "Function '%s' is not declared in this scope.", node.Caller.String())
-		return types.UnknownType
-	} else if ftype.Kind != types.FUNCTION {
-		t.registerErrorAtNode(node.Caller, "'%s' is not a function.", node.Caller.String())
 		return types.UnknownType
 	}
 
 	// DONE: Add test for function call, test arity etc.
-	if len(ftype.Args) != len(node.Arguments) {
-		t.registerErrorAtNode(node, "Function expects %d arguments, got %d.", len(ftype.Args), len(node.Arguments))
+	required := len(ftype.Args)
+	if caller, ok := node.Caller.(*ast.IdentifierExpression); ok && scope.IsBuiltin(caller.Value.Value) {
+		required = RequiredArguments(ftype)
+	}
+	if len(node.Arguments) < required || len(node.Arguments) > len(ftype.Args) {
+		if required == len(ftype.Args) {
+			t.registerErrorAtNode(node, "Function expects %d arguments, got %d.", len(ftype.Args), len(node.Arguments))
+		} else {
+			t.registerErrorAtNode(node, "Function expects %d to %d arguments, got %d.", required, len(ftype.Args), len(node.Arguments))
+		}
 		return types.UnknownType
 	}
 
+	// Every argument is checked, so independent mistakes in one call are all reported.
+	failed := false
+
+	// Type variables of a generic builtin are bound by the arguments, from left to right.
+	generic := types.IsGeneric(ftype)
+	bindings := types.Bindings{}
+
 	// Label for outer for loop
 SUPERTYPE:
-	for i, argtype := range ftype.Args {
-		actualtype := t.TypeCheck(node.Arguments[i], scope)
+	for i, argument := range node.Arguments {
+		argtype := ftype.Args[i]
+		actualtype := t.TypeCheck(argument, scope)
+		// Strings the parser made up have no position, the call has.
+		at := ast.Node(argument)
+		if ast.NodeToken(argument) == nil {
+			at = node
+		}
+
+		if actualtype == types.UnknownType {
+			failed = true
+			continue
+		}
+
+		if generic {
+			if !types.Unify(argtype, actualtype, bindings) {
+				t.registerErrorAtNode(at, "Function argument %d type mismatch: expected %s, got %s.", i, types.Substitute(argtype, bindings), actualtype)
+				failed = true
+			}
+			continue
+		}
+
 		// Needed to get typechecking working for builtins with any-type
 		if argtype.Kind == types.ANY {
+			// Without subtypes any value is accepted, like str(x) does.
+			if len(argtype.Args) == 0 && actualtype != types.VoidType {
+				continue
+			}
 			for _, subtype := range argtype.Args {
 				// DONE: Compare the kind, not the raw type
 				if types.IsSubType(subtype, actualtype) {
@@ -352,23 +869,82 @@ SUPERTYPE:
 					continue SUPERTYPE
 				}
 			}
-			t.registerErrorAtNode(node.Arguments[i], "Function argument %d does not match any allowed type %s; got %s.", i, argtype, actualtype)
-			return types.UnknownType
+			t.registerErrorAtNode(at, "Function argument %d does not match any allowed type %s; got %s.", i, argtype, actualtype)
+			failed = true
+			continue
 		}
 		// DONE: Implement better type comparison
-		if !types.IsEqual(actualtype, argtype) {
-			t.registerErrorAtNode(node.Arguments[i], "Function argument %d type mismatch: expected %s, got %s.", i, argtype, actualtype)
+		if !types.IsAssignable(argtype, actualtype) {
+			t.registerErrorAtNode(at, "Function argument %d type mismatch: expected %s, got %s.", i, argtype, actualtype)
+			failed = true
+		}
+	}
+
+	if failed {
+		return types.UnknownType
+	}
+
+	return types.Substitute(ftype.ReturnType, bindings)
+}
+
+// RequiredArguments counts the arguments a call to a builtin of type ftype has to pass, trailing optional arguments
+// can be left out and are nil. Functions written in tremor take every argument.
+func RequiredArguments(ftype *types.Type) int {
+	required := len(ftype.Args)
+	for required > 0 && ftype.Args[required-1].Kind == types.OPTIONAL {
+		required--
+	}
+	return required
+}
+
+// typeCallee returns the type of the called function, methods are looked up on the class of the instance.
+func (t *TypeChecker) typeCallee(node *ast.FunctionCallExpression, scope *TypeScope) *types.Type {
+	if field, ok := node.Caller.(*ast.FieldExpression); ok {
+		ftype, _ := t.typeMember(field, scope)
+
+		if ftype == types.UnknownType {
+			return types.UnknownType
+		}
+
+		t.typeMap[field] = ftype
+
+		if ftype.Kind != types.FUNCTION {
+			t.registerErrorAtNode(node.Caller, "'%s' is not a function.", node.Caller.String())
 			return types.UnknownType
 		}
+
+		return ftype
+	}
+
+	if !t.checkDefined(node.Caller, node.Caller.String()) {
+		return types.UnknownType
 	}
 
-	return ftype.ReturnType
+	ftype := scope.Get(node.Caller.String())
+
+	if ftype == types.UnknownType {
+		if !scope.IsPoisoned(node.Caller.String()) {
+			t.registerErrorAtNode(node.Caller, "Function '%s' is not declared in this scope.", node.Caller.String())
+		}
+		return types.UnknownType
+	} else if ftype.Kind != types.FUNCTION {
+		t.registerErrorAtNode(node.Caller, "'%s' is not a function.", node.Caller.String())
+		return types.UnknownType
+	}
+
+	if caller, ok := node.Caller.(*ast.IdentifierExpression); ok {
+		t.typeMap[caller] = ftype
+		t.recordDefinition(caller, scope)
+	}
+
+	return ftype
 }
 
 func (t *TypeChecker) typeFunctionStatement(node *ast.FunctionStatement, scope *TypeScope) *types.Type {
-	functiontype := &types.Type{Kind: types.FUNCTION}
+	defer delete(t.pending, node.Name.Value)
 
-	functiontype.ReturnType = node.ReturnType
+	t.resolveSignature(node)
+	functiontype := functionSignature(node)
 
 	if functiontype.ReturnType.Kind == types.ANY {
 		t.registerErrorAtNode(node, "Function return type cannot be any.")
@@ -377,18 +953,33 @@ func (t *TypeChecker) typeFunctionStatement(node *ast.FunctionStatement, scope *
 
 	newScope := NewEnclosedScope(scope)
 
-	functiontype.Args = []*types.Type{}
-
 	for i, argtype := range node.Type {
 		name := node.Args[i].Value
-		functiontype.Args = append(functiontype.Args, argtype)
-		newScope.Add(name, argtype)
+		newScope.Define(name, argtype, node.Args[i])
 	}
 
-	// TODO: Check if recursion in typechecker works.
-	newScope.Add(node.Name.Value, functiontype)
+	// Declared functions are already visible through the outer scope.
+	if !t.declared[node] {
+		newScope.Define(node.Name.Value, functiontype, node.Name)
+	}
 
+	// break and continue cannot jump out of a function body.
+	outerLoopDepth := t.loopDepth
+	t.loopDepth = 0
+	t.functionDepth += 1
 	bodyType := t.TypeCheck(node.Body, newScope)
+	t.functionDepth -= 1
+	t.loopDepth = outerLoopDepth
+
+	if bodyType == types.UnknownType {
+		// The signature is still sound, later calls are checked against it.
+		if !t.declared[node] {
+			if err := scope.Define(node.Name.Value, functiontype, node.Name); err != nil {
+				t.addErrorAt(node.Name, err)
+			}
+		}
+		return types.UnknownType
+	}
 
 	if bodyType.Kind == types.RETURN {
 		if bodyType.AlwaysReturns == false {
@@ -398,23 +989,113 @@ func (t *TypeChecker) typeFunctionStatement(node *ast.FunctionStatement, scope *
 		bodyType = bodyType.ReturnType
 	}
 
-	if !types.IsEqual(bodyType, functiontype.ReturnType) {
+	if !types.IsAssignable(functiontype.ReturnType, bodyType) {
 		t.registerErrorAtNode(node, "Return type mismatch: expected %s, got %s.", functiontype.ReturnType, bodyType)
 		return bodyType
 	}
 
-	err := scope.Add(node.Name.Value, functiontype)
+	if t.declared[node] {
+		return functiontype
+	}
+
+	err := scope.Define(node.Name.Value, functiontype, node.Name)
 	if err != nil {
-		t.addError(err)
+		t.addErrorAt(node.Name, err)
 		return types.UnknownType
 	}
 
 	return functiontype
 }
+func functionSignature(node *ast.FunctionStatement) *types.Type {
+	args := []*types.Type{}
+	args = append(args, node.Type...)
+
+	return types.NewFunctionType(args, node.ReturnType)
+}
+
+// declareFunctions adds the signature of every function statement to the scope ahead of their definitions.
+func (t *TypeChecker) declareFunctions(statements []ast.Statement, scope *TypeScope) {
+	// Classes are already pending.
+	names := maps.Clone(t.pending)
+	for _, statement := range statements {
+		if function, ok := statement.(*ast.FunctionStatement); ok {
+			names[function.Name.Value] = true
+		}
+	}
+
+	for _, statement := range statements {
+		function, ok := statement.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+		t.references[function.Name.Value] = referencedNames(function.Body, names)
+
+		// Marked even on failure, so a duplicate name is only reported once.
+		t.declared[function] = true
+		t.resolveSignature(function)
+
+		err := scope.Define(function.Name.Value, functionSignature(function), function.Name)
+		if err != nil {
+			t.addErrorAt(function.Name, err)
+			continue
+		}
+
+		t.pending[function.Name.Value] = true
+	}
+}
+func (t *TypeChecker) checkDefined(node ast.Node, name string) bool {
+	if t.functionDepth != 0 {
+		return true
+	}
+	if t.pending[name] {
+		t.registerErrorAtNode(node, "Function '%s' is used before its definition.", name)
+		return false
+	}
+	if pending := t.pendingReference(name, map[string]bool{}); pending != "" {
+		t.registerErrorAtNode(node, "Function '%s' is used before the definition of '%s', which it refers to.", name, pending)
+		return false
+	}
+	return true
+}
+
+// pendingReference follows the references of a function and returns the first one which is still pending.
+func (t *TypeChecker) pendingReference(name string, seen map[string]bool) string {
+	if seen[name] {
+		return ""
+	}
+	seen[name] = true
+
+	for _, reference := range t.references[name] {
+		if t.pending[reference] {
+			return reference
+		}
+		if pending := t.pendingReference(reference, seen); pending != "" {
+			return pending
+		}
+	}
+	return ""
+}
+
+// referencedNames lists the names out of names a function body refers to, lambdas in it included.
+func referencedNames(body *ast.BlockStatement, names map[string]bool) []string {
+	result := []string{}
+	ast.Inspect(body, func(node ast.Node) bool {
+		if identifier, ok := node.(*ast.IdentifierExpression); ok && names[identifier.Value.Value] {
+			result = append(result, identifier.Value.Value)
+		}
+		return true
+	})
+	return result
+}
 
 func (t *TypeChecker) typeLambdaExpression(node *ast.LambdaExpression, scope *TypeScope) *types.Type {
 	functiontype := &types.Type{Kind: types.FUNCTION}
 
+	for i, argtype := range node.Type {
+		node.Type[i] = t.resolveType(node, argtype)
+	}
+	node.ReturnType = t.resolveType(node, node.ReturnType)
+
 	functiontype.ReturnType = node.ReturnType
 
 	newScope := NewEnclosedScope(scope)
@@ -425,10 +1106,17 @@ func (t *TypeChecker) typeLambdaExpression(node *ast.LambdaExpression, scope *Ty
 		name := node.Args[i].Value
 		functiontype.Args = append(functiontype.Args, argtype)
 
-		newScope.Add(name, argtype)
+		newScope.Define(name, argtype, node.Args[i])
 	}
 
+	outerLoopDepth := t.loopDepth
+	t.loopDepth = 0
 	bodyType := t.TypeCheck(node.Body, newScope)
+	t.loopDepth = outerLoopDepth
+
+	if bodyType == types.UnknownType {
+		return types.UnknownType
+	}
 
 	if bodyType.Kind == types.RETURN {
 		if bodyType.AlwaysReturns == false {
@@ -438,7 +1126,7 @@ func (t *TypeChecker) typeLambdaExpression(node *ast.LambdaExpression, scope *Ty
 		bodyType = bodyType.ReturnType
 	}
 
-	if !types.IsEqual(bodyType, functiontype.ReturnType) {
+	if !types.IsAssignable(functiontype.ReturnType, bodyType) {
 		t.registerErrorAtNode(node, "Return type mismatch: expected %s, got %s.", functiontype.ReturnType, bodyType)
 		return bodyType
 	}
@@ -446,40 +1134,53 @@ func (t *TypeChecker) typeLambdaExpression(node *ast.LambdaExpression, scope *Ty
 }
 
 func (t *TypeChecker) typeIdentifierExpression(node *ast.IdentifierExpression, scope *TypeScope) *types.Type {
+	if !t.checkDefined(node, node.Value.Value) {
+		return types.UnknownType
+	}
+
 	atype := scope.Get(node.Value.Value)
+	t.recordDefinition(node, scope)
 
-	if atype == types.UnknownType {
+	if atype == types.UnknownType && !scope.IsPoisoned(node.Value.Value) {
 		t.registerErrorAtNode(node, "Symbol '%s' is not declared in this scope.", node.Value.Value)
 	}
 
+	// Only a call binds the type variables.
+	if types.IsGeneric(atype) {
+		t.registerErrorAtNode(node, "Generic function '%s' can only be called.", node.Value.Value)
+		return types.UnknownType
+	}
+
 	return atype
 }
 func (t *TypeChecker) typeIfStatement(node *ast.IfStatement, scope *TypeScope) *types.Type {
 	condtype := t.TypeCheck(node.Condition, scope)
+	failed := condtype == types.UnknownType
 
-	if condtype == types.UnknownType {
-		return types.UnknownType
-	}
-
-	if condtype != types.BoolType {
+	if !failed && condtype != types.BoolType {
 		t.registerErrorAtNode(node.Condition, "If condition must be bool, got %s.", condtype.Kind)
-		return types.UnknownType
+		failed = true
 	}
 
-	constype := t.TypeCheck(node.Consequence, scope)
+	// The branches are checked even when the condition is wrong, they can have mistakes of their own.
+	constype := t.TypeCheck(node.Consequence, t.narrow(node.Condition, token.NEQ, scope))
 	if constype == types.UnknownType {
-		return types.UnknownType
+		failed = true
 	}
 
 	var alttype *types.Type = nil
 	if node.Alternative != nil {
-		alttype = t.TypeCheck(node.Alternative, scope)
+		alttype = t.TypeCheck(node.Alternative, t.narrow(node.Condition, token.EQ, scope))
 
 		if alttype == types.UnknownType {
-			return types.UnknownType
+			failed = true
 		}
 	}
 
+	if failed {
+		return types.UnknownType
+	}
+
 	if alttype != nil {
 		// Both consequence and alternative are present
 		if constype.Kind != alttype.Kind {
@@ -501,6 +1202,110 @@ func (t *TypeChecker) typeIfStatement(node *ast.IfStatement, scope *TypeScope) *
 	// Conditional returns are not a thing.
 	return types.VoidType
 }
+func (t *TypeChecker) typeWhileStatement(node *ast.WhileStatement, scope *TypeScope) *types.Type {
+	condtype := t.TypeCheck(node.Condition, scope)
+	failed := condtype == types.UnknownType
+
+	if !failed && condtype != types.BoolType {
+		t.registerErrorAtNode(node.Condition, "While condition must be bool, got %s.", condtype.Kind)
+		failed = true
+	}
+
+	t.loopDepth += 1
+	bodytype := t.TypeCheck(node.Body, t.narrow(node.Condition, token.NEQ, scope))
+	t.loopDepth -= 1
+
+	if failed || bodytype == types.UnknownType {
+		return types.UnknownType
+	}
+
+	// The body might never run, so a return inside it is like a return inside an if without else.
+	return types.VoidType
+}
+func (t *TypeChecker) typeForStatement(node *ast.ForStatement, scope *TypeScope) *types.Type {
+	iterableType := t.TypeCheck(node.Iterable, scope)
+	failed := iterableType == types.UnknownType
+
+	var variableTypes []*types.Type
+
+	_, isRange := node.Iterable.(*ast.RangeExpression)
+
+	switch {
+	case failed:
+	case isRange:
+		variableTypes = []*types.Type{types.IntType}
+	case iterableType.Kind == types.ARRAY:
+		if len(node.Variables) == 1 {
+			variableTypes = []*types.Type{iterableType.KeyType}
+		} else {
+			variableTypes = []*types.Type{types.IntType, iterableType.KeyType}
+		}
+	case iterableType.Kind == types.HASH:
+		variableTypes = []*types.Type{iterableType.KeyType, iterableType.ValueType}
+	default:
+		t.registerErrorAtNode(node.Iterable, "Type %s is not iterable; expected array, hash or range.", iterableType)
+		failed = true
+	}
+
+	if !failed && len(node.Variables) > len(variableTypes) {
+		t.registerErrorAtNode(node, "Iterating over %s binds at most %d variables, got %d.", iterableType, len(variableTypes), len(node.Variables))
+		failed = true
+	}
+
+	newScope := NewEnclosedScope(scope)
+
+	for i, variable := range node.Variables {
+		// The body is still checked when the header is wrong, the loop variables are poisoned instead.
+		if failed {
+			newScope.Poison(variable.Value)
+			continue
+		}
+
+		err := newScope.Shadow(variable.Value, variableTypes[i], variable)
+		if err != nil {
+			t.addErrorAt(variable, err)
+			failed = true
+		}
+	}
+
+	t.loopDepth += 1
+	bodytype := t.TypeCheck(node.Body, newScope)
+	t.loopDepth -= 1
+
+	if failed || bodytype == types.UnknownType {
+		return types.UnknownType
+	}
+
+	return types.VoidType
+}
+func (t *TypeChecker) typeRangeExpression(node *ast.RangeExpression, scope *TypeScope) *types.Type {
+	startType := t.TypeCheck(node.Start, scope)
+
+	if startType == types.UnknownType {
+		return types.UnknownType
+	}
+
+	endType := t.TypeCheck(node.End, scope)
+
+	if endType == types.UnknownType {
+		return types.UnknownType
+	}
+
+	if startType != types.IntType || endType != types.IntType {
+		t.registerErrorAtNode(node, "Range bounds must be int, got %s and %s.", startType, endType)
+		return types.UnknownType
+	}
+
+	return types.IntType
+}
+func (t *TypeChecker) typeLoopControl(node ast.Statement, keyword string) *types.Type {
+	if t.loopDepth == 0 {
+		t.registerErrorAtNode(node, "'%s' is only allowed inside a loop.", keyword)
+		return types.UnknownType
+	}
+
+	return types.VoidType
+}
 func (t *TypeChecker) typeReturnStatement(node *ast.ReturnStatement, scope *TypeScope) *types.Type {
 	valuetype := t.TypeCheck(node.Value, scope)
 
@@ -516,57 +1321,110 @@ func (t *TypeChecker) typeReturnStatement(node *ast.ReturnStatement, scope *Type
 }
 func (t *TypeChecker) typeLetStatement(node *ast.LetStatement, scope *TypeScope) *types.Type {
 	valuetype := t.TypeCheck(node.Value, scope)
+	pretype := t.resolveType(node, node.Type)
 
 	if !isValidType(t, valuetype) {
+		t.declareFailed(node, pretype, scope)
 		return types.UnknownType
 	}
 
-	pretype := node.Type
-
 	switch pretype {
+	case types.UnknownType:
+		t.declareFailed(node, pretype, scope)
+		return types.UnknownType
 	case types.AutoType:
+		if valuetype == types.NilType {
+			t.registerErrorAtNode(node, "Cannot infer a type from nil, declare an optional type such as ?int.")
+			t.declareFailed(node, pretype, scope)
+			return types.UnknownType
+		}
 		t.registerInfo("Auto-typed into %s", valuetype)
 		pretype = valuetype
 	default:
-		if !types.IsEqual(valuetype, pretype) {
-			t.registerErrorAtNode(node, "Declared type mismatch: expected %s, got %s.", pretype.Kind, valuetype.Kind)
+		if !types.IsAssignable(pretype, valuetype) {
+			t.registerErrorAtNode(node, "Declared type mismatch: expected %s, got %s.", pretype, valuetype)
+			t.declareFailed(node, pretype, scope)
 			return types.UnknownType
 		}
 	}
 
-	err := scope.Add(node.Name.Value, valuetype)
+	err := scope.Define(node.Name.Value, pretype, node.Name)
 	if err != nil {
-		t.addError(err)
+		t.addErrorAt(node.Name, err)
 		return types.UnknownType
 	}
 
-	return valuetype
+	return pretype
+
+}
+
+// declareFailed still declares the name of a let statement which failed to type check. An explicit type is kept, so
+// later statements are checked against it, otherwise the symbol is poisoned and its uses fail without more errors.
+func (t *TypeChecker) declareFailed(node *ast.LetStatement, pretype *types.Type, scope *TypeScope) {
+	if pretype == types.AutoType || pretype == types.UnknownType {
+		scope.Poison(node.Name.Value)
+		return
+	}
 
+	if _, exists := scope.symbolExists(node.Name.Value); !exists {
+		scope.Define(node.Name.Value, pretype, node.Name)
+	}
 }
 func (t *TypeChecker) typeAST(node *ast.AST, scope *TypeScope) *types.Type {
+	t.declareClasses(node.Statements, scope)
+	t.declareFunctions(node.Statements, scope)
+	// Nothing is pending once the whole file is checked.
+	defer clear(t.pending)
+
+	// A failed statement does not stop the check, every mistake in the file is reported at once.
+	failed := false
+
 	tp := types.VoidType
 	for _, statement := range node.Statements {
 		tp = t.TypeCheck(statement, scope)
 		if tp == types.UnknownType {
-			return tp
+			failed = true
 		}
 	}
+
+	if failed {
+		return types.UnknownType
+	}
 	return tp
 }
 
 func (t *TypeChecker) typeBlockStatement(node *ast.BlockStatement, scope *TypeScope) *types.Type {
+	t.scopes[node] = scope
+	failed := false
+
 	for _, statement := range node.Statements {
 
 		statementType := t.TypeCheck(statement, scope)
 
 		if statementType == types.UnknownType {
-			return statementType
+			failed = true
+			continue
 		}
 
 		if statementType.AlwaysReturns && statementType.Kind == types.RETURN {
+			if failed {
+				return types.UnknownType
+			}
 			return statementType
 		}
 
+		// After `if x == nil then return ... end` the rest of the block knows x is not nil.
+		if guard, ok := statement.(*ast.IfStatement); ok && guard.Alternative == nil {
+			constype := t.typeMap[guard.Consequence]
+			if constype.Kind == types.RETURN && constype.AlwaysReturns {
+				scope = t.narrow(guard.Condition, token.EQ, scope)
+			}
+		}
+
+	}
+
+	if failed {
+		return types.UnknownType
 	}
 	return types.VoidType
 }
@@ -585,15 +1443,17 @@ func (t *TypeChecker) registerInfo(format string, args ...any) {
 	msg := fmt.Sprintf(format, args...)
 	t.info = append(t.info, msg)
 }
-func (t *TypeChecker) addError(err error) {
-	t.errors = append(t.errors, diagnostic.New("typechecker", t.file, t.source, "%s", err.Error()))
+
+// addErrorAt reports err at the name it is about, like a symbol declared twice.
+func (t *TypeChecker) addErrorAt(tok *token.Token, err error) {
+	t.registerErrorAtNode(&ast.IdentifierExpression{Value: tok}, "%s", err.Error())
 }
 func (t *TypeChecker) Errors() []TypeError {
 	return t.errors
 }
 func isValidType(t *TypeChecker, inputType *types.Type) bool {
+	// Unknown types come from an error which has already been reported.
 	if inputType == types.UnknownType {
-		t.registerError("Expected a concrete type, got unknown.")
 		return false
 	}
 
@@ -3,10 +3,12 @@ package typechecker
 import (
 	"testing"
 
+	"github.com/pspiagicw/tremor/diagnostic"
 	"github.com/pspiagicw/tremor/lexer"
 	"github.com/pspiagicw/tremor/parser"
 	"github.com/pspiagicw/tremor/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParenthesisExpression(t *testing.T) {
@@ -57,6 +59,54 @@ func TestAssignmentStatement(t *testing.T) {
 	testTypeChecking(t, input, expected)
 }
 
+func TestArrayIndexAssignment(t *testing.T) {
+	input := `let a = [1, 2, 3] a[0] = 5`
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestHashKeyAssignment(t *testing.T) {
+	input := `let a = {"one": 1} a["two"] = 2`
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestArrayIndexAssignmentMismatch(t *testing.T) {
+	input := `let a = [1, 2, 3] a[0] = "five"`
+
+	expected := types.UnknownType
+
+	testTypeCheckingWithoutErr(t, input, expected)
+}
+
+func TestHashKeyAssignmentMismatch(t *testing.T) {
+	input := `let a = {"one": 1} a[2] = 2`
+
+	expected := types.UnknownType
+
+	testTypeCheckingWithoutErr(t, input, expected)
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	input := `let a = 1 a += 2 let s = "a" s ..= "b" let f = 1.5 f -= 1`
+
+	expected := types.FloatType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestCompoundAssignmentMismatch(t *testing.T) {
+	input := `let a = 1 a += 2.5`
+
+	expected := types.UnknownType
+
+	testTypeCheckingWithoutErr(t, input, expected)
+}
+
 func TestLetStatementWithoutType(t *testing.T) {
 	input := `let a = true`
 
@@ -157,6 +207,146 @@ func TestFunctionStatementWithFunctionReturnTypes(t *testing.T) {
 	testTypeChecking(t, input, expected)
 }
 
+func TestRecursiveFunction(t *testing.T) {
+	input := `
+        fn pow(x int, n int) int then
+            if n == 0 then
+                return 1
+            end
+            return x * pow(x, n - 1)
+        end
+        pow(2, 8)
+    `
+	expected := types.IntType
+	testTypeChecking(t, input, expected)
+}
+
+func TestMutuallyRecursiveFunctions(t *testing.T) {
+	input := `
+        fn even(n int) bool then
+            if n == 0 then
+                return true
+            end
+            return odd(n - 1)
+        end
+        fn odd(n int) bool then
+            if n == 0 then
+                return false
+            end
+            return even(n - 1)
+        end
+        even(10)
+    `
+	expected := types.BoolType
+	testTypeChecking(t, input, expected)
+}
+
+func TestForwardReferenceArgumentMismatch(t *testing.T) {
+	input := `
+        fn first() int then
+            return second("one")
+        end
+        fn second(a int) int then
+            return a
+        end
+    `
+	testTypeCheckingError(t, input)
+}
+
+func TestCallBeforeDefinition(t *testing.T) {
+	input := `
+        later()
+        fn later() then
+        end
+    `
+	testTypeCheckingError(t, input)
+}
+
+func TestIndirectCallBeforeDefinition(t *testing.T) {
+	input := `
+        fn a() int then
+            return b()
+        end
+        print(a())
+        fn b() int then
+            return 1
+        end
+    `
+	errs := testTypeCheckingErrorCount(t, input, 1)
+
+	assert.Equal(t, "Function 'a' is used before the definition of 'b', which it refers to.", errs[0].Error())
+}
+
+func TestDuplicateFunctionPosition(t *testing.T) {
+	input := `fn twice() then
+end
+fn twice() then
+end`
+	checker := NewTypeChecker()
+	scope := NewScope()
+	scope.SetupBuiltinFunctions()
+	checker.TypeCheck(parser.NewParser(lexer.NewLexer(input)).ParseAST(), scope)
+
+	errs := checker.Errors()
+	require.Len(t, errs, 1)
+
+	assert.Equal(t, "Symbol 'twice', already declared with type 'fn() void'", errs[0].Error())
+	assertErrorAt(t, errs[0], 3, 4)
+}
+
+func TestDuplicateVariablePosition(t *testing.T) {
+	input := `let a = 1
+let a = 2`
+	errs := testTypeCheckingErrorCount(t, input, 1)
+
+	assertErrorAt(t, errs[0], 2, 5)
+}
+
+func TestLambdaReferenceBeforeDefinition(t *testing.T) {
+	input := `
+        let g = fn() int then return f() end
+        fn f() int then
+            return 1
+        end
+    `
+	errs := testTypeCheckingErrorCount(t, input, 1)
+
+	assert.Equal(t, "Function 'f' is used before its definition.", errs[0].Error())
+}
+
+func TestIndirectCallAfterDefinition(t *testing.T) {
+	input := `
+        fn a() int then
+            return b()
+        end
+        fn b() int then
+            return c()
+        end
+        fn c() int then
+            return a()
+        end
+        a()
+    `
+	testTypeChecking(t, input, types.IntType)
+}
+
+func TestTransitiveCallBeforeDefinition(t *testing.T) {
+	input := `
+        fn a() int then
+            let f = fn() int then return b() end
+            return f()
+        end
+        fn b() int then
+            return c()
+        end
+        a()
+        fn c() int then
+            return 1
+        end
+    `
+	testTypeCheckingErrorCount(t, input, 1)
+}
+
 func TestLetStatementString(t *testing.T) {
 	input := `let b string = "name"`
 
@@ -195,6 +385,36 @@ func TestFloatAddition(t *testing.T) {
 	testTypeChecking(t, input, expected)
 }
 
+func TestIntModulus(t *testing.T) {
+	input := `7 % 3`
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestFloatModulusError(t *testing.T) {
+	input := `7.5 % 2`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestIntExponent(t *testing.T) {
+	input := `2 ^ 10`
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestFloatExponent(t *testing.T) {
+	input := `2 ^ 0.5`
+
+	expected := types.FloatType
+
+	testTypeChecking(t, input, expected)
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"hello" .. " world"`
 
@@ -203,6 +423,61 @@ func TestStringConcatenation(t *testing.T) {
 	testTypeChecking(t, input, expected)
 }
 
+func TestStrAcceptsAnyValue(t *testing.T) {
+	inputs := []string{`str(1)`, `str(2.5)`, `str(true)`, `str([1, 2])`, `str({"a": 1})`, `str("s")`}
+
+	for _, input := range inputs {
+		testTypeChecking(t, input, types.StringType)
+	}
+}
+
+func TestStrRejectsVoid(t *testing.T) {
+	input := `fn f() then
+	end
+	str(f())`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestTrailingOptionalArgumentsOfBuiltinsCanBeLeftOut(t *testing.T) {
+	testTypeChecking(t, `exit()`, types.VoidType)
+	testTypeChecking(t, `exit(1)`, types.VoidType)
+}
+
+func TestFunctionsTakeEveryArgument(t *testing.T) {
+	input := `fn greet(name string, greeting ?string) string then
+		return name
+	end
+	greet("a")`
+
+	errs := testTypeCheckingErrorCount(t, input, 1)
+	assert.Contains(t, errs[0].Error(), "Function expects 2 arguments, got 1.")
+}
+
+func TestLeftOutArgumentsMustBeOptional(t *testing.T) {
+	errs := testTypeCheckingErrorCount(t, `slice([1])`, 1)
+	assert.Contains(t, errs[0].Error(), "Function expects 2 to 3 arguments, got 1.")
+
+	errs = testTypeCheckingErrorCount(t, `exit(1, 2)`, 1)
+	assert.Contains(t, errs[0].Error(), "Function expects 0 to 1 arguments, got 2.")
+
+	testTypeCheckingErrorCount(t, `exit("1")`, 1)
+}
+
+func TestInterpolation(t *testing.T) {
+	input := `let x = 1
+	let name = "tremor"
+	"${name} is ${x + 1} and ${[true]}"`
+
+	expected := types.StringType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestInterpolationChecksItsExpressions(t *testing.T) {
+	testTypeCheckingErrorCount(t, `"${1 + true} and ${missing}"`, 2)
+}
+
 func TestBooleanAnd(t *testing.T) {
 	input := `true and false`
 
@@ -504,6 +779,127 @@ func TestReturnAfterIf(t *testing.T) {
 	testTypeChecking(t, input, expected)
 }
 
+func TestWhileStatement(t *testing.T) {
+	input := `
+        let i = 0
+        while i < 10 then
+            if i == 5 then
+                break
+            end
+            i = i + 1
+            continue
+        end
+    `
+	expected := types.VoidType
+	testTypeChecking(t, input, expected)
+}
+
+func TestWhileConditionMustBeBool(t *testing.T) {
+	input := `while 1 then end`
+	expected := types.UnknownType
+	testTypeCheckingWithoutErr(t, input, expected)
+}
+
+func TestBreakOutsideLoop(t *testing.T) {
+	input := `break`
+	expected := types.UnknownType
+	testTypeCheckingWithoutErr(t, input, expected)
+}
+
+func TestContinueInsideFunctionInsideLoop(t *testing.T) {
+	input := `
+        while true then
+            fn inner() then
+                continue
+            end
+        end
+    `
+	expected := types.UnknownType
+	testTypeCheckingWithoutErr(t, input, expected)
+}
+
+func TestReturnOnlyInsideWhile(t *testing.T) {
+	input := `
+        fn first() int then
+            while true then
+                return 1
+            end
+        end
+    `
+	// The loop body might never run.
+	testTypeCheckingError(t, input)
+}
+
+func TestForStatementArray(t *testing.T) {
+	input := `
+        let total = 0
+        for i, x in [1, 2, 3] then
+            total = total + i + x
+        end
+    `
+	expected := types.VoidType
+	testTypeChecking(t, input, expected)
+}
+
+func TestForStatementHash(t *testing.T) {
+	input := `
+        let names = ""
+        for name, city in {"a": "x", "b": "y"} then
+            names = names .. name .. city
+        end
+    `
+	expected := types.VoidType
+	testTypeChecking(t, input, expected)
+}
+
+func TestForStatementRange(t *testing.T) {
+	input := `
+        let total = 0
+        for i in 0..10 then
+            total = total + i
+        end
+    `
+	expected := types.VoidType
+	testTypeChecking(t, input, expected)
+}
+
+func TestForStatementElementType(t *testing.T) {
+	input := `for x in ["a", "b"] then let y int = x end`
+	testTypeCheckingError(t, input)
+}
+
+func TestForStatementNotIterable(t *testing.T) {
+	input := `for x in 5 then end`
+	testTypeCheckingError(t, input)
+}
+
+func TestForStatementRangeBounds(t *testing.T) {
+	input := `for x in 0..1.5 then end`
+	testTypeCheckingError(t, input)
+}
+
+func TestForStatementVariableScope(t *testing.T) {
+	input := `for x in [1] then end x`
+	testTypeCheckingError(t, input)
+}
+
+func TestForStatementVariableShadows(t *testing.T) {
+	input := `
+        let x = 5
+        for x in ["a", "b"] then
+            let y string = x
+        end
+        x
+    `
+	expected := types.IntType
+	testTypeChecking(t, input, expected)
+}
+
+func TestForStatementVariableCannotShadowBuiltin(t *testing.T) {
+	input := `for len in [1] then end`
+	testTypeCheckingError(t, input)
+}
+
 func TestArrayExpressionEmpty(t *testing.T) {
 	input := `[]`
 
@@ -549,7 +945,7 @@ func TestIndexExpression(t *testing.T) {
 func TestAccessExpression(t *testing.T) {
 	input := `{"something": true}["something"]`
 
-	expected := types.BoolType
+	expected := types.NewOptionalType(types.BoolType)
 
 	testTypeChecking(t, input, expected)
 }
@@ -557,71 +953,633 @@ func TestAccessExpression(t *testing.T) {
 func TestClassStatement(t *testing.T) {
 	input := `class Something end`
 
-	expected := &types.Type{Kind: types.CLASS}
+	expected := types.NewClassType("Something")
 
 	testTypeChecking(t, input, expected)
 }
 
-func testTypeChecking(t *testing.T, input string, expected *types.Type) {
-
-	l := lexer.NewLexer(input)
-	p := parser.NewParser(l)
-	typechecker := NewTypeChecker()
-
-	ast := p.ParseAST()
+const pointClass = `
+    class Point
+        x int
+        y int
 
-	printParserErrors(t, p)
+        fn norm() int then
+            return self.x * self.x + self.y * self.y
+        end
 
-	scope := NewScope()
-	scope.SetupBuiltinFunctions()
+        fn shift(dx int) then
+            self.x += dx
+        end
 
-	got := typechecker.TypeCheck(ast, scope)
+        fn mirror() Point then
+            return Point(self.y, self.x)
+        end
+    end
+`
 
-	printTypeCheckerErrors(t, typechecker)
+func TestClassConstructor(t *testing.T) {
+	input := pointClass + `Point(1, 2)`
 
-	assert.Equal(t, expected.Kind, got.Kind, "Expected correct type.")
+	expected := types.NewClassType("Point")
 
-	if got.Kind == types.FUNCTION {
-		assert.Equal(t, expected.ReturnType, got.ReturnType, "Return type don't match")
-		for i := range expected.Args {
-			assert.Equal(t, expected.Args[i], got.Args[i], "Args for type don't match.")
-		}
-	}
+	testTypeChecking(t, input, expected)
 }
 
-func testTypeCheckingWithoutErr(t *testing.T, input string, expected *types.Type) {
+func TestClassTypeString(t *testing.T) {
+	input := pointClass + `Point(1, 2)`
+
 	l := lexer.NewLexer(input)
 	p := parser.NewParser(l)
 	typechecker := NewTypeChecker()
 
-	ast := p.ParseAST()
-
-	printParserErrors(t, p)
-
 	scope := NewScope()
-	scope.SetupBuiltinFunctions()
+	got := typechecker.TypeCheck(p.ParseAST(), scope)
 
-	got := typechecker.TypeCheck(ast, scope)
+	assert.Equal(t, "Point", got.String())
+	assert.Equal(t, "fn(int,int) Point", scope.Get("Point").String())
+}
 
-	// Ignore typechecker errors!
-	// printTypeCheckerErrors(t, typechecker)
+func TestClassFieldRead(t *testing.T) {
+	input := pointClass + `let p = Point(1, 2) p.x`
 
-	assert.Equal(t, expected.Kind, got.Kind, "Expected correct type.")
+	expected := types.IntType
 
-	if got.Kind == types.FUNCTION {
-		assert.Equal(t, expected.ReturnType, got.ReturnType, "Return type don't match")
-		for i := range expected.Args {
-			assert.Equal(t, expected.Args[i], got.Args[i], "Args for type don't match.")
-		}
-	}
+	testTypeChecking(t, input, expected)
 }
 
-func printTypeCheckerErrors(t *testing.T, typechecker *TypeChecker) {
-	errs := typechecker.Errors()
+func TestClassFieldAssignment(t *testing.T) {
+	input := pointClass + `let p = Point(1, 2) p.y = 5`
 
-	assert.Empty(t, errs, "Typechecker has errors!")
-}
-func printParserErrors(t *testing.T, p *parser.Parser) {
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestClassInstancePrint(t *testing.T) {
+	input := pointClass + `let p = Point(1, 2) print(p) str(p)`
+
+	expected := types.StringType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestClassMethodCall(t *testing.T) {
+	input := pointClass + `let p = Point(1, 2) p.mirror().norm()`
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestClassInit(t *testing.T) {
+	input := `
+        class Counter
+            count int
+            step int
+
+            fn init(step int) then
+                self.step = step
+            end
+        end
+        Counter(2).step
+    `
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestClassFieldNeverAssigned(t *testing.T) {
+	input := pointClass + `
+        class Segment
+            from Point
+            to Point
+            label ?Point
+
+            fn init(to Point) then
+                self.to = to
+                if true then
+                    self.from = to
+                end
+            end
+        end
+    `
+
+	errs := testTypeCheckingErrorCount(t, input, 1)
+
+	assert.Equal(t, "Field 'from' of class Segment is not assigned in init and has no zero value, assign it there or make it optional.", errs[0].Error())
+}
+
+func TestClassAsParameter(t *testing.T) {
+	input := pointClass + `
+        fn sum(p Point) int then
+            return p.x + p.y
+        end
+        sum(Point(1, 2))
+    `
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestClassConstructorArgumentError(t *testing.T) {
+	input := pointClass + `Point(1, "two")`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestClassUnknownMemberError(t *testing.T) {
+	input := pointClass + `let p = Point(1, 2) p.z`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestClassFieldAssignmentError(t *testing.T) {
+	input := pointClass + `let p = Point(1, 2) p.x = "one"`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestClassMethodWithoutCallError(t *testing.T) {
+	input := pointClass + `let p = Point(1, 2) let f = p.norm`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestClassDuplicateMemberError(t *testing.T) {
+	input := `
+        class Point
+            x int
+            fn x() int then
+                return 1
+            end
+        end
+    `
+
+	testTypeCheckingError(t, input)
+}
+
+func TestUnknownTypeError(t *testing.T) {
+	input := `
+        fn area(s Shape) int then
+            return 0
+        end
+    `
+
+	testTypeCheckingError(t, input)
+}
+
+func TestFieldOnNonClassError(t *testing.T) {
+	input := `let a = 1 a.x`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestOptionalLet(t *testing.T) {
+	input := `let a ?int = nil a = 5`
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestOptionalLetValue(t *testing.T) {
+	input := `let a ?string = "hello" a`
+
+	expected := types.NewOptionalType(types.StringType)
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestNilWithoutTypeError(t *testing.T) {
+	input := `let a = nil`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestNilForNonOptionalError(t *testing.T) {
+	input := `let a int = nil`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestOptionalWithoutCheckError(t *testing.T) {
+	input := `let a ?int = 1 a + 1`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestOptionalArgumentWithoutCheckError(t *testing.T) {
+	input := `let a ?int = 1 print(a)`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestOptionalNarrowing(t *testing.T) {
+	input := `
+        let a ?int = 1
+        if a != nil then
+            a + 1
+        end
+    `
+
+	expected := types.VoidType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestOptionalNarrowingElse(t *testing.T) {
+	input := `
+        fn orZero(a ?int) int then
+            if a == nil then
+                return 0
+            else
+                return a
+            end
+        end
+        orZero(nil)
+    `
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestOptionalNarrowingAnd(t *testing.T) {
+	input := `let a ?int = 1 a != nil and a > 0`
+
+	expected := types.BoolType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestOptionalNarrowingAndCondition(t *testing.T) {
+	input := pointClass + `
+        fn norm(p ?Point, q ?Point) int then
+            if p != nil and q != nil and p.x > 0 then
+                return p.x + q.y
+            end
+            if p == nil or q == nil then
+                return 0
+            end
+            return p.y + q.x
+        end
+        norm(Point(1, 2), nil)
+    `
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestOptionalNarrowingOrConditionHolds(t *testing.T) {
+	input := `
+        let a ?int = 1
+        if a != nil or true then
+            a + 1
+        end
+    `
+
+	testTypeCheckingError(t, input)
+}
+
+func TestOptionalNarrowingOnlyInsideBranch(t *testing.T) {
+	input := `
+        let a ?int = 1
+        if a != nil then
+            print(a)
+        end
+        a + 1
+    `
+
+	testTypeCheckingError(t, input)
+}
+
+func TestOptionalNarrowingEarlyReturn(t *testing.T) {
+	input := `
+        fn orZero(a ?int) int then
+            if a == nil then
+                return 0
+            end
+            return a
+        end
+        orZero(1)
+    `
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestOptionalAssignmentUndoesNarrowing(t *testing.T) {
+	input := `
+        let a ?int = 1
+        let b ?int = nil
+        if a != nil then
+            a = b
+            a + 1
+        end
+    `
+
+	testTypeCheckingError(t, input)
+}
+
+func TestNilComparisonNonOptionalError(t *testing.T) {
+	input := `let a = 1 a == nil`
+
+	testTypeCheckingError(t, input)
+}
+
+func TestOptionalReturn(t *testing.T) {
+	input := `
+        fn find(xs []int, x int) ?int then
+            for i, value in xs then
+                if value == x then
+                    return i
+                end
+            end
+            return nil
+        end
+        find([1, 2, 3], 2)
+    `
+
+	expected := types.NewOptionalType(types.IntType)
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestHashAccessNarrowing(t *testing.T) {
+	input := `
+        let ages = {"alice": 30}
+        let age = ages["bob"]
+        if age != nil then
+            age + 1
+        end
+    `
+
+	expected := types.VoidType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestHashAssignmentIsNotOptional(t *testing.T) {
+	input := `let ages = {"alice": 30} ages["bob"] = 25`
+
+	expected := types.IntType
+
+	testTypeChecking(t, input, expected)
+}
+
+func TestIndependentTypeErrors(t *testing.T) {
+	input := `
+    let a int = "one"
+    let b = true + 1
+    if 1 then
+        print(2)
+    end
+    let c string = 3
+    print(undefined)
+    `
+
+	testTypeCheckingErrorCount(t, input, 5)
+}
+
+func TestPoisonedSymbolReportedOnce(t *testing.T) {
+	input := `
+    let a = missing + 1
+    let b = a * 2
+    a = 5
+    print(b)
+    `
+
+	errs := testTypeCheckingErrorCount(t, input, 1)
+
+	assert.Equal(t, "Symbol 'missing' is not declared in this scope.", errs[0].Error())
+}
+
+func TestFailedLetKeepsDeclaredType(t *testing.T) {
+	input := `
+    let a int = "one"
+    let b string = a
+    `
+
+	errs := testTypeCheckingErrorCount(t, input, 2)
+
+	assert.Equal(t, "Declared type mismatch: expected string, got int.", errs[1].Error())
+}
+
+func TestTypeErrorsInsideBodies(t *testing.T) {
+	input := `
+    fn broken() int then
+        let a int = true
+        return "a"
+    end
+    let total int = broken() + 1
+    while 1 then
+        total = "many"
+    end
+    for x in 5 then
+        print(x)
+    end
+    `
+
+	testTypeCheckingErrorCount(t, input, 4)
+}
+
+func TestTypeErrorsInFunctionCallArguments(t *testing.T) {
+	input := `
+    fn add(a int, b int) int then
+        return a + b
+    end
+    add("one", true)
+    `
+
+	testTypeCheckingErrorCount(t, input, 2)
+}
+
+func TestArrayBuiltinsKeepElementType(t *testing.T) {
+	strings := &types.Type{Kind: types.ARRAY, KeyType: types.StringType}
+
+	testInferredType(t, `push(["a"], "b")`, strings)
+	testInferredType(t, `pop(["a", "b"])`, strings)
+	testInferredType(t, `slice(["a", "b"], 1)`, strings)
+	testInferredType(t, `sort(["b", "a"])`, strings)
+}
+
+func TestMapInfersResultType(t *testing.T) {
+	input := `map([1, 2], fn(x int) string then return str(x) end)`
+
+	testInferredType(t, input, &types.Type{Kind: types.ARRAY, KeyType: types.StringType})
+}
+
+func TestFilterKeepsElementType(t *testing.T) {
+	input := `filter([1.5, 2.5], fn(x float) bool then return x > 2.0 end)`
+
+	testInferredType(t, input, &types.Type{Kind: types.ARRAY, KeyType: types.FloatType})
+}
+
+func TestReduceInfersAccumulatorType(t *testing.T) {
+	input := `reduce([1, 2], fn(total string, x int) string then return total .. str(x) end, "")`
+
+	testInferredType(t, input, types.StringType)
+}
+
+func TestSortByKeepsElementType(t *testing.T) {
+	input := `sort_by(["ccc", "a"], fn(s string) int then return len(s) end)`
+
+	testInferredType(t, input, &types.Type{Kind: types.ARRAY, KeyType: types.StringType})
+}
+
+func TestArrayBuiltinElementMismatch(t *testing.T) {
+	errs := testTypeCheckingErrorCount(t, `push([1, 2], "three")`, 1)
+
+	assert.Equal(t, "Function argument 1 type mismatch: expected int, got string.", errs[0].Error())
+}
+
+func TestMapFunctionMismatch(t *testing.T) {
+	input := `map(["a"], fn(x int) int then return x end)`
+
+	errs := testTypeCheckingErrorCount(t, input, 1)
+
+	assert.Equal(t, "Function argument 1 type mismatch: expected fn(string) U, got fn(int) int.", errs[0].Error())
+	assertErrorAt(t, errs[0], 1, 12)
+}
+
+func TestStringArgumentMismatchPosition(t *testing.T) {
+	input := `let a = [1]
+let b = push(a, "x")`
+
+	errs := testTypeCheckingErrorCount(t, input, 1)
+
+	assertErrorAt(t, errs[0], 2, 17)
+}
+
+// assertErrorAt checks that err points at line and column.
+func assertErrorAt(t *testing.T, err TypeError, line int, column int) {
+	d, ok := err.(*diagnostic.Diagnostic)
+	if assert.True(t, ok) && assert.NotNil(t, d.Span, "Expected %q to have a position.", err) {
+		assert.Equal(t, line, d.Span.StartLine)
+		assert.Equal(t, column, d.Span.StartColumn)
+	}
+}
+
+func TestSortNeedsOrderedElements(t *testing.T) {
+	testTypeCheckingErrorCount(t, `sort([true, false])`, 1)
+	testTypeCheckingErrorCount(t, `sort_by([1], fn(x int) bool then return true end)`, 1)
+}
+
+func TestGenericBuiltinAsValueError(t *testing.T) {
+	errs := testTypeCheckingErrorCount(t, `let f = map`, 1)
+
+	assert.Equal(t, "Generic function 'map' can only be called.", errs[0].Error())
+}
+
+func testTypeChecking(t *testing.T, input string, expected *types.Type) {
+
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	typechecker := NewTypeChecker()
+
+	ast := p.ParseAST()
+
+	printParserErrors(t, p)
+
+	scope := NewScope()
+	scope.SetupBuiltinFunctions()
+
+	got := typechecker.TypeCheck(ast, scope)
+
+	printTypeCheckerErrors(t, typechecker)
+
+	assert.Equal(t, expected.Kind, got.Kind, "Expected correct type.")
+
+	if got.Kind == types.OPTIONAL {
+		assert.Equal(t, expected.ValueType, got.ValueType, "Optional types don't match.")
+	}
+
+	if got.Kind == types.CLASS {
+		assert.Equal(t, expected.Name, got.Name, "Class names don't match.")
+	}
+
+	if got.Kind == types.FUNCTION {
+		assert.Equal(t, expected.ReturnType, got.ReturnType, "Return type don't match")
+		for i := range expected.Args {
+			assert.Equal(t, expected.Args[i], got.Args[i], "Args for type don't match.")
+		}
+	}
+}
+
+func testTypeCheckingWithoutErr(t *testing.T, input string, expected *types.Type) {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	typechecker := NewTypeChecker()
+
+	ast := p.ParseAST()
+
+	printParserErrors(t, p)
+
+	scope := NewScope()
+	scope.SetupBuiltinFunctions()
+
+	got := typechecker.TypeCheck(ast, scope)
+
+	// Ignore typechecker errors!
+	// printTypeCheckerErrors(t, typechecker)
+
+	assert.Equal(t, expected.Kind, got.Kind, "Expected correct type.")
+
+	if got.Kind == types.FUNCTION {
+		assert.Equal(t, expected.ReturnType, got.ReturnType, "Return type don't match")
+		for i := range expected.Args {
+			assert.Equal(t, expected.Args[i], got.Args[i], "Args for type don't match.")
+		}
+	}
+}
+
+func testTypeCheckingError(t *testing.T, input string) {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	typechecker := NewTypeChecker()
+
+	ast := p.ParseAST()
+
+	printParserErrors(t, p)
+
+	scope := NewScope()
+	scope.SetupBuiltinFunctions()
+
+	_ = typechecker.TypeCheck(ast, scope)
+
+	assert.NotEmpty(t, typechecker.Errors(), "Expected typechecker errors!")
+}
+
+func testTypeCheckingErrorCount(t *testing.T, input string, count int) []TypeError {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	typechecker := NewTypeChecker()
+
+	ast := p.ParseAST()
+
+	printParserErrors(t, p)
+
+	scope := NewScope()
+	scope.SetupBuiltinFunctions()
+
+	got := typechecker.TypeCheck(ast, scope)
+
+	assert.Equal(t, types.UnknownType, got, "Expected the check to fail.")
+	assert.Len(t, typechecker.Errors(), count, "Expected %d typechecker errors, got %v", count, typechecker.Errors())
+
+	return typechecker.Errors()
+}
+
+func printTypeCheckerErrors(t *testing.T, typechecker *TypeChecker) {
+	errs := typechecker.Errors()
+
+	assert.Empty(t, errs, "Typechecker has errors!")
+}
+func printParserErrors(t *testing.T, p *parser.Parser) {
 
 	errs := p.Errors()
 
@@ -634,3 +1592,23 @@ func printParserErrors(t *testing.T, p *parser.Parser) {
 	}
 
 }
+
+// testInferredType compares the whole type, element types included.
+func testInferredType(t *testing.T, input string, expected *types.Type) {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	typechecker := NewTypeChecker()
+
+	ast := p.ParseAST()
+
+	printParserErrors(t, p)
+
+	scope := NewScope()
+	scope.SetupBuiltinFunctions()
+
+	got := typechecker.TypeCheck(ast, scope)
+
+	printTypeCheckerErrors(t, typechecker)
+
+	assert.True(t, types.IsEqual(expected, got), "Expected %s, got %s.", expected, got)
+}
@@ -0,0 +1,123 @@
+package types
+
+// GENERIC is a type variable of a builtin signature like `push([]T, T) []T`, every call binds it to the type of the
+// argument it first meets.
+const GENERIC TypeKind = "generic"
+
+// NewGenericType returns the type variable name, a variable with constraints can only be bound to one of them.
+func NewGenericType(name string, constraints ...*Type) *Type {
+	t := &Type{
+		Kind: GENERIC,
+		Name: name,
+		Args: constraints,
+	}
+
+	return t
+}
+
+// IsGeneric reports whether t mentions a type variable.
+func IsGeneric(t *Type) bool {
+	if t == nil {
+		return false
+	}
+	if t.Kind == GENERIC {
+		return true
+	}
+
+	if IsGeneric(t.KeyType) || IsGeneric(t.ValueType) || IsGeneric(t.ReturnType) {
+		return true
+	}
+	for _, arg := range t.Args {
+		if IsGeneric(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bindings maps the names of type variables to the types a call bound them to.
+type Bindings map[string]*Type
+
+// Unify matches the type of an argument against the type of a parameter, binding the variables the parameter
+// mentions. It reports whether the argument fits.
+func Unify(param, actual *Type, bindings Bindings) bool {
+	if param == nil || actual == nil {
+		return param == actual
+	}
+
+	switch param.Kind {
+	case GENERIC:
+		if bound, ok := bindings[param.Name]; ok {
+			return IsEqual(bound, actual)
+		}
+		if !canBind(param, actual) {
+			return false
+		}
+		bindings[param.Name] = actual
+		return true
+	case ARRAY:
+		return actual.Kind == ARRAY && Unify(param.KeyType, actual.KeyType, bindings)
+	case HASH:
+		return actual.Kind == HASH && Unify(param.KeyType, actual.KeyType, bindings) && Unify(param.ValueType, actual.ValueType, bindings)
+	case OPTIONAL:
+		if actual.Kind == NIL {
+			return true
+		}
+		if actual.Kind == OPTIONAL {
+			return Unify(param.ValueType, actual.ValueType, bindings)
+		}
+		return Unify(param.ValueType, actual, bindings)
+	case FUNCTION:
+		if actual.Kind != FUNCTION || len(param.Args) != len(actual.Args) {
+			return false
+		}
+		for i, arg := range param.Args {
+			if !Unify(arg, actual.Args[i], bindings) {
+				return false
+			}
+		}
+		return Unify(param.ReturnType, actual.ReturnType, bindings)
+	default:
+		return IsAssignable(param, actual)
+	}
+}
+func canBind(variable, actual *Type) bool {
+	switch actual.Kind {
+	case VOID, UNKNOWN, NIL, AUTO, GENERIC:
+		return false
+	}
+
+	if len(variable.Args) == 0 {
+		return true
+	}
+	for _, constraint := range variable.Args {
+		if IsEqual(constraint, actual) {
+			return true
+		}
+	}
+	return false
+}
+
+// Substitute replaces the bound type variables in t, the ones which are not bound are left in place.
+func Substitute(t *Type, bindings Bindings) *Type {
+	if !IsGeneric(t) {
+		return t
+	}
+
+	if t.Kind == GENERIC {
+		if bound, ok := bindings[t.Name]; ok {
+			return bound
+		}
+		return t
+	}
+
+	result := *t
+	result.KeyType = Substitute(t.KeyType, bindings)
+	result.ValueType = Substitute(t.ValueType, bindings)
+	result.ReturnType = Substitute(t.ReturnType, bindings)
+	result.Args = []*Type{}
+	for _, arg := range t.Args {
+		result.Args = append(result.Args, Substitute(arg, bindings))
+	}
+	return &result
+}
@@ -14,6 +14,10 @@ type Type struct {
 	AlwaysReturns bool // Only used to typecheck block-statements
 	KeyType       *Type
 	ValueType     *Type
+	// Only used by classes, Members holds both fields and methods.
+	Name    string
+	Members map[string]*Type
+	Fields  []string // Field names in declaration order, every other member is a method.
 }
 
 // TODO: Implement comlex interfaces like Sized, Printables etc.
@@ -25,9 +29,12 @@ var (
 	VoidType   = &Type{Kind: VOID}
 	AnyType    = &Type{Kind: ANY}
 	AutoType   = &Type{Kind: AUTO}
+	NilType    = &Type{Kind: NIL}
 
 	HashType  = &Type{Kind: HASH}
 	ArrayType = &Type{Kind: ARRAY}
+	// Stands for an instance of any class.
+	ClassType = &Type{Kind: CLASS}
 
 	UnknownType = &Type{Kind: UNKNOWN}
 )
@@ -44,6 +51,10 @@ const (
 
 	CLASS TypeKind = "class"
 
+	// An optional wraps its ValueType, it holds either a value of that type or nil.
+	OPTIONAL TypeKind = "optional"
+	NIL      TypeKind = "nil"
+
 	VOID TypeKind = "void"
 	AUTO TypeKind = "auto"
 	ANY  TypeKind = "any"
@@ -66,6 +77,11 @@ func IsEqual(first, second *Type) bool {
 		return false
 	}
 
+	// Classes are nominal, members are not compared.
+	if first.Kind == CLASS {
+		return first.Name == second.Name
+	}
+
 	if !IsEqual(first.ReturnType, second.ReturnType) {
 		return false
 	}
@@ -115,9 +131,41 @@ func IsSubType(supertype, subtype *Type) bool {
 		return false
 	}
 
+	if supertype == ClassType {
+		if subtype.Kind == CLASS {
+			return true
+		}
+		return false
+	}
+
 	return IsEqual(supertype, subtype)
 }
 
+// HasZeroValue reports whether a field of type t can start out with a value of its own, a constructor does so for the
+// fields its init leaves out. Instances and functions have none.
+func HasZeroValue(t *Type) bool {
+	switch t.Kind {
+	case INT, FLOAT, STRING, BOOL, ARRAY, HASH, OPTIONAL:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsAssignable reports whether a value of type value can be stored where target is expected.
+// Optionals accept nil and values of their wrapped type.
+func IsAssignable(target, value *Type) bool {
+	if IsEqual(target, value) {
+		return true
+	}
+
+	if target != nil && value != nil && target.Kind == OPTIONAL {
+		return value.Kind == NIL || IsEqual(target.ValueType, value)
+	}
+
+	return false
+}
+
 func NewFunctionType(args []*Type, ReturnType *Type) *Type {
 	t := &Type{
 		Kind:       FUNCTION,
@@ -127,6 +175,40 @@ func NewFunctionType(args []*Type, ReturnType *Type) *Type {
 
 	return t
 }
+
+// NewClassType returns a class without members, the parser uses it to refer to a class by name.
+func NewClassType(name string) *Type {
+	t := &Type{
+		Kind:    CLASS,
+		Name:    name,
+		Members: map[string]*Type{},
+		Fields:  []string{},
+	}
+
+	return t
+}
+func (t *Type) IsField(name string) bool {
+	for _, field := range t.Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NewOptionalType wraps inner, optionals are never nested.
+func NewOptionalType(inner *Type) *Type {
+	if inner.Kind == OPTIONAL {
+		return inner
+	}
+
+	t := &Type{
+		Kind:      OPTIONAL,
+		ValueType: inner,
+	}
+
+	return t
+}
 func NewAnyType(subtypes []*Type) *Type {
 	t := &Type{
 		Kind: ANY,
@@ -137,7 +219,7 @@ func NewAnyType(subtypes []*Type) *Type {
 }
 
 func (t *Type) String() string {
-	if t.Kind == INT || t.Kind == STRING || t.Kind == FLOAT || t.Kind == VOID || t.Kind == UNKNOWN || t.Kind == BOOL || t.Kind == AUTO || t.Kind == ANY {
+	if t.Kind == INT || t.Kind == STRING || t.Kind == FLOAT || t.Kind == VOID || t.Kind == UNKNOWN || t.Kind == BOOL || t.Kind == AUTO || t.Kind == ANY || t.Kind == NIL {
 		return string(t.Kind)
 	}
 
@@ -149,12 +231,23 @@ func (t *Type) String() string {
 		return fmt.Sprintf("[]%s", t.KeyType.String())
 	}
 
+	if t.Kind == OPTIONAL {
+		return fmt.Sprintf("?%s", t.ValueType.String())
+	}
+
 	if t.Kind == HASH {
 		return fmt.Sprintf("[%s]%s", t.KeyType.String(), t.ValueType.String())
 	}
 
+	if t.Kind == GENERIC {
+		return t.Name
+	}
+
 	if t.Kind == CLASS {
-		return fmt.Sprintf("class")
+		if t.Name == "" {
+			return "class"
+		}
+		return t.Name
 	}
 
 	args := []string{}